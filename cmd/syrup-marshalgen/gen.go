@@ -0,0 +1,671 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const syrupPath = "github.com/cjslep/syrup"
+
+// kind is how a Go type is encoded and decoded by the generated code.
+type kind int
+
+const (
+	// otherKind types are handed to Encode and Decode.
+	otherKind kind = iota
+	boolKind
+	intKind
+	uintKind
+	floatKind
+	stringKind
+	bytesKind
+	symbolKind
+	// methodKind types have their own MarshalSyrup or UnmarshalSyrup
+	// methods.
+	methodKind
+	ptrKind
+	sliceKind
+	mapKind
+)
+
+// nilness is whether the values of a Go type may be nil.
+type nilness int
+
+const (
+	notNil nilness = iota
+	canBeNil
+	unknownNil
+)
+
+// goType is a Go type as the generated code understands it.
+type goType struct {
+	kind kind
+	// name is the type as written in the generated code. It is empty for
+	// otherKind types, which are never written.
+	name string
+	// conv is set for named types of the package, which are converted to
+	// and from their underlying type.
+	conv bool
+	// bits is the size of integers and floats, which is 0 for int and uint.
+	bits int
+	// marshal and unmarshal are set for methodKind types with the
+	// respective methods.
+	marshal, unmarshal bool
+	key, elem          *goType
+	nillable           nilness
+}
+
+var basicTypes = map[string]goType{
+	"bool":    {kind: boolKind},
+	"int":     {kind: intKind},
+	"int8":    {kind: intKind, bits: 8},
+	"int16":   {kind: intKind, bits: 16},
+	"int32":   {kind: intKind, bits: 32},
+	"rune":    {kind: intKind, bits: 32},
+	"int64":   {kind: intKind, bits: 64},
+	"uint":    {kind: uintKind},
+	"uint8":   {kind: uintKind, bits: 8},
+	"byte":    {kind: uintKind, bits: 8},
+	"uint16":  {kind: uintKind, bits: 16},
+	"uint32":  {kind: uintKind, bits: 32},
+	"uint64":  {kind: uintKind, bits: 64},
+	"float32": {kind: floatKind, bits: 32},
+	"float64": {kind: floatKind, bits: 64},
+	"string":  {kind: stringKind},
+}
+
+// field is an exported field of a struct.
+type field struct {
+	goName string
+	// name is the name of the field in a dictionary.
+	name             string
+	optional, symbol bool
+	t                *goType
+}
+
+// generator accumulates the methods for the annotated structs of a package.
+type generator struct {
+	pkg string
+	buf bytes.Buffer
+	// types holds the type declarations of the package, and files the
+	// files declaring them, whose imports their types refer to.
+	types map[string]*ast.TypeSpec
+	files map[string]*ast.File
+	// methods holds the syrup methods declared for each type.
+	methods map[string]map[string]bool
+	// structs holds the annotated types in the order they are declared.
+	structs   []string
+	annotated map[string]bool
+	// named memoizes the goTypes of the named types of the package, where
+	// a nil entry is one being determined.
+	named map[string]*goType
+	// vars numbers the variables declared within a method.
+	vars int
+}
+
+func newGenerator(pkg string) *generator {
+	return &generator{
+		pkg:       pkg,
+		types:     map[string]*ast.TypeSpec{},
+		files:     map[string]*ast.File{},
+		methods:   map[string]map[string]bool{},
+		annotated: map[string]bool{},
+		named:     map[string]*goType{},
+	}
+}
+
+// addFile records the declarations of a file of the package.
+func (g *generator) addFile(f *ast.File) {
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				g.types[ts.Name.Name] = ts
+				g.files[ts.Name.Name] = f
+				if isAnnotated(ts.Doc) || len(decl.Specs) == 1 && isAnnotated(decl.Doc) {
+					g.structs = append(g.structs, ts.Name.Name)
+					g.annotated[ts.Name.Name] = true
+				}
+			}
+		case *ast.FuncDecl:
+			if decl.Recv == nil || len(decl.Recv.List) != 1 {
+				continue
+			}
+			switch decl.Name.Name {
+			case "MarshalSyrup", "UnmarshalSyrup", "SyrupLabel":
+				recv := typeName(decl.Recv.List[0].Type)
+				if g.methods[recv] == nil {
+					g.methods[recv] = map[string]bool{}
+				}
+				g.methods[recv][decl.Name.Name] = true
+			}
+		}
+	}
+}
+
+func isAnnotated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == "//syrup:generate" {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName returns the name of a receiver or embedded field's type.
+func typeName(expr ast.Expr) string {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return x.Name
+	case *ast.StarExpr:
+		return typeName(x.X)
+	case *ast.SelectorExpr:
+		return x.Sel.Name
+	case *ast.ParenExpr:
+		return typeName(x.X)
+	}
+	return ""
+}
+
+// generate returns the formatted Go source of the methods.
+func (g *generator) generate() ([]byte, error) {
+	if len(g.structs) == 0 {
+		return nil, fmt.Errorf("no types of package %s are annotated with //syrup:generate", g.pkg)
+	}
+	for _, name := range g.structs {
+		ts := g.types[name]
+		st, ok := ts.Type.(*ast.StructType)
+		if !ok || ts.Assign.IsValid() {
+			return nil, fmt.Errorf("%s is not a struct type", name)
+		} else if m := g.methods[name]; m["MarshalSyrup"] || m["UnmarshalSyrup"] {
+			return nil, fmt.Errorf("%s already has a MarshalSyrup or UnmarshalSyrup method", name)
+		}
+		fields, err := g.fields(name, st)
+		if err != nil {
+			return nil, err
+		}
+		if g.methods[name]["SyrupLabel"] {
+			g.record(name, fields)
+		} else {
+			g.dict(name, fields)
+		}
+	}
+	var out bytes.Buffer
+	out.WriteString("// Code generated by syrup-marshalgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\nimport (\n\t\"fmt\"\n\n\t%q\n)\n\n", g.pkg, syrupPath)
+	out.Write(g.buf.Bytes())
+	b, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+	return b, nil
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// check writes a call returning an error, returning it when not nil.
+func (g *generator) check(format string, args ...interface{}) {
+	g.printf("if err := "+format+"; err != nil {\nreturn err\n}\n", args...)
+}
+
+// newVar returns a variable name unique within the method being written.
+func (g *generator) newVar(prefix string) string {
+	g.vars++
+	return prefix + strconv.Itoa(g.vars)
+}
+
+// fields returns the fields of a struct as the Encoder determines them.
+func (g *generator) fields(name string, st *ast.StructType) ([]field, error) {
+	var fields []field
+	seen := map[string]bool{}
+	for _, f := range st.Fields.List {
+		var names []string
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+		if len(f.Names) == 0 {
+			names = []string{typeName(f.Type)}
+		}
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(s)
+		}
+		t := g.typeOf(f.Type, g.files[name])
+		for _, n := range names {
+			if !ast.IsExported(n) {
+				continue
+			}
+			fd := field{goName: n, name: n, t: t}
+			if v, ok := tag.Lookup("syrup"); ok {
+				if v == "-" {
+					continue
+				}
+				opts := strings.Split(v, ",")
+				if opts[0] != "" {
+					fd.name = opts[0]
+				}
+				for _, opt := range opts[1:] {
+					switch opt {
+					case "optional":
+						fd.optional = true
+					case "symbol":
+						fd.symbol = true
+					}
+				}
+			}
+			if seen[fd.name] {
+				return nil, fmt.Errorf("%s has more than one field named %s", name, fd.name)
+			}
+			seen[fd.name] = true
+			fields = append(fields, fd)
+		}
+	}
+	return fields, nil
+}
+
+// typeOf determines how a type written in the file f is encoded.
+func (g *generator) typeOf(expr ast.Expr, f *ast.File) *goType {
+	switch x := expr.(type) {
+	case *ast.ParenExpr:
+		return g.typeOf(x.X, f)
+	case *ast.Ident:
+		if _, ok := g.types[x.Name]; ok {
+			return g.namedType(x.Name)
+		} else if t, ok := basicTypes[x.Name]; ok {
+			t.name = x.Name
+			return &t
+		} else if x.Name == "error" || x.Name == "any" {
+			return &goType{nillable: canBeNil}
+		}
+		return &goType{}
+	case *ast.SelectorExpr:
+		if pkg, ok := x.X.(*ast.Ident); ok && pkg.Name == syrupName(f) && x.Sel.Name == "Symbol" {
+			return &goType{kind: symbolKind, name: "syrup.Symbol"}
+		}
+		return &goType{nillable: unknownNil}
+	case *ast.StarExpr:
+		elem := g.typeOf(x.X, f)
+		if elem.kind == otherKind {
+			return &goType{nillable: canBeNil}
+		}
+		return &goType{kind: ptrKind, name: "*" + elem.name, elem: elem, nillable: canBeNil}
+	case *ast.ArrayType:
+		if x.Len != nil {
+			return &goType{}
+		}
+		elem := g.typeOf(x.Elt, f)
+		if elem.kind == uintKind && elem.bits == 8 {
+			return &goType{kind: bytesKind, name: "[]byte", nillable: canBeNil}
+		} else if elem.kind == otherKind {
+			return &goType{nillable: canBeNil}
+		}
+		return &goType{kind: sliceKind, name: "[]" + elem.name, elem: elem, nillable: canBeNil}
+	case *ast.MapType:
+		key, elem := g.typeOf(x.Key, f), g.typeOf(x.Value, f)
+		if key.kind != stringKind && key.kind != symbolKind || elem.kind == otherKind {
+			return &goType{nillable: canBeNil}
+		}
+		return &goType{kind: mapKind, name: "map[" + key.name + "]" + elem.name, key: key, elem: elem, nillable: canBeNil}
+	case *ast.InterfaceType, *ast.FuncType, *ast.ChanType:
+		return &goType{nillable: canBeNil}
+	}
+	return &goType{}
+}
+
+// syrupName returns the name the file imports package syrup as.
+func syrupName(f *ast.File) string {
+	for _, imp := range f.Imports {
+		if path, _ := strconv.Unquote(imp.Path.Value); path != syrupPath {
+			continue
+		} else if imp.Name != nil {
+			return imp.Name.Name
+		}
+		return "syrup"
+	}
+	return ""
+}
+
+// namedType determines how a named type of the package is encoded.
+func (g *generator) namedType(name string) *goType {
+	if t, ok := g.named[name]; ok {
+		if t == nil {
+			// A type defined in terms of itself.
+			return &goType{nillable: unknownNil}
+		}
+		return t
+	}
+	g.named[name] = nil
+	ts := g.types[name]
+	var t *goType
+	if g.annotated[name] {
+		t = &goType{kind: methodKind, name: name, marshal: true, unmarshal: true}
+	} else if u := g.typeOf(ts.Type, g.files[name]); ts.Assign.IsValid() {
+		t = u
+	} else if m := g.methods[name]; m["MarshalSyrup"] || m["UnmarshalSyrup"] {
+		t = &goType{kind: methodKind, name: name, marshal: m["MarshalSyrup"], unmarshal: m["UnmarshalSyrup"], nillable: u.nillable}
+	} else {
+		switch u.kind {
+		case boolKind, floatKind, stringKind:
+			t = &goType{kind: u.kind, name: name, conv: true, bits: u.bits}
+		case intKind, uintKind:
+			// The type may have symbols registered by RegisterEnum,
+			// which only Encode and Decode know of.
+			t = &goType{}
+		case symbolKind:
+			// Only syrup.Symbol itself is encoded as a symbol.
+			t = &goType{kind: stringKind, name: name, conv: true}
+		default:
+			t = &goType{nillable: u.nillable}
+		}
+	}
+	g.named[name] = t
+	return t
+}
+
+// dict writes the methods of a struct encoded as a dictionary.
+func (g *generator) dict(name string, fields []field) {
+	g.vars = 0
+	g.printf("// MarshalSyrup implements syrup.Marshaler.\n")
+	g.printf("func (x %s) MarshalSyrup(e *syrup.Encoder) error {\n", name)
+	g.check("e.EncodeToken(syrup.DictStart)")
+	for _, f := range fields {
+		v := "x." + f.goName
+		cond := encodeCond(v, f)
+		if cond != "" {
+			g.printf("if %s {\n", cond)
+		}
+		if f.symbol {
+			g.check("e.EncodeSymbol(%q)", f.name)
+		} else {
+			g.check("e.EncodeString(%q)", f.name)
+		}
+		if f.optional && f.t.nillable == canBeNil {
+			// The condition has already ruled out nil.
+			g.encodeNonNil(v, f.t)
+		} else {
+			g.encode(v, f.t)
+		}
+		if cond != "" {
+			g.printf("}\n")
+		}
+	}
+	g.printf("return e.EncodeToken(syrup.DictEnd)\n}\n\n")
+
+	g.vars = 0
+	g.printf("// UnmarshalSyrup implements syrup.Unmarshaler.\n")
+	g.printf("func (x *%s) UnmarshalSyrup(d *syrup.Decoder) error {\n", name)
+	g.start("syrup.DictStart", "", name)
+	g.printf("for {\n")
+	g.more("break")
+	g.printf("name, err := d.DecodeKey()\nif err != nil {\nreturn err\n}\n")
+	g.printf("switch name {\n")
+	for _, f := range fields {
+		g.printf("case %q:\n", f.name)
+		g.decode("x."+f.goName, f.t)
+	}
+	g.printf("default:\n")
+	g.check("d.Skip()")
+	g.printf("}\n}\n_, err := d.Token()\nreturn err\n}\n\n")
+}
+
+// record writes the methods of a struct encoded as a record.
+func (g *generator) record(name string, fields []field) {
+	g.vars = 0
+	g.printf("// MarshalSyrup implements syrup.Marshaler.\n")
+	g.printf("func (x %s) MarshalSyrup(e *syrup.Encoder) error {\n", name)
+	g.check("e.EncodeToken(syrup.RecordStart)")
+	g.check("e.EncodeSymbol(x.SyrupLabel())")
+	for _, f := range fields {
+		g.encode("x."+f.goName, f.t)
+	}
+	g.printf("return e.EncodeToken(syrup.RecordEnd)\n}\n\n")
+
+	g.vars = 0
+	arity := fmt.Sprintf("fmt.Errorf(\"syrup: record does not hold %d values for Go value of type %s\")", len(fields), name)
+	g.printf("// UnmarshalSyrup implements syrup.Unmarshaler.\n")
+	g.printf("func (x *%s) UnmarshalSyrup(d *syrup.Decoder) error {\n", name)
+	g.start("syrup.RecordStart", "", name)
+	g.printf("if label, err := d.Token(); err != nil {\nreturn err\n} else if label != x.SyrupLabel() {\n")
+	g.printf("return fmt.Errorf(\"syrup: cannot decode record labeled %%v into Go value of type %s\", label)\n}\n", name)
+	for _, f := range fields {
+		g.more("return " + arity)
+		g.decode("x."+f.goName, f.t)
+	}
+	g.printf("if t, err := d.Token(); err != nil {\nreturn err\n} else if t != syrup.RecordEnd {\nreturn %s\n}\n", arity)
+	g.printf("return nil\n}\n\n")
+}
+
+// encodeCond returns the condition for encoding a dictionary field, which is
+// empty when it is always encoded.
+func encodeCond(v string, f field) string {
+	nonZero := nonZeroCond(v, f.t)
+	switch {
+	case f.t.nillable == unknownNil, f.optional && nonZero == "":
+		return fmt.Sprintf("!e.OmitField(&%s, %t)", v, f.optional)
+	case f.optional:
+		return nonZero
+	case f.t.nillable == canBeNil:
+		return fmt.Sprintf("e.NilPolicy() != syrup.NilOmitted || %s != nil", v)
+	}
+	return ""
+}
+
+// nonZeroCond returns the condition for v not being its zero value, which is
+// empty when it cannot be determined.
+func nonZeroCond(v string, t *goType) string {
+	switch t.kind {
+	case boolKind:
+		return v
+	case intKind, uintKind, floatKind:
+		return v + " != 0"
+	case stringKind, symbolKind:
+		return v + ` != ""`
+	}
+	if t.nillable == canBeNil {
+		return v + " != nil"
+	}
+	return ""
+}
+
+// paren parenthesizes a dereference to be indexed or have methods called.
+func paren(v string) string {
+	if strings.HasPrefix(v, "*") {
+		return "(" + v + ")"
+	}
+	return v
+}
+
+// convert converts v to the type to, unless it already is of that type.
+func convert(to, v string, t *goType) string {
+	if t.name == to {
+		return v
+	}
+	return to + "(" + v + ")"
+}
+
+// encode writes the encoding of the value v.
+func (g *generator) encode(v string, t *goType) {
+	switch t.kind {
+	case ptrKind, sliceKind, mapKind:
+		g.printf("if %s == nil {\n", v)
+		g.check("e.Encode(%s)", v)
+		g.printf("} else {\n")
+		g.encodeNonNil(v, t)
+		g.printf("}\n")
+	default:
+		g.encodeNonNil(v, t)
+	}
+}
+
+// encodeNonNil writes the encoding of the value v, which is known not to be a
+// nil pointer, slice, or map.
+func (g *generator) encodeNonNil(v string, t *goType) {
+	switch t.kind {
+	case boolKind:
+		g.check("e.EncodeBool(%s)", convert("bool", v, t))
+	case intKind:
+		g.check("e.EncodeInt(%s)", convert("int64", v, t))
+	case uintKind:
+		g.check("e.EncodeUint(%s)", convert("uint64", v, t))
+	case floatKind:
+		if t.bits == 32 {
+			g.check("e.EncodeFloat32(%s)", convert("float32", v, t))
+		} else {
+			g.check("e.EncodeFloat64(%s)", convert("float64", v, t))
+		}
+	case stringKind:
+		g.check("e.EncodeString(%s)", convert("string", v, t))
+	case bytesKind:
+		g.check("e.EncodeBytes(%s)", v)
+	case symbolKind:
+		g.check("e.EncodeSymbol(%s)", v)
+	case methodKind:
+		if !t.marshal {
+			g.check("e.Encode(%s)", v)
+			break
+		}
+		g.check("%s.MarshalSyrup(e)", paren(v))
+	case ptrKind:
+		g.encode("*"+v, t.elem)
+	case sliceKind:
+		elem := g.newVar("v")
+		g.check("e.EncodeToken(syrup.ListStart)")
+		g.printf("for _, %s := range %s {\n", elem, v)
+		g.encode(elem, t.elem)
+		g.printf("}\n")
+		g.check("e.EncodeToken(syrup.ListEnd)")
+	case mapKind:
+		key, elem := g.newVar("k"), g.newVar("v")
+		g.check("e.EncodeToken(syrup.DictStart)")
+		g.printf("for %s, %s := range %s {\n", key, elem, v)
+		switch t.elem.nillable {
+		case canBeNil:
+			g.printf("if e.NilPolicy() == syrup.NilOmitted && %s == nil {\ncontinue\n}\n", elem)
+		case unknownNil:
+			g.printf("if e.OmitField(&%s, false) {\ncontinue\n}\n", elem)
+		}
+		g.encode(key, t.key)
+		g.encode(elem, t.elem)
+		g.printf("}\n")
+		g.check("e.EncodeToken(syrup.DictEnd)")
+	default:
+		g.check("e.Encode(%s)", v)
+	}
+}
+
+// start writes the reading of the Delim beginning a compound value, or of
+// either of two.
+func (g *generator) start(delim, or, typ string) {
+	cond := "t != " + delim
+	if or != "" {
+		cond += " && t != " + or
+	}
+	g.printf("if t, err := d.Token(); err != nil {\nreturn err\n} else if %s {\n", cond)
+	g.printf("return fmt.Errorf(\"syrup: cannot decode %%v into Go value of type %s\", t)\n}\n", typ)
+}
+
+// more writes the check for another element of a compound value, running
+// done when there is none.
+func (g *generator) more(done string) {
+	g.printf("if more, err := d.More(); err != nil {\nreturn err\n} else if !more {\n%s\n}\n", done)
+}
+
+// assign writes the decoding of a scalar into dst.
+func (g *generator) assign(dst, call, from string, t *goType) {
+	v := g.newVar("v")
+	g.printf("if %s, err := %s; err != nil {\nreturn err\n} else {\n", v, call)
+	if t.name == from {
+		g.printf("%s = %s\n}\n", dst, v)
+	} else {
+		g.printf("%s = %s(%s)\n}\n", dst, t.name, v)
+	}
+}
+
+// decode writes the decoding of a value into the addressable dst.
+func (g *generator) decode(dst string, t *goType) {
+	if t.nillable == canBeNil && t.kind != otherKind && t.kind != methodKind {
+		// A nil sentinel may stand in for the value.
+		g.printf("if d.NilSentinel() != nil {\n")
+		g.decodeOther(dst)
+		g.printf("} else {\n")
+		defer g.printf("}\n")
+	}
+	switch t.kind {
+	case boolKind:
+		g.assign(dst, "d.DecodeBool()", "bool", t)
+	case intKind:
+		g.assign(dst, fmt.Sprintf("d.DecodeInt(%d)", t.bits), "int64", t)
+	case uintKind:
+		g.assign(dst, fmt.Sprintf("d.DecodeUint(%d)", t.bits), "uint64", t)
+	case floatKind:
+		g.assign(dst, fmt.Sprintf("d.DecodeFloat(%d)", t.bits), "float64", t)
+	case stringKind:
+		g.assign(dst, "d.DecodeString()", "string", t)
+	case bytesKind:
+		g.assign(dst, "d.DecodeBytes()", "[]byte", t)
+	case symbolKind:
+		g.assign(dst, "d.DecodeSymbol()", "syrup.Symbol", t)
+	case methodKind:
+		if !t.unmarshal {
+			g.decodeOther(dst)
+			break
+		}
+		g.check("%s.UnmarshalSyrup(d)", paren(dst))
+	case ptrKind:
+		g.printf("if %s == nil {\n%s = new(%s)\n}\n", dst, dst, t.elem.name)
+		g.decode("*"+dst, t.elem)
+	case sliceKind:
+		// Elements are decoded into those of the slice already held, as
+		// Decode does.
+		n, zero := g.newVar("n"), g.newVar("zero")
+		g.start("syrup.ListStart", "syrup.SetStart", t.name)
+		g.printf("%s := 0\nvar %s %s\nfor {\n", n, zero, t.elem.name)
+		g.more("break")
+		g.printf("if %s < cap(%s) {\n%s = %s[:%s+1]\n} else {\n", n, dst, dst, paren(dst), n)
+		g.printf("%s = append(%s[:%s], %s)\n}\n", dst, paren(dst), n, zero)
+		g.decode(fmt.Sprintf("%s[%s]", paren(dst), n), t.elem)
+		g.printf("%s++\n}\n", n)
+		g.printf("if _, err := d.Token(); err != nil {\nreturn err\n}\n")
+		g.printf("if %s == 0 {\n%s = make(%s, 0)\n} else {\n%s = %s[:%s]\n}\n", n, dst, t.name, dst, paren(dst), n)
+	case mapKind:
+		key, elem := g.newVar("k"), g.newVar("v")
+		g.printf("if %s == nil {\n%s = make(%s)\n}\n", dst, dst, t.name)
+		g.start("syrup.DictStart", "", t.name)
+		g.printf("for {\n")
+		g.more("break")
+		g.printf("var %s %s\n", key, t.key.name)
+		g.decode(key, t.key)
+		g.printf("var %s %s\n", elem, t.elem.name)
+		g.decode(elem, t.elem)
+		g.printf("%s[%s] = %s\n}\n", paren(dst), key, elem)
+		g.printf("if _, err := d.Token(); err != nil {\nreturn err\n}\n")
+	default:
+		g.decodeOther(dst)
+	}
+}
+
+func (g *generator) decodeOther(dst string) {
+	if strings.HasPrefix(dst, "*") {
+		g.check("d.Decode(%s)", dst[1:])
+	} else {
+		g.check("d.Decode(&%s)", dst)
+	}
+}
@@ -0,0 +1,6 @@
+// Package example holds types with methods generated by syrup-marshalgen,
+// which are tested to encode and decode as the Encoder and Decoder do without
+// the methods.
+package example
+
+//go:generate go run github.com/cjslep/syrup/cmd/syrup-marshalgen
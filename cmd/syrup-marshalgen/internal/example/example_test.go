@@ -0,0 +1,224 @@
+package example
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/cjslep/syrup"
+	"github.com/cjslep/syrup/schema"
+)
+
+// The plain types share the fields of the generated types but not their
+// methods, so they are encoded and decoded by reflection.
+type (
+	plainMessage Message
+	plainPerson  Person
+	plainPoint   Point
+)
+
+func (plainPoint) SyrupLabel() syrup.Symbol { return "point" }
+
+func float32p(f float32) *float32 { return &f }
+
+func messages() []Message {
+	full := Message{
+		ID: 1 << 40,
+		From: Person{
+			Name:     "alice",
+			Age:      -3,
+			Tags:     []syrup.Symbol{"a", "b"},
+			Location: Point{X: 1, Y: -2, Z: float32p(0.5)},
+		},
+		To:       []*Person{{Name: "bob", Tags: []syrup.Symbol{}, Location: Point{Z: float32p(1)}}},
+		Subject:  "hi",
+		Body:     []byte{0, 1},
+		Kind:     7,
+		Priority: High,
+		Name:     "named",
+		Flags:    map[string]bool{"seen": true},
+		Scores:   map[syrup.Symbol][]float32{"x": {1, 2}},
+		Reply:    &Message{Loud: "again", Scores: map[syrup.Symbol][]float32{}, To: []*Person{}, From: Person{Tags: []syrup.Symbol{}, Location: Point{Z: float32p(2)}}},
+		Loud:     "quiet",
+		Extra:    syrup.NewList(syrup.NewInt(1)),
+		Big:      new(big.Int).Lsh(big.NewInt(1), 70),
+		Any:      "anything",
+		Skipped:  "skipped",
+	}
+	return []Message{
+		full,
+		// Nil fields are omitted when optional, and otherwise subject to
+		// the nil policy.
+		{Loud: "nil", From: Person{Location: Point{Z: float32p(3)}}},
+		{To: []*Person{nil}, From: Person{Tags: []syrup.Symbol{}, Location: Point{Z: float32p(3)}}, Scores: map[syrup.Symbol][]float32{"n": nil}},
+		{From: Person{Tags: []syrup.Symbol{}}, To: []*Person{}, Scores: map[syrup.Symbol][]float32{}},
+	}
+}
+
+func encode(enc *syrup.Encoding, canonical bool, policy syrup.NilPolicy, v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	e := syrup.NewEncoder(enc, &buf)
+	e.SetCanonical(canonical)
+	e.SetNilPolicy(policy)
+	err := e.Encode(v)
+	return buf.Bytes(), err
+}
+
+func TestEncodeMatchesReflection(t *testing.T) {
+	for _, enc := range []*syrup.Encoding{syrup.NewPrototypeEncoding(), syrup.NewPreservesEncoding()} {
+		for _, policy := range []syrup.NilPolicy{syrup.NilIsError, syrup.NilAsEmpty, syrup.NilOmitted, syrup.NilAsSentinel} {
+			var values [][2]interface{}
+			for _, m := range messages() {
+				values = append(values,
+					[2]interface{}{m, plainMessage(m)},
+					[2]interface{}{m.From, plainPerson(m.From)},
+					[2]interface{}{m.From.Location, plainPoint(m.From.Location)},
+				)
+			}
+			for i, v := range values {
+				for _, canonical := range []bool{true, false} {
+					got, gotErr := encode(enc, canonical, policy, v[0])
+					want, wantErr := encode(enc, canonical, policy, v[1])
+					if (gotErr != nil) != (wantErr != nil) {
+						t.Fatalf("value %d, policy %d: got error %v, want %v", i, policy, gotErr, wantErr)
+					} else if gotErr == nil && !bytes.Equal(got, want) {
+						t.Errorf("value %d, policy %d, canonical %v:\ngot  %q\nwant %q", i, policy, canonical, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeMatchesReflection(t *testing.T) {
+	for i, m := range messages() {
+		b, err := encode(syrup.NewPrototypeEncoding(), true, syrup.NilAsSentinel, m)
+		if err != nil {
+			t.Fatalf("message %d: got error %v", i, err)
+		}
+		for _, sentinel := range []bool{false, true} {
+			var got Message
+			var want plainMessage
+			var errs []error
+			for _, v := range []interface{}{&got, &want} {
+				d := syrup.NewDecoder(syrup.NewPrototypeEncoding(), bytes.NewReader(b))
+				if sentinel {
+					d.SetNilSentinel(syrup.DefaultNilSentinel())
+				}
+				errs = append(errs, d.Decode(v))
+			}
+			// The messages after the first hold nils, whose sentinels
+			// are decoded as records without a sentinel.
+			wantErr := !sentinel && i > 0
+			if (errs[0] != nil) != wantErr || (errs[1] != nil) != wantErr {
+				t.Fatalf("message %d, sentinel %v: got errors %v and %v", i, sentinel, errs[0], errs[1])
+			} else if wantErr {
+				continue
+			}
+			if !reflect.DeepEqual(got, Message(want)) {
+				t.Errorf("message %d, sentinel %v:\ngot  %+v\nwant %+v", i, sentinel, got, Message(want))
+			}
+			// The sentinel standing for the nil *Person of the third
+			// is not given to Person.UnmarshalSyrup.
+			if i == 2 && (len(got.To) != 1 || got.To[0] != nil) {
+				t.Errorf("message %d: got To %v, want [nil]", i, got.To)
+			}
+		}
+	}
+}
+
+func TestDecodeRecord(t *testing.T) {
+	for _, in := range []string{"<5'pointD?\xf0\x00\x00\x00\x00\x00\x00D@\x00\x00\x00\x00\x00\x00\x00F?\x00\x00\x00>"} {
+		var got Point
+		var want plainPoint
+		for _, v := range []interface{}{&got, &want} {
+			if err := syrup.NewDecoder(syrup.NewPrototypeEncoding(), bytes.NewBufferString(in)).Decode(v); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+		}
+		if !reflect.DeepEqual(got, Point(want)) {
+			t.Errorf("got %+v, want %+v", got, Point(want))
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   string
+		v    interface{}
+	}{
+		{"dictionary expected", "[]", new(Person)},
+		{"record expected", "{}", new(Point)},
+		{"wrong label", "<4'lineD?\xf0\x00\x00\x00\x00\x00\x00D?\xf0\x00\x00\x00\x00\x00\x00F?\x00\x00\x00>", new(Point)},
+		{"too few values", "<5'pointD?\xf0\x00\x00\x00\x00\x00\x00>", new(Point)},
+		{"too many values", "<5'pointD?\xf0\x00\x00\x00\x00\x00\x00D?\xf0\x00\x00\x00\x00\x00\x00F?\x00\x00\x00i1e>", new(Point)},
+		{"wrong field type", "{3\"Agei1000e}", new(Person)},
+		{"list expected", "{4\"Tags3'tag}", new(Person)},
+		{"truncated", "{4\"Name", new(Person)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := syrup.NewDecoder(syrup.NewPrototypeEncoding(), bytes.NewBufferString(test.in)).Decode(test.v); err == nil {
+				t.Errorf("got %+v, want an error", test.v)
+			}
+		})
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	p := messages()[0].From
+	for _, bench := range []struct {
+		name string
+		v    interface{}
+	}{{"Generated", p}, {"Reflection", plainPerson(p)}} {
+		b.Run(bench.name, func(b *testing.B) {
+			e := syrup.NewEncoder(syrup.NewPrototypeEncoding(), ioutil.Discard)
+			for i := 0; i < b.N; i++ {
+				if err := e.Encode(bench.v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	in, err := encode(syrup.NewPrototypeEncoding(), false, syrup.NilIsError, messages()[0].From)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bench := range []struct {
+		name string
+		v    interface{}
+	}{{"Generated", new(Person)}, {"Reflection", new(plainPerson)}} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := syrup.NewDecoder(syrup.NewPrototypeEncoding(), bytes.NewReader(in)).Decode(bench.v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestReflectSchema(t *testing.T) {
+	s, err := schema.Reflect(Message{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `Message = {id: int "from": Person "to": [Person ...] "subject"?: string "body"?: bytes "kind": int "priority": Priority "Name": string "flags"?: {string: bool ...:...} "Scores": {symbol: [float ...] ...:...} "reply"?: Message "Loud": any "extra"?: any "big"?: int "any"?: any} .
+Person = {"Name": string "Age": int "Tags": [symbol ...] "Location": Point} .
+Point = <point @X double @Y double @Z float> .
+Priority = =low / =high .
+`
+	if got := s.String(); got != expect {
+		t.Errorf("got\n%s\nwant\n%s", got, expect)
+	}
+	// The schema describes values encoded with the NilIsError policy, which
+	// only the first message can be.
+	if err := s.Validate("Message", messages()[0]); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
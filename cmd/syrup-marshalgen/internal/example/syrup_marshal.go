@@ -0,0 +1,663 @@
+// Code generated by syrup-marshalgen. DO NOT EDIT.
+
+package example
+
+import (
+	"fmt"
+
+	"github.com/cjslep/syrup"
+)
+
+// MarshalSyrup implements syrup.Marshaler.
+func (x Message) MarshalSyrup(e *syrup.Encoder) error {
+	if err := e.EncodeToken(syrup.DictStart); err != nil {
+		return err
+	}
+	if err := e.EncodeSymbol("id"); err != nil {
+		return err
+	}
+	if err := e.EncodeUint(x.ID); err != nil {
+		return err
+	}
+	if err := e.EncodeString("from"); err != nil {
+		return err
+	}
+	if err := x.From.MarshalSyrup(e); err != nil {
+		return err
+	}
+	if e.NilPolicy() != syrup.NilOmitted || x.To != nil {
+		if err := e.EncodeString("to"); err != nil {
+			return err
+		}
+		if x.To == nil {
+			if err := e.Encode(x.To); err != nil {
+				return err
+			}
+		} else {
+			if err := e.EncodeToken(syrup.ListStart); err != nil {
+				return err
+			}
+			for _, v1 := range x.To {
+				if v1 == nil {
+					if err := e.Encode(v1); err != nil {
+						return err
+					}
+				} else {
+					if err := (*v1).MarshalSyrup(e); err != nil {
+						return err
+					}
+				}
+			}
+			if err := e.EncodeToken(syrup.ListEnd); err != nil {
+				return err
+			}
+		}
+	}
+	if x.Subject != "" {
+		if err := e.EncodeString("subject"); err != nil {
+			return err
+		}
+		if err := e.EncodeString(x.Subject); err != nil {
+			return err
+		}
+	}
+	if x.Body != nil {
+		if err := e.EncodeString("body"); err != nil {
+			return err
+		}
+		if err := e.EncodeBytes(x.Body); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeString("kind"); err != nil {
+		return err
+	}
+	if err := e.Encode(x.Kind); err != nil {
+		return err
+	}
+	if err := e.EncodeString("priority"); err != nil {
+		return err
+	}
+	if err := e.Encode(x.Priority); err != nil {
+		return err
+	}
+	if err := e.EncodeString("Name"); err != nil {
+		return err
+	}
+	if err := e.EncodeString(string(x.Name)); err != nil {
+		return err
+	}
+	if x.Flags != nil {
+		if err := e.EncodeString("flags"); err != nil {
+			return err
+		}
+		if err := e.EncodeToken(syrup.DictStart); err != nil {
+			return err
+		}
+		for k2, v3 := range x.Flags {
+			if err := e.EncodeString(k2); err != nil {
+				return err
+			}
+			if err := e.EncodeBool(v3); err != nil {
+				return err
+			}
+		}
+		if err := e.EncodeToken(syrup.DictEnd); err != nil {
+			return err
+		}
+	}
+	if e.NilPolicy() != syrup.NilOmitted || x.Scores != nil {
+		if err := e.EncodeString("Scores"); err != nil {
+			return err
+		}
+		if x.Scores == nil {
+			if err := e.Encode(x.Scores); err != nil {
+				return err
+			}
+		} else {
+			if err := e.EncodeToken(syrup.DictStart); err != nil {
+				return err
+			}
+			for k4, v5 := range x.Scores {
+				if e.NilPolicy() == syrup.NilOmitted && v5 == nil {
+					continue
+				}
+				if err := e.EncodeSymbol(k4); err != nil {
+					return err
+				}
+				if v5 == nil {
+					if err := e.Encode(v5); err != nil {
+						return err
+					}
+				} else {
+					if err := e.EncodeToken(syrup.ListStart); err != nil {
+						return err
+					}
+					for _, v6 := range v5 {
+						if err := e.EncodeFloat32(v6); err != nil {
+							return err
+						}
+					}
+					if err := e.EncodeToken(syrup.ListEnd); err != nil {
+						return err
+					}
+				}
+			}
+			if err := e.EncodeToken(syrup.DictEnd); err != nil {
+				return err
+			}
+		}
+	}
+	if x.Reply != nil {
+		if err := e.EncodeString("reply"); err != nil {
+			return err
+		}
+		if err := (*x.Reply).MarshalSyrup(e); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeString("Loud"); err != nil {
+		return err
+	}
+	if err := x.Loud.MarshalSyrup(e); err != nil {
+		return err
+	}
+	if !e.OmitField(&x.Extra, true) {
+		if err := e.EncodeString("extra"); err != nil {
+			return err
+		}
+		if err := e.Encode(x.Extra); err != nil {
+			return err
+		}
+	}
+	if x.Big != nil {
+		if err := e.EncodeString("big"); err != nil {
+			return err
+		}
+		if err := e.Encode(x.Big); err != nil {
+			return err
+		}
+	}
+	if x.Any != nil {
+		if err := e.EncodeString("any"); err != nil {
+			return err
+		}
+		if err := e.Encode(x.Any); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(syrup.DictEnd)
+}
+
+// UnmarshalSyrup implements syrup.Unmarshaler.
+func (x *Message) UnmarshalSyrup(d *syrup.Decoder) error {
+	if t, err := d.Token(); err != nil {
+		return err
+	} else if t != syrup.DictStart {
+		return fmt.Errorf("syrup: cannot decode %v into Go value of type Message", t)
+	}
+	for {
+		if more, err := d.More(); err != nil {
+			return err
+		} else if !more {
+			break
+		}
+		name, err := d.DecodeKey()
+		if err != nil {
+			return err
+		}
+		switch name {
+		case "id":
+			if v1, err := d.DecodeUint(64); err != nil {
+				return err
+			} else {
+				x.ID = v1
+			}
+		case "from":
+			if err := x.From.UnmarshalSyrup(d); err != nil {
+				return err
+			}
+		case "to":
+			if d.NilSentinel() != nil {
+				if err := d.Decode(&x.To); err != nil {
+					return err
+				}
+			} else {
+				if t, err := d.Token(); err != nil {
+					return err
+				} else if t != syrup.ListStart && t != syrup.SetStart {
+					return fmt.Errorf("syrup: cannot decode %v into Go value of type []*Person", t)
+				}
+				n2 := 0
+				var zero3 *Person
+				for {
+					if more, err := d.More(); err != nil {
+						return err
+					} else if !more {
+						break
+					}
+					if n2 < cap(x.To) {
+						x.To = x.To[:n2+1]
+					} else {
+						x.To = append(x.To[:n2], zero3)
+					}
+					if d.NilSentinel() != nil {
+						if err := d.Decode(&x.To[n2]); err != nil {
+							return err
+						}
+					} else {
+						if x.To[n2] == nil {
+							x.To[n2] = new(Person)
+						}
+						if err := (*x.To[n2]).UnmarshalSyrup(d); err != nil {
+							return err
+						}
+					}
+					n2++
+				}
+				if _, err := d.Token(); err != nil {
+					return err
+				}
+				if n2 == 0 {
+					x.To = make([]*Person, 0)
+				} else {
+					x.To = x.To[:n2]
+				}
+			}
+		case "subject":
+			if v4, err := d.DecodeString(); err != nil {
+				return err
+			} else {
+				x.Subject = v4
+			}
+		case "body":
+			if d.NilSentinel() != nil {
+				if err := d.Decode(&x.Body); err != nil {
+					return err
+				}
+			} else {
+				if v5, err := d.DecodeBytes(); err != nil {
+					return err
+				} else {
+					x.Body = v5
+				}
+			}
+		case "kind":
+			if err := d.Decode(&x.Kind); err != nil {
+				return err
+			}
+		case "priority":
+			if err := d.Decode(&x.Priority); err != nil {
+				return err
+			}
+		case "Name":
+			if v6, err := d.DecodeString(); err != nil {
+				return err
+			} else {
+				x.Name = Name(v6)
+			}
+		case "flags":
+			if d.NilSentinel() != nil {
+				if err := d.Decode(&x.Flags); err != nil {
+					return err
+				}
+			} else {
+				if x.Flags == nil {
+					x.Flags = make(map[string]bool)
+				}
+				if t, err := d.Token(); err != nil {
+					return err
+				} else if t != syrup.DictStart {
+					return fmt.Errorf("syrup: cannot decode %v into Go value of type map[string]bool", t)
+				}
+				for {
+					if more, err := d.More(); err != nil {
+						return err
+					} else if !more {
+						break
+					}
+					var k7 string
+					if v9, err := d.DecodeString(); err != nil {
+						return err
+					} else {
+						k7 = v9
+					}
+					var v8 bool
+					if v10, err := d.DecodeBool(); err != nil {
+						return err
+					} else {
+						v8 = v10
+					}
+					x.Flags[k7] = v8
+				}
+				if _, err := d.Token(); err != nil {
+					return err
+				}
+			}
+		case "Scores":
+			if d.NilSentinel() != nil {
+				if err := d.Decode(&x.Scores); err != nil {
+					return err
+				}
+			} else {
+				if x.Scores == nil {
+					x.Scores = make(map[syrup.Symbol][]float32)
+				}
+				if t, err := d.Token(); err != nil {
+					return err
+				} else if t != syrup.DictStart {
+					return fmt.Errorf("syrup: cannot decode %v into Go value of type map[syrup.Symbol][]float32", t)
+				}
+				for {
+					if more, err := d.More(); err != nil {
+						return err
+					} else if !more {
+						break
+					}
+					var k11 syrup.Symbol
+					if v13, err := d.DecodeSymbol(); err != nil {
+						return err
+					} else {
+						k11 = v13
+					}
+					var v12 []float32
+					if d.NilSentinel() != nil {
+						if err := d.Decode(&v12); err != nil {
+							return err
+						}
+					} else {
+						if t, err := d.Token(); err != nil {
+							return err
+						} else if t != syrup.ListStart && t != syrup.SetStart {
+							return fmt.Errorf("syrup: cannot decode %v into Go value of type []float32", t)
+						}
+						n14 := 0
+						var zero15 float32
+						for {
+							if more, err := d.More(); err != nil {
+								return err
+							} else if !more {
+								break
+							}
+							if n14 < cap(v12) {
+								v12 = v12[:n14+1]
+							} else {
+								v12 = append(v12[:n14], zero15)
+							}
+							if v16, err := d.DecodeFloat(32); err != nil {
+								return err
+							} else {
+								v12[n14] = float32(v16)
+							}
+							n14++
+						}
+						if _, err := d.Token(); err != nil {
+							return err
+						}
+						if n14 == 0 {
+							v12 = make([]float32, 0)
+						} else {
+							v12 = v12[:n14]
+						}
+					}
+					x.Scores[k11] = v12
+				}
+				if _, err := d.Token(); err != nil {
+					return err
+				}
+			}
+		case "reply":
+			if d.NilSentinel() != nil {
+				if err := d.Decode(&x.Reply); err != nil {
+					return err
+				}
+			} else {
+				if x.Reply == nil {
+					x.Reply = new(Message)
+				}
+				if err := (*x.Reply).UnmarshalSyrup(d); err != nil {
+					return err
+				}
+			}
+		case "Loud":
+			if err := x.Loud.UnmarshalSyrup(d); err != nil {
+				return err
+			}
+		case "extra":
+			if err := d.Decode(&x.Extra); err != nil {
+				return err
+			}
+		case "big":
+			if err := d.Decode(&x.Big); err != nil {
+				return err
+			}
+		case "any":
+			if err := d.Decode(&x.Any); err != nil {
+				return err
+			}
+		default:
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := d.Token()
+	return err
+}
+
+// MarshalSyrup implements syrup.Marshaler.
+func (x Person) MarshalSyrup(e *syrup.Encoder) error {
+	if err := e.EncodeToken(syrup.DictStart); err != nil {
+		return err
+	}
+	if err := e.EncodeString("Name"); err != nil {
+		return err
+	}
+	if err := e.EncodeString(x.Name); err != nil {
+		return err
+	}
+	if err := e.EncodeString("Age"); err != nil {
+		return err
+	}
+	if err := e.EncodeInt(int64(x.Age)); err != nil {
+		return err
+	}
+	if e.NilPolicy() != syrup.NilOmitted || x.Tags != nil {
+		if err := e.EncodeString("Tags"); err != nil {
+			return err
+		}
+		if x.Tags == nil {
+			if err := e.Encode(x.Tags); err != nil {
+				return err
+			}
+		} else {
+			if err := e.EncodeToken(syrup.ListStart); err != nil {
+				return err
+			}
+			for _, v1 := range x.Tags {
+				if err := e.EncodeSymbol(v1); err != nil {
+					return err
+				}
+			}
+			if err := e.EncodeToken(syrup.ListEnd); err != nil {
+				return err
+			}
+		}
+	}
+	if err := e.EncodeString("Location"); err != nil {
+		return err
+	}
+	if err := x.Location.MarshalSyrup(e); err != nil {
+		return err
+	}
+	return e.EncodeToken(syrup.DictEnd)
+}
+
+// UnmarshalSyrup implements syrup.Unmarshaler.
+func (x *Person) UnmarshalSyrup(d *syrup.Decoder) error {
+	if t, err := d.Token(); err != nil {
+		return err
+	} else if t != syrup.DictStart {
+		return fmt.Errorf("syrup: cannot decode %v into Go value of type Person", t)
+	}
+	for {
+		if more, err := d.More(); err != nil {
+			return err
+		} else if !more {
+			break
+		}
+		name, err := d.DecodeKey()
+		if err != nil {
+			return err
+		}
+		switch name {
+		case "Name":
+			if v1, err := d.DecodeString(); err != nil {
+				return err
+			} else {
+				x.Name = v1
+			}
+		case "Age":
+			if v2, err := d.DecodeInt(8); err != nil {
+				return err
+			} else {
+				x.Age = int8(v2)
+			}
+		case "Tags":
+			if d.NilSentinel() != nil {
+				if err := d.Decode(&x.Tags); err != nil {
+					return err
+				}
+			} else {
+				if t, err := d.Token(); err != nil {
+					return err
+				} else if t != syrup.ListStart && t != syrup.SetStart {
+					return fmt.Errorf("syrup: cannot decode %v into Go value of type []syrup.Symbol", t)
+				}
+				n3 := 0
+				var zero4 syrup.Symbol
+				for {
+					if more, err := d.More(); err != nil {
+						return err
+					} else if !more {
+						break
+					}
+					if n3 < cap(x.Tags) {
+						x.Tags = x.Tags[:n3+1]
+					} else {
+						x.Tags = append(x.Tags[:n3], zero4)
+					}
+					if v5, err := d.DecodeSymbol(); err != nil {
+						return err
+					} else {
+						x.Tags[n3] = v5
+					}
+					n3++
+				}
+				if _, err := d.Token(); err != nil {
+					return err
+				}
+				if n3 == 0 {
+					x.Tags = make([]syrup.Symbol, 0)
+				} else {
+					x.Tags = x.Tags[:n3]
+				}
+			}
+		case "Location":
+			if err := x.Location.UnmarshalSyrup(d); err != nil {
+				return err
+			}
+		default:
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := d.Token()
+	return err
+}
+
+// MarshalSyrup implements syrup.Marshaler.
+func (x Point) MarshalSyrup(e *syrup.Encoder) error {
+	if err := e.EncodeToken(syrup.RecordStart); err != nil {
+		return err
+	}
+	if err := e.EncodeSymbol(x.SyrupLabel()); err != nil {
+		return err
+	}
+	if err := e.EncodeFloat64(x.X); err != nil {
+		return err
+	}
+	if err := e.EncodeFloat64(x.Y); err != nil {
+		return err
+	}
+	if x.Z == nil {
+		if err := e.Encode(x.Z); err != nil {
+			return err
+		}
+	} else {
+		if err := e.EncodeFloat32(*x.Z); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(syrup.RecordEnd)
+}
+
+// UnmarshalSyrup implements syrup.Unmarshaler.
+func (x *Point) UnmarshalSyrup(d *syrup.Decoder) error {
+	if t, err := d.Token(); err != nil {
+		return err
+	} else if t != syrup.RecordStart {
+		return fmt.Errorf("syrup: cannot decode %v into Go value of type Point", t)
+	}
+	if label, err := d.Token(); err != nil {
+		return err
+	} else if label != x.SyrupLabel() {
+		return fmt.Errorf("syrup: cannot decode record labeled %v into Go value of type Point", label)
+	}
+	if more, err := d.More(); err != nil {
+		return err
+	} else if !more {
+		return fmt.Errorf("syrup: record does not hold 3 values for Go value of type Point")
+	}
+	if v1, err := d.DecodeFloat(64); err != nil {
+		return err
+	} else {
+		x.X = v1
+	}
+	if more, err := d.More(); err != nil {
+		return err
+	} else if !more {
+		return fmt.Errorf("syrup: record does not hold 3 values for Go value of type Point")
+	}
+	if v2, err := d.DecodeFloat(64); err != nil {
+		return err
+	} else {
+		x.Y = v2
+	}
+	if more, err := d.More(); err != nil {
+		return err
+	} else if !more {
+		return fmt.Errorf("syrup: record does not hold 3 values for Go value of type Point")
+	}
+	if d.NilSentinel() != nil {
+		if err := d.Decode(&x.Z); err != nil {
+			return err
+		}
+	} else {
+		if x.Z == nil {
+			x.Z = new(float32)
+		}
+		if v3, err := d.DecodeFloat(32); err != nil {
+			return err
+		} else {
+			*x.Z = float32(v3)
+		}
+	}
+	if t, err := d.Token(); err != nil {
+		return err
+	} else if t != syrup.RecordEnd {
+		return fmt.Errorf("syrup: record does not hold 3 values for Go value of type Point")
+	}
+	return nil
+}
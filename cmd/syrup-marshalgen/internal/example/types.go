@@ -0,0 +1,83 @@
+package example
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/cjslep/syrup"
+)
+
+// Kind is a named integer, which Encode treats as an integer.
+type Kind uint16
+
+// Priority is a named integer encoded as the symbols registered for it.
+type Priority int8
+
+const (
+	Low Priority = iota
+	High
+)
+
+func init() {
+	syrup.RegisterEnum(map[Priority]syrup.Symbol{Low: "low", High: "high"})
+}
+
+// Name is a named symbol, which Encode treats as a string.
+type Name syrup.Symbol
+
+// Upper encodes itself as an uppercase string, and decodes into lowercase.
+type Upper string
+
+// MarshalSyrup implements syrup.Marshaler.
+func (u Upper) MarshalSyrup(e *syrup.Encoder) error {
+	return e.EncodeString(strings.ToUpper(string(u)))
+}
+
+// UnmarshalSyrup implements syrup.Unmarshaler.
+func (u *Upper) UnmarshalSyrup(d *syrup.Decoder) error {
+	s, err := d.DecodeString()
+	*u = Upper(strings.ToLower(s))
+	return err
+}
+
+// Message exercises fields of each kind.
+//
+//syrup:generate
+type Message struct {
+	ID       uint64    `syrup:"id,symbol"`
+	From     Person    `syrup:"from"`
+	To       []*Person `syrup:"to"`
+	Subject  string    `syrup:"subject,optional"`
+	Body     []byte    `syrup:"body,optional"`
+	Kind     Kind      `syrup:"kind"`
+	Priority Priority  `syrup:"priority"`
+	Name     Name
+	Flags    map[string]bool `syrup:"flags,optional"`
+	Scores   map[syrup.Symbol][]float32
+	Reply    *Message `syrup:"reply,optional"`
+	Loud     Upper
+	Extra    syrup.Value `syrup:"extra,optional"`
+	Big      *big.Int    `syrup:"big,optional"`
+	Any      interface{} `syrup:"any,optional"`
+	Skipped  string      `syrup:"-"`
+	internal int
+}
+
+//syrup:generate
+type Person struct {
+	Name     string
+	Age      int8
+	Tags     []syrup.Symbol
+	Location Point
+}
+
+// Point is encoded as a record.
+//
+//syrup:generate
+type Point struct {
+	X, Y float64
+	Z    *float32
+}
+
+// SyrupLabel implements syrup.Labeler.
+func (Point) SyrupLabel() syrup.Symbol { return "point" }
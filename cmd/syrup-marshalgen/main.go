@@ -0,0 +1,104 @@
+// Command syrup-marshalgen generates MarshalSyrup and UnmarshalSyrup methods
+// for Go struct types, which encode and decode them without the reflection
+// done by syrup's Encoder and Decoder. The generated methods write the same
+// bytes that Encode writes for the types, and read what Decode reads.
+//
+// Usage:
+//
+//	syrup-marshalgen [-o file] [dir]
+//
+// Struct types of the package in dir, the current directory by default, are
+// selected by a //syrup:generate line in their documentation:
+//
+//	//syrup:generate
+//	type Person struct {
+//		Name string `syrup:"name,symbol"`
+//		Age  int    `syrup:"age,optional"`
+//	}
+//
+// It is typically run by go generate from a file of the package:
+//
+//	//go:generate syrup-marshalgen
+//
+// The methods are written to syrup_marshal.go in the package directory, or
+// to the file given by -o. Structs are encoded as dictionaries of their
+// exported fields, named by their `syrup` struct tags, or as records when
+// they have a SyrupLabel method.
+//
+// Fields of bool, integer, float, string, []byte, and syrup.Symbol types,
+// pointers and slices of those, maps of those keyed by strings or symbols,
+// and types of the package with MarshalSyrup or UnmarshalSyrup methods are
+// encoded and decoded directly. Named bool, float, and string types of the
+// package without such methods are converted to and from their underlying
+// types, so they must not be registered as extensions of an Encoding. Fields
+// of any other type, such as named integer types, which may be registered
+// with syrup.RegisterEnum, syrup.Value, or the types of other packages, are
+// handed to Encode and Decode. So are nil pointers, slices, and maps, and
+// those being decoded by a Decoder with a nil sentinel.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stderr); err == flag.ErrHelp {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "syrup-marshalgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stderr io.Writer) error {
+	fs := flag.NewFlagSet("syrup-marshalgen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	out := fs.String("o", "syrup_marshal.go", "write the generated code to this file in the package directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	dir := "."
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		dir = fs.Arg(0)
+	default:
+		fmt.Fprintln(stderr, "usage: syrup-marshalgen [-o file] [dir]")
+		return flag.ErrHelp
+	}
+	src, err := generateDir(dir, *out)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, *out), src, 0644)
+}
+
+// generateDir generates the methods for the package in dir, ignoring the
+// previously generated file out.
+func generateDir(dir, out string) ([]byte, error) {
+	pkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	g := newGenerator(pkg.Name)
+	fset := token.NewFileSet()
+	for _, name := range pkg.GoFiles {
+		if name == filepath.Base(out) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		g.addFile(f)
+	}
+	return g.generate()
+}
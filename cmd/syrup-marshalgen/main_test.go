@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateExample(t *testing.T) {
+	dir := filepath.Join("internal", "example")
+	want, err := ioutil.ReadFile(filepath.Join(dir, "syrup_marshal.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := generateDir(dir, "syrup_marshal.go")
+	if err != nil {
+		t.Fatalf("generateDir: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("syrup_marshal.go is out of date; run go generate in %s", dir)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "nothing annotated",
+			src:  "type A struct{}",
+			want: "no types of package p are annotated",
+		},
+		{
+			name: "not a struct",
+			src:  "//syrup:generate\ntype A int",
+			want: "A is not a struct type",
+		},
+		{
+			name: "existing methods",
+			src:  "//syrup:generate\ntype A struct{}\n\nfunc (*A) UnmarshalSyrup(d *syrup.Decoder) error { return nil }",
+			want: "A already has a MarshalSyrup or UnmarshalSyrup method",
+		},
+		{
+			name: "duplicate field",
+			src:  "//syrup:generate\ntype A struct {\n\tX int `syrup:\"y\"`\n\tY int `syrup:\"y\"`\n}",
+			want: "A has more than one field named y",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := parser.ParseFile(token.NewFileSet(), "p.go", "package p\n\n"+test.src, parser.ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := newGenerator("p")
+			g.addFile(f)
+			if _, err := g.generate(); err == nil || !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("generate: got %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestUsage(t *testing.T) {
+	var stderr bytes.Buffer
+	if err := run([]string{"a", "b"}, &stderr); err != flag.ErrHelp {
+		t.Errorf("run: got %v, want %v", err, flag.ErrHelp)
+	}
+}
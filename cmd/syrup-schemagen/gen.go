@@ -0,0 +1,752 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/cjslep/syrup"
+	"github.com/cjslep/syrup/schema"
+)
+
+// generator accumulates the Go declarations for a schema.
+type generator struct {
+	s   *schema.Schema
+	buf *bytes.Buffer
+	// declared holds the names of the Go types declared so far.
+	declared map[string]bool
+	// markers holds the marker methods of the unions each Go type belongs
+	// to, written once every definition is declared.
+	markers     map[string][]string
+	markerOrder []string
+	// registers holds the calls registering the alternatives of unions.
+	registers []string
+	usesFmt   bool
+	usesBig   bool
+}
+
+// generate returns the formatted Go source of the types for the schema.
+func generate(s *schema.Schema, pkg, src string) ([]byte, error) {
+	g := &generator{s: s, buf: &bytes.Buffer{}, declared: map[string]bool{}, markers: map[string][]string{}}
+	for _, d := range s.Definitions {
+		if err := g.definition(d); err != nil {
+			return nil, fmt.Errorf("%s: %w", d.Name, err)
+		}
+	}
+	for _, t := range g.markerOrder {
+		for _, m := range g.markers[t] {
+			g.printf("func (%s) %s() {}\n\n", t, m)
+		}
+	}
+	if len(g.registers) > 0 {
+		g.printf("func init() {\n")
+		for _, r := range g.registers {
+			g.printf("\t%s\n", r)
+		}
+		g.printf("}\n")
+	}
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by syrup-schemagen from %s. DO NOT EDIT.\n\n", filepath.Base(src))
+	fmt.Fprintf(&out, "package %s\n\nimport (\n", pkg)
+	if g.usesFmt {
+		out.WriteString("\t\"fmt\"\n")
+	}
+	if g.usesBig {
+		out.WriteString("\t\"math/big\"\n")
+	}
+	if g.usesFmt || g.usesBig {
+		out.WriteString("\n")
+	}
+	out.WriteString("\t\"github.com/cjslep/syrup\"\n)\n\n")
+	out.Write(g.buf.Bytes())
+	b, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+	return b, nil
+}
+
+// goName converts a schema name into an exported Go identifier.
+func goName(s string) string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	name := sb.String()
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+func (g *generator) declare(name string) error {
+	if g.declared[name] {
+		return fmt.Errorf("the Go type %s is declared more than once", name)
+	}
+	g.declared[name] = true
+	return nil
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.buf, format, args...)
+}
+
+// nested returns the declarations written by f, so that they may follow the
+// declaration f determines the types for.
+func (g *generator) nested(f func() error) ([]byte, error) {
+	saved := g.buf
+	g.buf = &bytes.Buffer{}
+	err := f()
+	decls := g.buf.Bytes()
+	g.buf = saved
+	return decls, err
+}
+
+func (g *generator) definition(d schema.Definition) error {
+	name := goName(d.Name)
+	switch p := d.Pattern.(type) {
+	case schema.Ref:
+		if err := g.declare(name); err != nil {
+			return err
+		}
+		g.printf("// %s is %s.\ntype %s = %s\n\n", name, p.Name, name, goName(p.Name))
+		return nil
+	case schema.Union:
+		return g.union(name, p)
+	case schema.Record, schema.Dict, schema.Tuple, schema.SetOf, schema.Literal:
+		_, err := g.typeOf(p, name)
+		return err
+	}
+	t, err := g.typeOf(d.Pattern, name+"Value")
+	if err != nil {
+		return err
+	}
+	return g.wrapper(name, t, d.Pattern)
+}
+
+var atomTypes = map[syrup.Kind]string{
+	syrup.BoolKind:    "bool",
+	syrup.Float32Kind: "float32",
+	syrup.Float64Kind: "float64",
+	syrup.IntKind:     "*big.Int",
+	syrup.StringKind:  "string",
+	syrup.BytesKind:   "[]byte",
+	syrup.SymbolKind:  "syrup.Symbol",
+}
+
+// typeOf returns the Go type of values matching the pattern, declaring a type
+// with the name hint when one is needed.
+func (g *generator) typeOf(p schema.Pattern, hint string) (string, error) {
+	switch p := p.(type) {
+	case schema.Any:
+		return "syrup.Value", nil
+	case schema.Atom:
+		if p.Kind == syrup.IntKind {
+			g.usesBig = true
+		}
+		return atomTypes[p.Kind], nil
+	case schema.Ref:
+		return goName(p.Name), nil
+	case schema.ListOf:
+		elem, err := g.typeOf(p.Elem, hint+"Elem")
+		return "[]" + elem, err
+	case schema.DictOf:
+		if !g.comparable(p.Key) {
+			return "", fmt.Errorf("dictionary keys %s have no comparable Go type", p.Key)
+		}
+		key, err := g.typeOf(p.Key, hint+"Key")
+		if err != nil {
+			return "", err
+		}
+		val, err := g.typeOf(p.Value, hint+"Value")
+		return "map[" + key + "]" + val, err
+	case schema.Record:
+		return hint, g.record(hint, p)
+	case schema.Dict:
+		return hint, g.dict(hint, p)
+	case schema.Tuple:
+		return hint, g.tuple(hint, p)
+	case schema.SetOf:
+		return hint, g.set(hint, p)
+	case schema.Literal:
+		return hint, g.literal(hint, p)
+	}
+	return "", fmt.Errorf("unsupported pattern %s", p)
+}
+
+// resolve follows references to the pattern they name.
+func (g *generator) resolve(p schema.Pattern) schema.Pattern {
+	for i := 0; i < len(g.s.Definitions); i++ {
+		ref, ok := p.(schema.Ref)
+		if !ok {
+			break
+		}
+		p, _ = g.s.Lookup(ref.Name)
+	}
+	return p
+}
+
+// comparable reports whether values of the pattern's Go type may be map keys.
+func (g *generator) comparable(p schema.Pattern) bool {
+	switch p := g.resolve(p).(type) {
+	case schema.Atom:
+		// Integers are *big.Int, whose pointers compare by identity rather
+		// than value.
+		return p.Kind != syrup.BytesKind && p.Kind != syrup.IntKind
+	case schema.Union:
+		return isEnum(p)
+	}
+	return false
+}
+
+// nillable reports whether the zero value of the pattern's Go type is nil.
+func (g *generator) nillable(p schema.Pattern) bool {
+	if a, ok := p.(schema.Atom); ok && a.Kind == syrup.IntKind {
+		// Integers are *big.Int, but definitions of them are named big.Int
+		// types, as pointer types cannot have methods.
+		return true
+	}
+	switch p := g.resolve(p).(type) {
+	case schema.Any, schema.ListOf, schema.DictOf, schema.SetOf:
+		return true
+	case schema.Atom:
+		return p.Kind == syrup.BytesKind
+	case schema.Union:
+		return !isEnum(p)
+	}
+	return false
+}
+
+// fields returns the names and Go types of the fields of a record or list of
+// fixed length.
+func (g *generator) fields(name string, fields []schema.Field) (names, types []string, err error) {
+	names = make([]string, len(fields))
+	types = make([]string, len(fields))
+	seen := map[string]bool{}
+	for i, f := range fields {
+		names[i] = fmt.Sprintf("Field%d", i)
+		if f.Name != "" {
+			names[i] = goName(f.Name)
+		}
+		if seen[names[i]] {
+			return nil, nil, fmt.Errorf("%s has more than one field %s", name, names[i])
+		}
+		seen[names[i]] = true
+		if types[i], err = g.typeOf(f.Pattern, name+names[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return names, types, nil
+}
+
+// bigIntDoc returns the paragraph documenting the required fields of a struct
+// that are *big.Int, which is empty when there are none.
+func bigIntDoc(names, types []string) string {
+	var ints []string
+	for i, t := range types {
+		if t == "*big.Int" {
+			ints = append(ints, names[i])
+		}
+	}
+	switch len(ints) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf("//\n// Its field %s must not be nil when encoded with the NilIsError policy.\n", ints[0])
+	}
+	return fmt.Sprintf("//\n// Its fields %s must not be nil when encoded with the NilIsError policy.\n", strings.Join(ints, ", "))
+}
+
+func (g *generator) structFields(names, types []string) {
+	for i := range names {
+		g.printf("\t%s %s\n", names[i], types[i])
+	}
+}
+
+func (g *generator) record(name string, p schema.Record) error {
+	if p.Label.Kind() != syrup.SymbolKind {
+		return fmt.Errorf("record label %v is not a symbol", p.Label)
+	}
+	if err := g.declare(name); err != nil {
+		return err
+	}
+	var names, types []string
+	decls, err := g.nested(func() (err error) {
+		names, types, err = g.fields(name, p.Fields)
+		return
+	})
+	if err != nil {
+		return err
+	}
+	g.printf("// %s is the record %s.\n%stype %s struct {\n", name, p, bigIntDoc(names, types), name)
+	g.structFields(names, types)
+	g.printf("}\n\n")
+	g.printf("// SyrupLabel implements syrup.Labeler.\nfunc (%s) SyrupLabel() syrup.Symbol { return %q }\n\n", name, string(p.Label.Symbol()))
+	g.buf.Write(decls)
+	return nil
+}
+
+func (g *generator) dict(name string, p schema.Dict) error {
+	if err := g.declare(name); err != nil {
+		return err
+	}
+	var fields, names, types []string
+	decls, err := g.nested(func() error {
+		seen := map[string]bool{}
+		for _, e := range p.Entries {
+			var key, opts string
+			switch e.Key.Kind() {
+			case syrup.StringKind:
+				key = e.Key.String()
+			case syrup.SymbolKind:
+				key, opts = string(e.Key.Symbol()), ",symbol"
+			default:
+				return fmt.Errorf("dictionary key %v is not a string or symbol", e.Key)
+			}
+			if strings.ContainsAny(key, "\",`") {
+				return fmt.Errorf("dictionary key %v cannot be written in a struct tag", e.Key)
+			}
+			field := goName(key)
+			if seen[field] {
+				return fmt.Errorf("%s has more than one field %s", name, field)
+			}
+			seen[field] = true
+			t, err := g.typeOf(e.Pattern, name+field)
+			if err != nil {
+				return err
+			}
+			if e.Optional {
+				opts += ",optional"
+				if !g.nillable(e.Pattern) {
+					t = "*" + t
+				}
+			} else {
+				names, types = append(names, field), append(types, t)
+			}
+			fields = append(fields, fmt.Sprintf("\t%s %s `syrup:\"%s%s\"`\n", field, t, key, opts))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	g.printf("// %s is the dictionary %s.\n%stype %s struct {\n%s}\n\n", name, p, bigIntDoc(names, types), name, strings.Join(fields, ""))
+	g.buf.Write(decls)
+	return nil
+}
+
+func (g *generator) tuple(name string, p schema.Tuple) error {
+	if err := g.declare(name); err != nil {
+		return err
+	}
+	g.usesFmt = true
+	var names, types []string
+	decls, err := g.nested(func() (err error) {
+		names, types, err = g.fields(name, p.Fields)
+		return
+	})
+	if err != nil {
+		return err
+	}
+	g.printf("// %s is the list %s.\n%stype %s struct {\n", name, p, bigIntDoc(names, types), name)
+	g.structFields(names, types)
+	g.printf("}\n\n")
+	vals := make([]string, len(names))
+	ptrs := make([]string, len(names))
+	for i, n := range names {
+		vals[i] = "x." + n
+		ptrs[i] = "&x." + n
+	}
+	g.printf(`// MarshalSyrup implements syrup.Marshaler.
+func (x %[1]s) MarshalSyrup(e *syrup.Encoder) error {
+	if err := e.EncodeToken(syrup.ListStart); err != nil {
+		return err
+	}
+	for _, v := range []interface{}{%[2]s} {
+		if err := e.Encode(v); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(syrup.ListEnd)
+}
+
+// UnmarshalSyrup implements syrup.Unmarshaler.
+func (x *%[1]s) UnmarshalSyrup(d *syrup.Decoder) error {
+	if t, err := d.Token(); err != nil {
+		return err
+	} else if t != syrup.ListStart {
+		return fmt.Errorf("%[1]s: expected a list, got %%v", t)
+	}
+	for _, v := range []interface{}{%[3]s} {
+		if more, err := d.More(); err != nil {
+			return err
+		} else if !more {
+			return fmt.Errorf("%[1]s: expected %[4]d elements")
+		}
+		if err := d.Decode(v); err != nil {
+			return err
+		}
+	}
+	if t, err := d.Token(); err != nil {
+		return err
+	} else if t != syrup.ListEnd {
+		return fmt.Errorf("%[1]s: expected %[4]d elements")
+	}
+	return nil
+}
+
+`, name, strings.Join(vals, ", "), strings.Join(ptrs, ", "), len(names))
+	g.buf.Write(decls)
+	return nil
+}
+
+func (g *generator) set(name string, p schema.SetOf) error {
+	if err := g.declare(name); err != nil {
+		return err
+	}
+	g.usesFmt = true
+	var elem string
+	decls, err := g.nested(func() (err error) {
+		elem, err = g.typeOf(p.Elem, name+"Elem")
+		return
+	})
+	if err != nil {
+		return err
+	}
+	g.printf(`// %[1]s is the set %[3]s.
+type %[1]s []%[2]s
+
+// MarshalSyrup implements syrup.Marshaler.
+func (x %[1]s) MarshalSyrup(e *syrup.Encoder) error {
+	if err := e.EncodeToken(syrup.SetStart); err != nil {
+		return err
+	}
+	for _, v := range x {
+		if err := e.Encode(v); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(syrup.SetEnd)
+}
+
+// UnmarshalSyrup implements syrup.Unmarshaler.
+func (x *%[1]s) UnmarshalSyrup(d *syrup.Decoder) error {
+	if t, err := d.Token(); err != nil {
+		return err
+	} else if t != syrup.SetStart {
+		return fmt.Errorf("%[1]s: expected a set, got %%v", t)
+	}
+	*x = %[1]s{}
+	for {
+		if more, err := d.More(); err != nil {
+			return err
+		} else if !more {
+			break
+		}
+		var v %[2]s
+		if err := d.Decode(&v); err != nil {
+			return err
+		}
+		*x = append(*x, v)
+	}
+	_, err := d.Token()
+	return err
+}
+
+`, name, elem, p)
+	g.buf.Write(decls)
+	return nil
+}
+
+// literalExpr returns a Go expression constructing the syrup.Value.
+func literalExpr(v syrup.Value) (string, error) {
+	switch v.Kind() {
+	case syrup.BoolKind:
+		return fmt.Sprintf("syrup.NewBool(%t)", v.Bool()), nil
+	case syrup.IntKind:
+		if i, ok := v.Int64(); ok {
+			return fmt.Sprintf("syrup.NewInt(%d)", i), nil
+		}
+	case syrup.StringKind:
+		return fmt.Sprintf("syrup.NewString(%q)", v.String()), nil
+	case syrup.SymbolKind:
+		return fmt.Sprintf("syrup.NewSymbol(%q)", string(v.Symbol())), nil
+	}
+	return "", fmt.Errorf("unsupported literal %v", v)
+}
+
+func (g *generator) literal(name string, p schema.Literal) error {
+	if err := g.declare(name); err != nil {
+		return err
+	}
+	g.usesFmt = true
+	lit, err := literalExpr(p.Value)
+	if err != nil {
+		return err
+	}
+	g.printf(`// %[1]s is the literal %[3]s, which it is always encoded as.
+type %[1]s struct{}
+
+// MarshalSyrup implements syrup.Marshaler.
+func (%[1]s) MarshalSyrup(e *syrup.Encoder) error {
+	return e.Encode(%[2]s)
+}
+
+// UnmarshalSyrup implements syrup.Unmarshaler.
+func (*%[1]s) UnmarshalSyrup(d *syrup.Decoder) error {
+	var v syrup.Value
+	if err := d.Decode(&v); err != nil {
+		return err
+	} else if want := %[2]s; !v.Equal(want) {
+		return fmt.Errorf("%[1]s: expected %%v, got %%v", want, v)
+	}
+	return nil
+}
+
+`, name, lit, p)
+	return nil
+}
+
+// wrapper declares a named type with the underlying Go type t, encoding itself
+// as t would be. A *big.Int is wrapped as a big.Int, as pointer types cannot
+// have methods.
+func (g *generator) wrapper(name, t string, p schema.Pattern) error {
+	if err := g.declare(name); err != nil {
+		return err
+	}
+	if t == "*big.Int" {
+		// A big.Int must not be copied, so the methods convert pointers
+		// to it. MarshalSyrup keeps a value receiver, which is only read,
+		// so that values that are not addressable still encode.
+		g.printf(`// %[1]s is %[2]s.
+type %[1]s big.Int
+
+// MarshalSyrup implements syrup.Marshaler.
+func (x %[1]s) MarshalSyrup(e *syrup.Encoder) error {
+	return e.Encode((*big.Int)(&x))
+}
+
+// UnmarshalSyrup implements syrup.Unmarshaler.
+func (x *%[1]s) UnmarshalSyrup(d *syrup.Decoder) error {
+	return d.Decode((*big.Int)(x))
+}
+
+`, name, p)
+		return nil
+	}
+	g.printf(`// %[1]s is %[3]s.
+type %[1]s %[2]s
+
+// MarshalSyrup implements syrup.Marshaler.
+func (x %[1]s) MarshalSyrup(e *syrup.Encoder) error {
+	return e.Encode(%[2]s(x))
+}
+
+// UnmarshalSyrup implements syrup.Unmarshaler.
+func (x *%[1]s) UnmarshalSyrup(d *syrup.Decoder) error {
+	return d.Decode((*%[2]s)(x))
+}
+
+`, name, t, p)
+	return nil
+}
+
+func isEnum(u schema.Union) bool {
+	for _, a := range u.Alternatives {
+		if l, ok := a.Pattern.(schema.Literal); !ok || l.Value.Kind() != syrup.SymbolKind {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *generator) enum(name string, u schema.Union) error {
+	if err := g.declare(name); err != nil {
+		return err
+	}
+	g.usesFmt = true
+	consts := make([]string, len(u.Alternatives))
+	syms := make([]string, len(u.Alternatives))
+	for i, a := range u.Alternatives {
+		syms[i] = a.Pattern.(schema.Literal).Value.String()
+	}
+	g.printf("// %s is one of the symbols %s.\ntype %s syrup.Symbol\n\nconst (\n", name, strings.Join(syms, ", "), name)
+	for i, a := range u.Alternatives {
+		consts[i] = name + goName(a.Name)
+		if g.declared[consts[i]] {
+			return fmt.Errorf("the Go name %s is declared more than once", consts[i])
+		}
+		g.declared[consts[i]] = true
+		g.printf("\t%s %s = %q\n", consts[i], name, string(a.Pattern.(schema.Literal).Value.Symbol()))
+	}
+	g.printf(`)
+
+// MarshalSyrup implements syrup.Marshaler.
+func (x %[1]s) MarshalSyrup(e *syrup.Encoder) error {
+	switch x {
+	case %[2]s:
+		return e.Encode(syrup.Symbol(x))
+	}
+	return fmt.Errorf("%[1]s: invalid symbol %%q", string(x))
+}
+
+// UnmarshalSyrup implements syrup.Unmarshaler.
+func (x *%[1]s) UnmarshalSyrup(d *syrup.Decoder) error {
+	var s syrup.Symbol
+	if err := d.Decode(&s); err != nil {
+		return err
+	}
+	switch %[1]s(s) {
+	case %[2]s:
+		*x = %[1]s(s)
+		return nil
+	}
+	return fmt.Errorf("%[1]s: invalid symbol %%q", string(s))
+}
+
+`, name, strings.Join(consts, ", "))
+	return nil
+}
+
+func (g *generator) union(name string, u schema.Union) error {
+	if isEnum(u) {
+		return g.enum(name, u)
+	}
+	if err := g.declare(name); err != nil {
+		return err
+	}
+	marker := "is" + name
+	g.printf("// %s is one of %s.\ntype %s interface {\n\t%s()\n}\n\n", name, u, name, marker)
+	var impls []implementer
+	for _, a := range u.Alternatives {
+		alt := name + goName(a.Name)
+		switch p := a.Pattern.(type) {
+		case schema.Ref:
+			types, err := g.implementers(p.Name, 0)
+			if err != nil {
+				return err
+			}
+			for _, t := range types {
+				g.mark(t.name, marker)
+			}
+			impls = append(impls, types...)
+			continue
+		case schema.Record, schema.Dict, schema.Tuple, schema.SetOf, schema.Literal:
+			if _, err := g.typeOf(p, alt); err != nil {
+				return err
+			}
+		default:
+			t, err := g.typeOf(p, alt+"Value")
+			if err != nil {
+				return err
+			} else if err := g.wrapper(alt, t, p); err != nil {
+				return err
+			}
+		}
+		g.mark(alt, marker)
+		impls = append(impls, implementer{alt, a.Pattern})
+	}
+	return g.register(name, impls)
+}
+
+// implementer is a Go type declared for an alternative of a union, with the
+// pattern it was declared for.
+type implementer struct {
+	name string
+	p    schema.Pattern
+}
+
+// implementers returns the Go types declared for the definition, which are
+// those of its alternatives for a union.
+func (g *generator) implementers(def string, depth int) ([]implementer, error) {
+	p, _ := g.s.Lookup(def)
+	if depth > len(g.s.Definitions) {
+		return nil, fmt.Errorf("%s refers to itself", def)
+	}
+	switch p := p.(type) {
+	case schema.Ref:
+		return g.implementers(p.Name, depth+1)
+	case schema.Union:
+		if isEnum(p) {
+			break
+		}
+		var impls []implementer
+		for _, a := range p.Alternatives {
+			if ref, ok := a.Pattern.(schema.Ref); ok {
+				is, err := g.implementers(ref.Name, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				impls = append(impls, is...)
+			} else {
+				impls = append(impls, implementer{goName(def) + goName(a.Name), a.Pattern})
+			}
+		}
+		return impls, nil
+	}
+	return []implementer{{goName(def), p}}, nil
+}
+
+// register adds the call registering the implementers of the union with
+// syrup.RegisterUnion, by which values are decoded into it. Records are told
+// apart by their labels, and literals and the symbols of enums by their
+// values, so no other alternatives may be decoded.
+func (g *generator) register(name string, impls []implementer) error {
+	args := []string{fmt.Sprintf("(*%s)(nil)", name)}
+	matched := map[string]string{}
+	add := func(match, impl, arg string) error {
+		if other, ok := matched[match]; ok {
+			return fmt.Errorf("%s and %s both match %s", other, impl, match)
+		}
+		matched[match] = impl
+		args = append(args, arg)
+		return nil
+	}
+	for _, impl := range impls {
+		var err error
+		switch p := impl.p.(type) {
+		case schema.Record:
+			err = add(fmt.Sprintf("records labeled %v", p.Label), impl.name, impl.name+"{}")
+		case schema.Literal:
+			err = add(fmt.Sprint(p.Value), impl.name, impl.name+"{}")
+		case schema.Union:
+			for _, a := range p.Alternatives {
+				c := impl.name + goName(a.Name)
+				if err = add(fmt.Sprint(a.Pattern.(schema.Literal).Value), c, c); err != nil {
+					break
+				}
+			}
+		default:
+			err = fmt.Errorf("%s is neither a record nor a literal, so it cannot be told apart from the other alternatives when decoded", impl.name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	g.registers = append(g.registers, fmt.Sprintf("syrup.RegisterUnion(%s)", strings.Join(args, ", ")))
+	return nil
+}
+
+func (g *generator) mark(t, marker string) {
+	for _, m := range g.markers[t] {
+		if m == marker {
+			return
+		}
+	}
+	if len(g.markers[t]) == 0 {
+		g.markerOrder = append(g.markerOrder, t)
+	}
+	g.markers[t] = append(g.markers[t], marker)
+}
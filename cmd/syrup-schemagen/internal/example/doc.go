@@ -0,0 +1,5 @@
+// Package example holds types generated from example.prs, to test the code
+// syrup-schemagen generates.
+package example
+
+//go:generate go run github.com/cjslep/syrup/cmd/syrup-schemagen -package example -o example.go example.prs
@@ -0,0 +1,238 @@
+package example
+
+import (
+	"bytes"
+	"math/big"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/cjslep/syrup"
+	"github.com/cjslep/syrup/schema"
+)
+
+func readSchema(t *testing.T) *schema.Schema {
+	f, err := os.Open("example.prs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s, err := schema.Read(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// size is 2**70, which no int64 holds.
+var size = new(big.Int).Lsh(big.NewInt(1), 70)
+
+func TestRoundTrip(t *testing.T) {
+	s := readSchema(t)
+	tests := []struct {
+		name string
+		def  string
+		v    interface{}
+		want string
+	}{
+		{
+			name: "record",
+			def:  "Person",
+			v:    &Person{Name: "alice", Age: big.NewInt(30)},
+			want: "<6'person5\"alicei30e>",
+		},
+		{
+			name: "list of records",
+			def:  "People",
+			v:    &People{{Name: "bob", Age: big.NewInt(1)}},
+			want: "[<6'person3\"bobi1e>]",
+		},
+		{
+			name: "set",
+			def:  "Tags",
+			v:    &Tags{"a", "b"},
+			want: "#1'a1'b$",
+		},
+		{
+			name: "tuple",
+			def:  "Point",
+			v:    &Point{X: 1, Y: 2},
+			want: "[D?\xf0\x00\x00\x00\x00\x00\x00D@\x00\x00\x00\x00\x00\x00\x00]",
+		},
+		{
+			name: "dictionary",
+			def:  "Config",
+			v:    &Config{Host: "example.com", Port: big.NewInt(8080), Tags: Tags{"x"}},
+			want: "{4'host11\"example.com4\"porti8080e4\"tags#1'x$}",
+		},
+		{
+			name: "dictionary omitting optional entries",
+			def:  "Config",
+			v:    &Config{Host: "example.com"},
+			want: "{4'host11\"example.com}",
+		},
+		{
+			name: "enum",
+			def:  "Status",
+			v:    func() *Status { s := StatusBroken; return &s }(),
+			want: "6'broken",
+		},
+		{
+			name: "record alternative",
+			def:  "Shape",
+			v:    &ShapeRect{Size: Point{X: 1, Y: 2}},
+			want: "<4'rect[D?\xf0\x00\x00\x00\x00\x00\x00D@\x00\x00\x00\x00\x00\x00\x00]>",
+		},
+		{
+			name: "literal alternative",
+			def:  "Shape",
+			v:    &ShapeNone{},
+			want: "4'none",
+		},
+		{
+			name: "any",
+			def:  "Message",
+			v:    &MessageOpDeliver{To: Person{Name: "carol", Age: big.NewInt(2)}, Body: syrup.NewList(syrup.NewInt(1))},
+			want: "<10'op:deliver<6'person5\"caroli2e>[i1e]>",
+		},
+		{
+			name: "literal",
+			def:  "Ping",
+			v:    &Ping{},
+			want: "t",
+		},
+		{
+			name: "wrapper",
+			def:  "Id",
+			v:    &Id{1, 2},
+			want: "2:\x01\x02",
+		},
+		{
+			name: "dictionary of integers",
+			def:  "Counts",
+			v:    &Counts{"a": size},
+			want: "{1\"ai1180591620717411303424e}",
+		},
+		{
+			name: "integer wrapper",
+			def:  "Size",
+			v:    (*Size)(size),
+			want: "i1180591620717411303424e",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := syrup.NewEncoder(syrup.NewPrototypeEncoding(), &buf).Encode(test.v); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if got := buf.String(); got != test.want {
+				t.Errorf("Encode: got %q, want %q", got, test.want)
+			}
+			d := syrup.NewDecoder(syrup.NewPrototypeEncoding(), bytes.NewReader(buf.Bytes()))
+			if err := s.ValidateStream(test.def, d); err != nil {
+				t.Errorf("ValidateStream(%s): %v", test.def, err)
+			}
+			got := reflect.New(reflect.TypeOf(test.v).Elem())
+			d = syrup.NewDecoder(syrup.NewPrototypeEncoding(), bytes.NewReader(buf.Bytes()))
+			if err := d.Decode(got.Interface()); err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if !reflect.DeepEqual(got.Interface(), test.v) {
+				t.Errorf("Decode: got %#v, want %#v", got.Interface(), test.v)
+			}
+		})
+	}
+}
+
+// drawing holds values of the generated unions, as types using them would.
+type drawing struct {
+	Shapes   []Shape
+	Messages []Message
+}
+
+func TestUnionFields(t *testing.T) {
+	in := drawing{
+		Shapes: []Shape{ShapeCircle{Radius: 1}, ShapeRect{Size: Point{X: 1, Y: 2}}, ShapeNone{}},
+		Messages: []Message{
+			MessageOpDeliver{To: Person{Name: "dave", Age: big.NewInt(3)}, Body: syrup.NewSymbol("hi")},
+			MessageOpAbort{Reason: "no"},
+			StatusFulfilled,
+		},
+	}
+	var buf bytes.Buffer
+	if err := syrup.NewEncoder(syrup.NewPrototypeEncoding(), &buf).Encode(in); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	var out drawing
+	if err := syrup.NewDecoder(syrup.NewPrototypeEncoding(), &buf).Decode(&out); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Decode: got %#v, want %#v", out, in)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		v    interface{}
+	}{
+		{
+			name: "unknown enum symbol",
+			in:   "4'lost",
+			v:    new(Status),
+		},
+		{
+			name: "wrong literal",
+			in:   "f",
+			v:    new(Ping),
+		},
+		{
+			name: "short tuple",
+			in:   "[D?\xf0\x00\x00\x00\x00\x00\x00]",
+			v:    new(Point),
+		},
+		{
+			name: "long tuple",
+			in:   "[i1ei2ei3e]",
+			v:    new(Point),
+		},
+		{
+			name: "set expected",
+			in:   "[1'a]",
+			v:    new(Tags),
+		},
+		{
+			name: "wrong label",
+			in:   "<4'recti1e>",
+			v:    new(ShapeCircle),
+		},
+		{
+			name: "unknown alternative label",
+			in:   "<6'square>",
+			v:    new(Shape),
+		},
+		{
+			name: "unknown alternative symbol",
+			in:   "4'lost",
+			v:    new(Message),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := syrup.NewDecoder(syrup.NewPrototypeEncoding(), bytes.NewReader([]byte(test.in)))
+			if err := d.Decode(test.v); err == nil {
+				t.Errorf("Decode: got %#v, want an error", test.v)
+			}
+		})
+	}
+}
+
+func TestEncodeInvalidEnum(t *testing.T) {
+	var buf bytes.Buffer
+	if err := syrup.NewEncoder(syrup.NewPrototypeEncoding(), &buf).Encode(Status("lost")); err == nil {
+		t.Errorf("Encode: got %q, want an error", buf.String())
+	}
+}
@@ -0,0 +1,87 @@
+// Command syrup-schemagen generates Go types from a schema of package
+// github.com/cjslep/syrup/schema, so that the schema is the single source of
+// truth for the shapes of messages.
+//
+// Usage:
+//
+//	syrup-schemagen -package name [-o file] schema
+//
+// It is typically run by go generate:
+//
+//	//go:generate syrup-schemagen -package proto -o proto.go proto.prs
+//
+// Each definition becomes a Go type named after it in CamelCase:
+//
+//   - records become structs implementing syrup.Labeler, with a field for
+//     each value named by its @name, or else Field0, Field1, ...
+//   - dictionaries become structs with `syrup` struct tags, where optional
+//     entries are pointers unless already nillable
+//   - unions become interfaces with an unexported marker method, which each
+//     alternative implements; record alternatives become structs named after
+//     the union and alternative. The alternatives are registered with
+//     syrup.RegisterUnion so that values decode into the interface, which
+//     requires each to be a record, a literal, or an enum, and no two to
+//     match the same value
+//   - unions of literal symbols become enums of syrup.Symbol with a constant
+//     for each symbol
+//   - lists of fixed length and sets become types encoding themselves as
+//     such, as do literals
+//
+// Atoms map to bool, float32, float64, *big.Int, string, []byte, and
+// syrup.Symbol, and any to syrup.Value. Integers are unbounded, so dictionaries
+// keyed by them have no comparable Go type, and definitions of them are named
+// big.Int types. The *big.Int fields of the zero values of structs are nil, so
+// required ones must be set before the structs are encoded with the default
+// NilIsError policy.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/cjslep/syrup/schema"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err == flag.ErrHelp {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "syrup-schemagen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("syrup-schemagen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	pkg := fs.String("package", "", "the name of the generated package")
+	out := fs.String("o", "", "write the generated code to this file rather than standard output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *pkg == "" {
+		fmt.Fprintln(stderr, "usage: syrup-schemagen -package name [-o file] schema")
+		return flag.ErrHelp
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	s, err := schema.Read(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	src, err := generate(s, *pkg, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(*out, src, 0644)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cjslep/syrup/schema"
+)
+
+func TestGenerateExample(t *testing.T) {
+	dir := filepath.Join("internal", "example")
+	want, err := ioutil.ReadFile(filepath.Join(dir, "example.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"-package", "example", filepath.Join(dir, "example.prs")}, &stdout, &stderr); err != nil {
+		t.Fatalf("run: %v: %s", err, stderr.String())
+	}
+	// The generated code names the schema as given on the command line.
+	got := strings.Replace(stdout.String(), filepath.Join(dir, "example.prs"), "example.prs", 1)
+	if got != string(want) {
+		t.Errorf("example.go is out of date; run go generate in %s", dir)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "label not a symbol",
+			src:  `A = <"a" int> .`,
+			want: "A: record label",
+		},
+		{
+			name: "uncomparable keys",
+			src:  `L = [int ...] . A = {L: int ...:...} .`,
+			want: "A: dictionary keys",
+		},
+		{
+			name: "integer keys",
+			src:  `A = {int: string ...:...} .`,
+			want: "A: dictionary keys",
+		},
+		{
+			name: "duplicate field",
+			src:  `A = <a @x int @x int> .`,
+			want: "A: A has more than one field X",
+		},
+		{
+			name: "duplicate type",
+			src:  `A = / @b <b> / @c <c> . AB = int .`,
+			want: "AB: the Go type AB is declared more than once",
+		},
+		{
+			name: "undecodable alternative",
+			src:  `A = @n int / @s string .`,
+			want: "A: AN is neither a record nor a literal",
+		},
+		{
+			name: "alternatives sharing a label",
+			src:  `A = @x <a> / @y <a int> .`,
+			want: "A: AX and AY both match records labeled a",
+		},
+		{
+			name: "alternatives sharing a symbol",
+			src:  `S = =b / =c . A = @b =b / S .`,
+			want: "A: AB and SB both match b",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := schema.Parse(test.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = generate(s, "p", "p.prs")
+			if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("generate: got %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"example.prs"},
+		{"-package", "p"},
+		{"-package", "p", "a.prs", "b.prs"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if err := run(args, &stdout, &stderr); err != flag.ErrHelp {
+			t.Errorf("run(%q): got %v, want %v", args, err, flag.ErrHelp)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cjslep/syrup"
+	"github.com/cjslep/syrup/query"
+	"github.com/cjslep/syrup/schema"
+	"github.com/cjslep/syrup/syrupjson"
+)
+
+func dump(fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	indent := fs.String("indent", "", "indent compound values using this string")
+	hex := fs.Bool("hex", false, "print bytestrings in hexadecimal")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	r, err := input(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w := bufio.NewWriter(stdout)
+	p := &syrup.Printer{Indent: *indent, HexBytes: *hex}
+	if err := p.PrintStream(w, syrup.NewDecoder(syrup.NewPrototypeEncoding(), bufio.NewReader(r))); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func validate(fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	canonical := fs.Bool("canonical", false, "also require each value to be in canonical form")
+	schemaFile := fs.String("schema", "", "also require each value to match a definition of this schema file")
+	def := fs.String("def", "", "the name of the schema definition each value must match")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var s *schema.Schema
+	if *schemaFile != "" {
+		if *def == "" {
+			return fmt.Errorf("%s: -schema requires -def", fs.Name())
+		}
+		f, err := os.Open(*schemaFile)
+		if err != nil {
+			return err
+		}
+		s, err = schema.Read(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	r, err := input(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	rec := &recorder{r: bufio.NewReader(r)}
+	enc := syrup.NewPrototypeEncoding()
+	dec := syrup.NewDecoder(enc, rec)
+	n := 0
+	for ; ; n++ {
+		rec.buf.Reset()
+		var v syrup.Value
+		if err := dec.Decode(&v); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("value %d: %w", n, err)
+		}
+		if s != nil {
+			if err := s.Validate(*def, v); err != nil {
+				return fmt.Errorf("value %d: %w", n, err)
+			}
+		}
+		if !*canonical {
+			continue
+		}
+		var buf bytes.Buffer
+		cenc := syrup.NewEncoder(enc, &buf)
+		cenc.SetCanonical(true)
+		if err := cenc.Encode(v); err != nil {
+			return fmt.Errorf("value %d: %w", n, err)
+		}
+		// Whitespace separating values is permitted, but not within.
+		if got := bytes.TrimLeft(rec.buf.Bytes(), " \t\r\n\v\f"); !bytes.Equal(got, buf.Bytes()) {
+			return fmt.Errorf("value %d: not in canonical form", n)
+		}
+	}
+	_, err = fmt.Fprintf(stdout, "ok: %d values\n", n)
+	return err
+}
+
+func canon(fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	r, err := input(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	enc := syrup.NewPrototypeEncoding()
+	dec := syrup.NewDecoder(enc, bufio.NewReader(r))
+	w := bufio.NewWriter(stdout)
+	e := syrup.NewEncoder(enc, w)
+	e.SetCanonical(true)
+	for {
+		var v syrup.Value
+		if err := dec.Decode(&v); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := e.Encode(v); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// recorder keeps a copy of the bytes read since it was last reset.
+type recorder struct {
+	r   io.Reader
+	buf bytes.Buffer
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.buf.Write(p[:n])
+	return n, err
+}
+
+func toJSON(fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	r, err := input(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w := bufio.NewWriter(stdout)
+	if err := syrupjson.SyrupToJSON(w, r); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func fromJSON(fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	canonical := fs.Bool("canonical", false, "write each value in canonical form")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	r, err := input(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return syrupjson.JSONToSyrup(stdout, bufio.NewReader(r), *canonical)
+}
+
+func fromText(fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	canonical := fs.Bool("canonical", false, "write each value in canonical form")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	r, err := input(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	dec := syrup.NewTextDecoder(r)
+	w := bufio.NewWriter(stdout)
+	e := syrup.NewEncoder(syrup.NewPrototypeEncoding(), w)
+	e.SetCanonical(*canonical)
+	for {
+		var v interface{}
+		if err := dec.Decode(&v); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := e.Encode(v); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func queryCmd(fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	text := fs.Bool("text", false, "print each output in the text form of dump rather than as Syrup")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("%s: expected a query", fs.Name())
+	}
+	q, err := query.Parse(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+	r, err := input(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w := bufio.NewWriter(stdout)
+	enc := syrup.NewPrototypeEncoding()
+	e := syrup.NewEncoder(enc, w)
+	p := &syrup.Printer{}
+	err = q.Run(syrup.NewDecoder(enc, bufio.NewReader(r)), func(v syrup.Value) error {
+		if !*text {
+			return e.Encode(v)
+		}
+		if err := p.Fprint(w, v); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
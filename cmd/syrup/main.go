@@ -0,0 +1,96 @@
+// Command syrup converts, inspects, and validates streams of Syrup values.
+//
+// Usage:
+//
+//	syrup <command> [flags] [file]
+//
+// Each command reads the concatenated values in file, or standard input when
+// file is omitted or "-", and writes its results to standard output. The
+// commands are:
+//
+//	dump       print each value in a human readable text form
+//	validate   check that each value is well formed, and optionally matches
+//	           a schema of package schema
+//	to-json    convert each value to a line of JSON
+//	from-json  convert a stream of JSON values to Syrup
+//	from-text  convert Preserves text values, as printed by dump, to Syrup
+//	canon      re-encode each value into canonical form
+//	query      filter and transform each value, as in: syrup query '.[0]' file
+//
+// The JSON conversion is lossless, following the convention of package
+// syrupjson, and the query language is that of package query.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err == flag.ErrHelp {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "syrup:", err)
+		os.Exit(1)
+	}
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(fs *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"dump", "print each value in a human readable text form", dump},
+	{"validate", "check that each value is well formed", validate},
+	{"to-json", "convert each value to a line of JSON", toJSON},
+	{"from-json", "convert a stream of JSON values to Syrup", fromJSON},
+	{"from-text", "convert Preserves text values to Syrup", fromText},
+	{"canon", "re-encode each value into canonical form", canon},
+	{"query", "filter and transform each value with a query", queryCmd},
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		usage(stderr)
+		return flag.ErrHelp
+	}
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+		fs := flag.NewFlagSet("syrup "+c.name, flag.ContinueOnError)
+		fs.SetOutput(stderr)
+		return c.run(fs, args[1:], stdin, stdout)
+	}
+	usage(stderr)
+	return flag.ErrHelp
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: syrup <command> [flags] [file]")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.usage)
+	}
+}
+
+// input opens the single optional file argument remaining after parsing
+// flags, defaulting to stdin.
+func input(fs *flag.FlagSet, stdin io.Reader) (io.ReadCloser, error) {
+	switch fs.NArg() {
+	case 0:
+		return ioutil.NopCloser(stdin), nil
+	case 1:
+		if fs.Arg(0) == "-" {
+			return ioutil.NopCloser(stdin), nil
+		}
+		return os.Open(fs.Arg(0))
+	default:
+		return nil, fmt.Errorf("%s: expected at most one file, got %d", fs.Name(), fs.NArg())
+	}
+}
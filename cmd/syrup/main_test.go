@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runCommand(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	err := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestDump(t *testing.T) {
+	out, err := runCommand(t, "<2'opi1e>\n{1\"a3:\x00\x01\x02}", "dump", "-hex")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expect := "<op 1>\n{\"a\": #x\"000102\"}\n"
+	if out != expect {
+		t.Errorf("got %q, want %q", out, expect)
+	}
+	out, err = runCommand(t, "{3:abci1e}", "dump")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if expect := "{#\"abc\": 1}\n"; out != expect {
+		t.Errorf("got %q, want %q", out, expect)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		args  []string
+		valid bool
+	}{
+		{"Well formed", "i1e [1\"a]", nil, true},
+		{"Truncated", "[1\"a", nil, false},
+		{"Malformed", "i1x", nil, false},
+		{"Canonical", "{1\"ai1e1\"bi2e}\n#i1ei2e$", []string{"-canonical"}, true},
+		{"Unsorted dictionary", "{1\"bi2e1\"ai1e}", []string{"-canonical"}, false},
+		{"Unsorted set", "#i2ei1e$", []string{"-canonical"}, false},
+		{"Inner whitespace", "[i1e i2e]", []string{"-canonical"}, false},
+		{"Bytestring key", "{3:abci1e}", nil, true},
+		{"Compound keys", "{<1'ri2e>i2e[i1e]i1e}", []string{"-canonical"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := runCommand(t, test.in, append([]string{"validate"}, test.args...)...)
+			if test.valid && err != nil {
+				t.Errorf("got error %v", err)
+			} else if !test.valid && err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syrup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "ops.prs")
+	if err := ioutil.WriteFile(file, []byte("Op = <op int> .\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runCommand(t, "<2'opi1e><2'opi2e>", "validate", "-schema", file, "-def", "Op"); err != nil {
+		t.Errorf("got error %v", err)
+	}
+	_, err = runCommand(t, "<2'opi1e><2'op1\"a>", "validate", "-schema", file, "-def", "Op")
+	if err == nil || !strings.Contains(err.Error(), "value 1") {
+		t.Errorf("got %v, want a mismatch of value 1", err)
+	}
+	if _, err := runCommand(t, "", "validate", "-schema", file); err == nil {
+		t.Errorf("expected error without -def")
+	}
+}
+
+func TestCanon(t *testing.T) {
+	out, err := runCommand(t, "{1\"bi2e1\"ai1e} #i2ei1e$", "canon")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expect := "{1\"ai1e1\"bi2e}#i1ei2e$"
+	if out != expect {
+		t.Errorf("got %q, want %q", out, expect)
+	}
+	out, err = runCommand(t, "{<1'ri2e>i2e3:abci1e}", "canon")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if expect := "{3:abci1e<1'ri2e>i2e}"; out != expect {
+		t.Errorf("got %q, want %q", out, expect)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	in := "<5'pointi1eD\x3f\xf8\x00\x00\x00\x00\x00\x00F\x7f\xc0\x00\x00>" +
+		"{1\"a#3:abc$2\"@b[i92233720368547758070et]i1e3'one}"
+	js, err := runCommand(t, in, "to-json")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expect := `{"@record":[{"@symbol":"point"},1,1.5,{"@f32":"7fc00000"}]}` + "\n" +
+		`{"a":{"@set":[{"@bytes":"YWJj"}]},"@@b":[92233720368547758070,true],"@1":{"@symbol":"one"}}` + "\n"
+	if js != expect {
+		t.Fatalf("got %s, want %s", js, expect)
+	}
+	out, err := runCommand(t, js, "from-json", "-canonical")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	canon, err := runCommand(t, in, "canon")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if out != canon {
+		t.Errorf("got %q, want %q", out, canon)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	if _, err := runCommand(t, "", "frobnicate"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestFromText(t *testing.T) {
+	in := "<op 1> ; comment\n{\"b\": #x\"000102\", \"a\": #t}"
+	out, err := runCommand(t, in, "from-text", "-canonical")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expect := "<2'opi1e>{1\"at1\"b3:\x00\x01\x02}"
+	if out != expect {
+		t.Errorf("got %q, want %q", out, expect)
+	}
+	dump, err := runCommand(t, out, "dump", "-hex")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if dump != "<op 1>\n{\"a\": #t, \"b\": #x\"000102\"}\n" {
+		t.Errorf("got %q", dump)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	in := "<2'opi1e><4'stop><2'opi2e>"
+	out, err := runCommand(t, in, "query", "select(label == 'op) | .[0]")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if out != "i1ei2e" {
+		t.Errorf("got %q, want %q", out, "i1ei2e")
+	}
+	out, err = runCommand(t, in, "query", "-text", "[.[]]", "-")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if expect := "[1]\n[]\n[2]\n"; out != expect {
+		t.Errorf("got %q, want %q", out, expect)
+	}
+	if _, err := runCommand(t, in, "query", ".["); err == nil {
+		t.Errorf("expected error for a malformed query")
+	}
+}
@@ -0,0 +1,152 @@
+package syrup
+
+import (
+	"sort"
+	"strings"
+)
+
+// Compare returns an integer comparing two values by the total order of the
+// Preserves data model: -1 if a sorts before b, 0 if they are equal, and +1 if
+// a sorts after b. Values of different kinds sort in the order their Kinds are
+// declared. Within a kind, booleans sort false first, floats by the IEEE 754
+// totalOrder predicate, integers of any size numerically, and strings,
+// bytestrings and symbols lexicographically by their bytes. Records compare by
+// their label and then values, and lists lexicographically. Sets and
+// dictionaries compare as if they were sorted lists of their elements, or of
+// their keys each followed by its value.
+//
+// The values may be Values, the representation the Decoder uses for
+// interface{}, or any Go value the Encoder is able to encode. Compare panics
+// if either cannot be encoded.
+func Compare(a, b interface{}) int {
+	return mustValueOf(a).Compare(mustValueOf(b))
+}
+
+// Less reports whether a sorts before b, as determined by Compare. It allows
+// sorting the elements of a Set, or the keys of a dictionary:
+//
+//	sort.Slice(s, func(i, j int) bool { return syrup.Less(s[i], s[j]) })
+func Less(a, b interface{}) bool {
+	return Compare(a, b) < 0
+}
+
+// Equal reports whether a and b mean the same Syrup value, regardless of
+// their Go representation: an int64 equals a *big.Int of the same value, sets
+// are equal when they have the same elements in any order, and a struct equals
+// a map with the same entries. As Compare orders floats by their bits, a NaN
+// equals an identical NaN, and negative zero does not equal zero.
+//
+// Values that cannot be encoded are not equal to anything.
+func Equal(a, b interface{}) bool {
+	x, err := ValueOf(a)
+	if err != nil {
+		return false
+	}
+	y, err := ValueOf(b)
+	if err != nil {
+		return false
+	}
+	return x.Equal(y)
+}
+
+func mustValueOf(v interface{}) Value {
+	x, err := ValueOf(v)
+	if err != nil {
+		panic(err)
+	}
+	return x
+}
+
+// Equal reports whether v and w are the same value, as Equal does.
+func (v Value) Equal(w Value) bool {
+	return v.Compare(w) == 0
+}
+
+// Compare compares v and w as Compare does.
+func (v Value) Compare(w Value) int {
+	if v.kind != w.kind {
+		return compareUint(uint64(v.kind), uint64(w.kind))
+	}
+	switch v.kind {
+	case BoolKind, IntKind:
+		if v.big == nil && w.big == nil {
+			if v.kind == BoolKind {
+				return compareUint(v.num, w.num)
+			}
+			return compareInt(int64(v.num), int64(w.num))
+		}
+		return v.BigInt().Cmp(w.BigInt())
+	case Float32Kind:
+		return compareUint(totalOrderKey(v.num, 32), totalOrderKey(w.num, 32))
+	case Float64Kind:
+		return compareUint(totalOrderKey(v.num, 64), totalOrderKey(w.num, 64))
+	case StringKind, BytesKind, SymbolKind:
+		return strings.Compare(v.str, w.str)
+	case RecordKind, ListKind:
+		return compareSeq(v.seq, w.seq, 1)
+	case SetKind:
+		return compareSeq(sortedSeq(v.seq, 1), sortedSeq(w.seq, 1), 1)
+	case DictKind:
+		return compareSeq(sortedSeq(v.seq, 2), sortedSeq(w.seq, 2), 2)
+	}
+	return 0
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// totalOrderKey maps the bits of a float to an unsigned integer which sorts in
+// the order of the IEEE 754 totalOrder predicate: negative numbers have their
+// bits reversed, and positive numbers sort after them.
+func totalOrderKey(bits uint64, size uint) uint64 {
+	sign := uint64(1) << (size - 1)
+	if bits&sign != 0 {
+		return ^bits & (sign<<1 - 1)
+	}
+	return bits | sign
+}
+
+// compareSeq compares sequences lexicographically, where each item is made up
+// of width consecutive values.
+func compareSeq(a, b []Value, width int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := a[i].Compare(b[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(int64(len(a)/width), int64(len(b)/width))
+}
+
+// sortedSeq returns a sorted copy of a sequence made up of items of width
+// consecutive values, where items are sorted by their first value.
+func sortedSeq(seq []Value, width int) []Value {
+	items := make([][]Value, 0, len(seq)/width)
+	for i := 0; i+width <= len(seq); i += width {
+		items = append(items, seq[i:i+width])
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i][0].Compare(items[j][0]) < 0
+	})
+	sorted := make([]Value, 0, len(seq))
+	for _, item := range items {
+		sorted = append(sorted, item...)
+	}
+	return sorted
+}
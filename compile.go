@@ -0,0 +1,366 @@
+package syrup
+
+import (
+	"math/big"
+	"reflect"
+	"sync"
+)
+
+// The Encoder and Decoder work out how to handle each type once, compiling it
+// into a tree of functions specialized to the type and its elements and
+// fields, which are cached for later values of the type.
+
+// encoderFunc encodes rv, a value of the type the function was compiled for.
+type encoderFunc func(e *Encoder, rv reflect.Value) error
+
+// decoderFunc decodes the value beginning with oper into v, a value of the
+// type the function was compiled for. target is the value v is reached from
+// through pointers, which is cleared when a nil sentinel is decoded.
+type decoderFunc func(d *Decoder, target, v reflect.Value, oper op) error
+
+// map[reflect.Type]encoderFunc
+var encoderCache sync.Map
+
+// map[reflect.Type]decoderFunc
+var decoderCache sync.Map
+
+// typeEncoder returns the compiled encoder of the type t.
+func typeEncoder(t reflect.Type) encoderFunc {
+	if f, ok := encoderCache.Load(t); ok {
+		return f.(encoderFunc)
+	}
+	// A recursive type refers to its own encoder while it is compiled, so
+	// cache one that waits for the compiled encoder in the meantime.
+	var wg sync.WaitGroup
+	var f encoderFunc
+	wg.Add(1)
+	fi, loaded := encoderCache.LoadOrStore(t, encoderFunc(func(e *Encoder, rv reflect.Value) error {
+		wg.Wait()
+		return f(e, rv)
+	}))
+	if loaded {
+		return fi.(encoderFunc)
+	}
+	f = newTypeEncoder(t)
+	wg.Done()
+	encoderCache.Store(t, f)
+	return f
+}
+
+// typeDecoder returns the compiled decoder of the type t.
+func typeDecoder(t reflect.Type) decoderFunc {
+	if f, ok := decoderCache.Load(t); ok {
+		return f.(decoderFunc)
+	}
+	var wg sync.WaitGroup
+	var f decoderFunc
+	wg.Add(1)
+	fi, loaded := decoderCache.LoadOrStore(t, decoderFunc(func(d *Decoder, target, v reflect.Value, oper op) error {
+		wg.Wait()
+		return f(d, target, v, oper)
+	}))
+	if loaded {
+		return fi.(decoderFunc)
+	}
+	f = newTypeDecoder(t)
+	wg.Done()
+	decoderCache.Store(t, f)
+	return f
+}
+
+// newTypeEncoder compiles the encoder of the type t. Nil values are handled
+// according to the Encoder's NilPolicy, and types registered as extensions of
+// the Encoder's Encoding are encoded as such.
+func newTypeEncoder(t reflect.Type) encoderFunc {
+	f := newValueEncoder(t)
+	nillable := false
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		nillable = true
+	}
+	return func(e *Encoder, rv reflect.Value) error {
+		if nillable && rv.IsNil() {
+			return e.encodeNil(rv)
+		}
+		if len(e.enc.extTypes) != 0 {
+			if x, ok := e.enc.extTypes[t]; ok {
+				return e.encodeExtension(rv, x)
+			}
+		}
+		return f(e, rv)
+	}
+}
+
+func newValueEncoder(t reflect.Type) encoderFunc {
+	if x, ok := lookupEnum(t); ok {
+		return newEnumEncoder(x)
+	}
+	if t == typeOfValue {
+		return func(e *Encoder, rv reflect.Value) error {
+			return e.encodeValue(rv.Interface().(Value))
+		}
+	}
+	if t.Kind() != reflect.Interface && t.Implements(typeOfMarshaler) {
+		return func(e *Encoder, rv reflect.Value) error {
+			return e.marshal(rv.Interface().(Marshaler))
+		}
+	}
+	f := newKindEncoder(t)
+	if reflect.PtrTo(t).Implements(typeOfMarshaler) {
+		// Only an addressable value has the pointer's methods.
+		return func(e *Encoder, rv reflect.Value) error {
+			if rv.CanAddr() {
+				return e.marshal(rv.Addr().Interface().(Marshaler))
+			}
+			return f(e, rv)
+		}
+	}
+	return f
+}
+
+func newKindEncoder(t reflect.Type) encoderFunc {
+	switch t.Kind() {
+	case reflect.Interface:
+		return func(e *Encoder, rv reflect.Value) error {
+			return e.encode(rv.Elem())
+		}
+	case reflect.String:
+		if t == typeOfSymbol {
+			return func(e *Encoder, rv reflect.Value) error {
+				return e.writeValue(e.enc.fmtSymbol(rv.String()))
+			}
+		}
+		return func(e *Encoder, rv reflect.Value) error {
+			return e.writeValue(e.enc.fmtString(rv.String()))
+		}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		return func(e *Encoder, rv reflect.Value) error {
+			return e.writeValue(e.enc.fmtInt(rv.Int()))
+		}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		return func(e *Encoder, rv reflect.Value) error {
+			return e.writeValue(e.enc.fmtUint(rv.Uint()))
+		}
+	case reflect.Bool:
+		return func(e *Encoder, rv reflect.Value) error {
+			return e.writeValue(e.enc.fmtBool(rv.Bool()))
+		}
+	case reflect.Float32:
+		return func(e *Encoder, rv reflect.Value) error {
+			return e.writeValue(e.enc.fmtFloat32(float32(rv.Float())))
+		}
+	case reflect.Float64:
+		return func(e *Encoder, rv reflect.Value) error {
+			return e.writeValue(e.enc.fmtFloat64(rv.Float()))
+		}
+	case reflect.Slice:
+		if t == typeOfByteSlice {
+			return func(e *Encoder, rv reflect.Value) error {
+				return e.writeValue(e.enc.fmtBytes(rv.Bytes()))
+			}
+		} else if t == typeOfSet {
+			return newElemsEncoder(t, openSetOp, closeSetOp)
+		}
+		return newElemsEncoder(t, openListOp, closeListOp)
+	case reflect.Array:
+		if t.Elem() == typeOfByte {
+			return func(e *Encoder, rv reflect.Value) error {
+				bs := make([]byte, rv.Len())
+				reflect.Copy(reflect.ValueOf(bs), rv)
+				return e.writeValue(e.enc.fmtBytes(bs))
+			}
+		}
+		return newElemsEncoder(t, openListOp, closeListOp)
+	case reflect.Ptr:
+		if t == typeOfBigInt {
+			return func(e *Encoder, rv reflect.Value) error {
+				return e.writeValue(e.enc.fmtBigInt(rv.Interface().(*big.Int)))
+			}
+		}
+		elem := typeEncoder(t.Elem())
+		return func(e *Encoder, rv reflect.Value) error {
+			return elem(e, rv.Elem())
+		}
+	case reflect.Map:
+		key, elem := typeEncoder(t.Key()), typeEncoder(t.Elem())
+		return func(e *Encoder, rv reflect.Value) error {
+			return e.encodeMap(rv, key, elem)
+		}
+	case reflect.Struct:
+		if t == typeOfBigIntValue {
+			return func(e *Encoder, rv reflect.Value) error {
+				if rv.CanAddr() {
+					return e.writeValue(e.enc.fmtBigInt(rv.Addr().Interface().(*big.Int)))
+				}
+				// A shallow copy of a big.Int shares its words, so only
+				// a deep copy of one is handed on.
+				bi := rv.Interface().(big.Int)
+				return e.writeValue(e.enc.fmtBigInt(new(big.Int).Set(&bi)))
+			}
+		} else if t == typeOfRecord {
+			return func(e *Encoder, rv reflect.Value) error {
+				return e.encodeRecord(rv.Interface().(Record))
+			}
+		}
+		m := buildCachedMetadata(t)
+		fields := make([]encoderField, len(m.fields))
+		for i, f := range m.fields {
+			fields[i] = encoderField{field: f, seg: f.name, enc: typeEncoder(f.t)}
+			if f.symbol {
+				fields[i].seg = Symbol(f.name)
+			}
+		}
+		if m.record {
+			return func(e *Encoder, rv reflect.Value) error {
+				return e.encodeRecordStruct(rv, fields)
+			}
+		}
+		return func(e *Encoder, rv reflect.Value) error {
+			return e.encodeStruct(rv, fields)
+		}
+	}
+	return func(e *Encoder, rv reflect.Value) error {
+		return &UnsupportedTypeError{Type: t, Path: e.pointer()}
+	}
+}
+
+func newElemsEncoder(t reflect.Type, open, close op) encoderFunc {
+	elem := typeEncoder(t.Elem())
+	return func(e *Encoder, rv reflect.Value) error {
+		if err := e.open(open); err != nil {
+			return err
+		}
+		if err := e.encodeElems(rv, elem); err != nil {
+			return err
+		}
+		return e.close(close)
+	}
+}
+
+// encoderField is a struct field with the compiled encoder of its type.
+type encoderField struct {
+	field
+	// seg is the segment of the field in the path to a value.
+	seg interface{}
+	enc encoderFunc
+}
+
+// newTypeDecoder compiles the decoder of the type t. Values whose pointers
+// implement Unmarshaler decode themselves, unless the value is the nil
+// sentinel.
+func newTypeDecoder(t reflect.Type) decoderFunc {
+	f := newPtrDecoder(t)
+	base := t
+	for base.Kind() == reflect.Ptr {
+		base = base.Elem()
+	}
+	if base.Kind() == reflect.Interface || !reflect.PtrTo(base).Implements(typeOfUnmarshaler) {
+		return f
+	}
+	return func(d *Decoder, target, v reflect.Value, oper op) error {
+		isNil, done, err := d.peekNilSentinel(oper)
+		if err != nil {
+			return err
+		}
+		defer done()
+		if isNil {
+			d.storeNil(target)
+			return nil
+		}
+		if u := indirect(v); u.CanAddr() {
+			return d.unmarshal(u.Addr().Interface().(Unmarshaler), oper)
+		}
+		return f(d, target, v, oper)
+	}
+}
+
+// newPtrDecoder compiles a decoder walking through pointers, as indirect
+// does, to the value being decoded into.
+func newPtrDecoder(t reflect.Type) decoderFunc {
+	f := newValueDecoder(t)
+	if t.Kind() != reflect.Ptr {
+		return f
+	}
+	elem := typeDecoder(t.Elem())
+	return func(d *Decoder, target, v reflect.Value, oper op) error {
+		if t == typeOfBigInt && v.CanSet() {
+			return f(d, target, v, oper)
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return elem(d, target, v.Elem(), oper)
+	}
+}
+
+func newValueDecoder(t reflect.Type) decoderFunc {
+	if x, ok := lookupEnum(t); ok {
+		return newEnumDecoder(t, x)
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == typeOfValue {
+			return func(d *Decoder, _, v reflect.Value, oper op) error {
+				x, err := d.decodeValue(oper)
+				if err == nil {
+					v.Set(reflect.ValueOf(x))
+				}
+				return err
+			}
+		}
+		m := buildCachedMetadata(t)
+		fields := make([]decoderField, len(m.fields))
+		for i, f := range m.fields {
+			fields[i] = decoderField{field: f, dec: typeDecoder(f.t)}
+		}
+		return func(d *Decoder, target, v reflect.Value, oper op) error {
+			switch {
+			case oper == openDictOp && m.record:
+				return &InvalidTypeError{Value: "dict", Type: v.Type(), Offset: d.n}
+			case oper == openDictOp:
+				return d.decodeStruct(v, fields, m.fieldNamesIndex)
+			case oper == openRecordOp && m.record:
+				return d.decodeRecordStruct(v, fields)
+			}
+			return d.decodeOp(target, v, oper)
+		}
+	case reflect.Slice, reflect.Array:
+		elem := typeDecoder(t.Elem())
+		return func(d *Decoder, target, v reflect.Value, oper op) error {
+			switch oper {
+			case openListOp:
+				return d.decodeElems(v, elem, closeListOp)
+			case openSetOp:
+				return d.decodeElems(v, elem, closeSetOp)
+			}
+			return d.decodeOp(target, v, oper)
+		}
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			break
+		}
+		return func(d *Decoder, target, v reflect.Value, oper op) error {
+			return d.decodeUnion(target, v, oper)
+		}
+	case reflect.Map:
+		if k := t.Key().Kind(); k != reflect.Interface && k != reflect.String {
+			break
+		}
+		key, elem := typeDecoder(t.Key()), typeDecoder(t.Elem())
+		return func(d *Decoder, target, v reflect.Value, oper op) error {
+			if oper == openDictOp {
+				return d.decodeMap(v, key, elem)
+			}
+			return d.decodeOp(target, v, oper)
+		}
+	}
+	return func(d *Decoder, target, v reflect.Value, oper op) error {
+		return d.decodeOp(target, v, oper)
+	}
+}
+
+// decoderField is a struct field with the compiled decoder of its type.
+type decoderField struct {
+	field
+	dec decoderFunc
+}
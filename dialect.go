@@ -0,0 +1,181 @@
+package syrup
+
+import (
+	"fmt"
+	"reflect"
+	"unicode"
+)
+
+// Delimiters are the bytes marking each kind of value in a Syrup-style
+// Encoding. Lengths and integers are always written as base 10 digits, and
+// floating point numbers are always written as big-endian IEEE 754 bytes.
+type Delimiters struct {
+	ListOpen    byte
+	ListClose   byte
+	DictOpen    byte
+	DictClose   byte
+	SetOpen     byte
+	SetClose    byte
+	RecordOpen  byte
+	RecordClose byte
+	// IntStart and IntEnd surround the digits of an integer.
+	IntStart byte
+	IntEnd   byte
+	True     byte
+	False    byte
+	// Float32 and Float64 precede the bytes of a floating point number.
+	Float32 byte
+	Float64 byte
+	// String, Symbol, and Bytes follow the length prefix of their
+	// respective values.
+	String byte
+	Symbol byte
+	Bytes  byte
+}
+
+// PrototypeDelimiters returns the delimiters of the prototypical syrup
+// encoding.
+func PrototypeDelimiters() Delimiters {
+	return Delimiters{
+		ListOpen:    '[',
+		ListClose:   ']',
+		DictOpen:    '{',
+		DictClose:   '}',
+		SetOpen:     '#',
+		SetClose:    '$',
+		RecordOpen:  '<',
+		RecordClose: '>',
+		IntStart:    'i',
+		IntEnd:      'e',
+		True:        't',
+		False:       'f',
+		Float32:     'F',
+		Float64:     'D',
+		String:      '"',
+		Symbol:      '\'',
+		Bytes:       ':',
+	}
+}
+
+// Extension adds a scalar type to an Encoding. Extension values are written
+// like strings: a length prefix, the Marker, and then the bytes produced by
+// Marshal.
+//
+// When encoding, values whose type is exactly Type are given to Marshal. When
+// decoding, the bytes following the Marker are given to Unmarshal, and the
+// result is stored into any Go value it is assignable to.
+type Extension struct {
+	Marker    byte
+	Type      reflect.Type
+	Marshal   func(v interface{}) ([]byte, error)
+	Unmarshal func(b []byte) (interface{}, error)
+}
+
+// EncodingOption customizes the Encoding built by NewEncoding.
+type EncodingOption func(*encodingOptions) error
+
+type encodingOptions struct {
+	delims Delimiters
+	exts   []Extension
+}
+
+// WithDelimiters replaces the PrototypeDelimiters used by default.
+func WithDelimiters(d Delimiters) EncodingOption {
+	return func(o *encodingOptions) error {
+		o.delims = d
+		return nil
+	}
+}
+
+// WithExtension adds an extension scalar type to the Encoding.
+func WithExtension(x Extension) EncodingOption {
+	return func(o *encodingOptions) error {
+		if x.Type == nil || x.Marshal == nil || x.Unmarshal == nil {
+			return fmt.Errorf("syrup: extension with marker %q is missing its type, marshal, or unmarshal", x.Marker)
+		}
+		o.exts = append(o.exts, x)
+		return nil
+	}
+}
+
+// NewEncoding builds a variant of the prototypical syrup encoding, reusing its
+// scanning and reflection while changing how values are marked. With no
+// options it is equivalent to NewPrototypeEncoding.
+//
+// An error is returned if the resulting Encoding would be ambiguous to decode,
+// such as when two delimiters are the same byte.
+func NewEncoding(opts ...EncodingOption) (*Encoding, error) {
+	o := &encodingOptions{delims: PrototypeDelimiters()}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	return o.delims.encoding(o.exts), nil
+}
+
+func (o *encodingOptions) validate() error {
+	d := o.delims
+	// Each group of bytes is examined by the scanner in the same state,
+	// so must be unique within that group.
+	top := map[string]byte{
+		"ListOpen":    d.ListOpen,
+		"ListClose":   d.ListClose,
+		"DictOpen":    d.DictOpen,
+		"DictClose":   d.DictClose,
+		"SetOpen":     d.SetOpen,
+		"SetClose":    d.SetClose,
+		"RecordOpen":  d.RecordOpen,
+		"RecordClose": d.RecordClose,
+		"IntStart":    d.IntStart,
+		"True":        d.True,
+		"False":       d.False,
+		"Float32":     d.Float32,
+		"Float64":     d.Float64,
+	}
+	length := map[string]byte{
+		"String": d.String,
+		"Symbol": d.Symbol,
+		"Bytes":  d.Bytes,
+	}
+	types := make(map[reflect.Type]bool, len(o.exts))
+	for _, x := range o.exts {
+		length[fmt.Sprintf("extension %s", x.Type)] = x.Marker
+		if types[x.Type] {
+			return fmt.Errorf("syrup: more than one extension for type %s", x.Type)
+		}
+		types[x.Type] = true
+	}
+	if err := validateDelimiterGroup(top, true); err != nil {
+		return err
+	}
+	if err := validateDelimiterGroup(length, false); err != nil {
+		return err
+	}
+	if isDigit(d.IntEnd) || d.IntEnd == '-' {
+		return fmt.Errorf("syrup: IntEnd delimiter %q cannot be a digit or '-'", d.IntEnd)
+	}
+	return nil
+}
+
+func validateDelimiterGroup(group map[string]byte, top bool) error {
+	seen := make(map[byte]string, len(group))
+	for name, b := range group {
+		if isDigit(b) {
+			return fmt.Errorf("syrup: %s delimiter %q cannot be a digit", name, b)
+		} else if top && unicode.IsSpace(rune(b)) {
+			return fmt.Errorf("syrup: %s delimiter %q cannot be whitespace", name, b)
+		} else if other, ok := seen[b]; ok {
+			return fmt.Errorf("syrup: %s and %s delimiters are both %q", name, other, b)
+		}
+		seen[b] = name
+	}
+	return nil
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
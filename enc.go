@@ -6,10 +6,15 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"reflect"
 	"strconv"
 	"unicode"
 )
 
+// Encoding describes how values are written to and read from bytes. An
+// Encoding holds no state of its own; all state needed while scanning lives in
+// each Decoder. An Encoding is therefore immutable once constructed and safe
+// for concurrent use by any number of Encoders and Decoders.
 type Encoding struct {
 	fmtString         func(s string) []byte
 	fmtBigInt         func(i *big.Int) []byte
@@ -20,6 +25,7 @@ type Encoding struct {
 	fmtFloat32        func(f float32) []byte
 	fmtBytes          func(b []byte) []byte
 	fmtSymbol         func(s string) []byte
+	fmtExtension      func(marker byte, b []byte) []byte
 	listOpen          func() []byte
 	listClose         func() []byte
 	dictOpen          func() []byte
@@ -32,172 +38,180 @@ type Encoding struct {
 	scanTokenLen      func(b byte) (scanState, op, bool, error)
 	scanFirstIntToken func(b byte) (scanState, op, bool, error)
 	scanIntToken      func(b byte) (scanState, op, bool, error)
-	scanFloat64Token  func(b byte) (scanState, op, bool, error)
-	scanFloat32Token  func(b byte) (scanState, op, bool, error)
-	parseLen          func(s string, next scanState) (op, uint64, error)
+	scanFloat64Token  func(n uint64) (scanState, op, bool, error)
+	scanFloat32Token  func(n uint64) (scanState, op, bool, error)
+	parseLen          func(s string, tag byte, next scanState) (scanState, op, uint64, error)
 	boolVal           func(b []byte) (bool, error)
 	symbolVal         func(b []byte) (Symbol, error)
 	stringVal         func(b []byte) (string, error)
 	int64Val          func(b []byte) (int64, *big.Int, error)
 	float32Val        func(b []byte) (float32, error)
 	float64Val        func(b []byte) (float64, error)
-	nlen              uint8 // For counting lengths of floating point encodings.
+	extTypes          map[reflect.Type]*Extension
+	extMarkers        map[byte]*Extension
 }
 
 // NewPrototypeEncoding returns the prototypical syrup encoding proposed.
 func NewPrototypeEncoding() *Encoding {
+	return PrototypeDelimiters().encoding(nil)
+}
+
+// encoding builds an Encoding using the delimiters and extensions, which must
+// already be validated.
+func (d Delimiters) encoding(exts []Extension) *Encoding {
 	e := &Encoding{
-		fmtString:         syrupProtoString,
-		fmtBigInt:         syrupProtoBigInt,
-		fmtInt:            syrupProtoInt,
-		fmtUint:           syrupProtoUint,
-		fmtBool:           syrupProtoBool,
-		fmtFloat64:        syrupProtoFloat64,
-		fmtFloat32:        syrupProtoFloat32,
-		fmtBytes:          syrupProtoBytes,
-		fmtSymbol:         syrupProtoSymbol,
-		listOpen:          syrupProtoListOpen,
-		listClose:         syrupProtoListClose,
-		dictOpen:          syrupProtoDictOpen,
-		dictClose:         syrupProtoDictClose,
-		setOpen:           syrupProtoSetOpen,
-		setClose:          syrupProtoSetClose,
-		recordOpen:        syrupProtoRecordOpen,
-		recordClose:       syrupProtoRecordClose,
-		scanTokenLen:      syrupProtoScanTokenLen,
-		scanFirstIntToken: syrupProtoScanFirstIntToken,
-		scanIntToken:      syrupProtoScanIntToken,
+		fmtString:         d.syrupString,
+		fmtBigInt:         d.syrupBigInt,
+		fmtInt:            d.syrupInt,
+		fmtUint:           d.syrupUint,
+		fmtBool:           d.syrupBool,
+		fmtFloat64:        d.syrupFloat64,
+		fmtFloat32:        d.syrupFloat32,
+		fmtBytes:          d.syrupBytes,
+		fmtSymbol:         d.syrupSymbol,
+		fmtExtension:      syrupProtoExtension,
+		listOpen:          d.syrupListOpen,
+		listClose:         d.syrupListClose,
+		dictOpen:          d.syrupDictOpen,
+		dictClose:         d.syrupDictClose,
+		setOpen:           d.syrupSetOpen,
+		setClose:          d.syrupSetClose,
+		recordOpen:        d.syrupRecordOpen,
+		recordClose:       d.syrupRecordClose,
+		mustFindToken:     d.syrupMustFindToken,
+		scanTokenLen:      d.syrupScanTokenLen,
+		scanFirstIntToken: d.syrupScanFirstIntToken,
+		scanIntToken:      d.syrupScanIntToken,
+		scanFloat64Token:  syrupProtoScanFloat64Token,
+		scanFloat32Token:  syrupProtoScanFloat32Token,
 		parseLen:          syrupProtoParsedLen,
-		boolVal:           syrupProtoBoolVal,
+		boolVal:           d.syrupBoolVal,
 		symbolVal:         syrupProtoSymbolVal,
 		stringVal:         syrupProtoStringVal,
 		int64Val:          syrupProtoInt64Val,
 		float32Val:        syrupProtoFloat32Val,
 		float64Val:        syrupProtoFloat64Val,
-		nlen:              0,
 	}
-	e.mustFindToken = func(b byte) (scanState, op, bool, error) {
-		s, o, in, err := syrupProtoMustFindToken(b)
-		if s == scanFloat32 {
-			e.nlen = 4
-		} else if s == scanFloat64 {
-			e.nlen = 8
+	if len(exts) > 0 {
+		e.extTypes = make(map[reflect.Type]*Extension, len(exts))
+		e.extMarkers = make(map[byte]*Extension, len(exts))
+		for i := range exts {
+			x := &exts[i]
+			e.extTypes[x.Type] = x
+			e.extMarkers[x.Marker] = x
 		}
-		return s, o, in, err
-	}
-	e.scanFloat64Token = func(b byte) (scanState, op, bool, error) {
-		if e.nlen == 0 {
-			return scanFindToken, noop, false, errors.New("missing float64 syrup delimiter or too many calls to parse float64")
-		}
-		e.nlen--
-		return syrupProtoScanFloat64Token(e.nlen)
-	}
-	e.scanFloat32Token = func(b byte) (scanState, op, bool, error) {
-		if e.nlen == 0 {
-			return scanFindToken, noop, false, errors.New("missing float32 syrup delimiter or too many calls to parse float32")
+		e.scanTokenLen = func(b byte) (scanState, op, bool, error) {
+			if _, ok := e.extMarkers[b]; ok {
+				return scanExtension, noop, false, nil
+			}
+			return d.syrupScanTokenLen(b)
 		}
-		e.nlen--
-		return syrupProtoScanFloat32Token(e.nlen)
 	}
 	return e
 }
 
-func syrupProtoString(s string) []byte {
-	b := append([]byte(strconv.FormatInt(int64(len(s)), 10)), '"')
+func (d Delimiters) syrupString(s string) []byte {
+	b := append([]byte(strconv.FormatInt(int64(len(s)), 10)), d.String)
 	b = append(b, []byte(s)...)
 	return b
 }
 
-func syrupProtoBigInt(i *big.Int) []byte {
-	b := append([]byte{'i'},
+func (d Delimiters) syrupBigInt(i *big.Int) []byte {
+	b := append([]byte{d.IntStart},
 		[]byte(i.Text(10))...)
-	b = append(b, 'e')
+	b = append(b, d.IntEnd)
 	return b
 }
 
-func syrupProtoInt(i int64) []byte {
-	b := append([]byte{'i'},
+func (d Delimiters) syrupInt(i int64) []byte {
+	b := append([]byte{d.IntStart},
 		[]byte(strconv.FormatInt(i, 10))...)
-	b = append(b, 'e')
+	b = append(b, d.IntEnd)
 	return b
 }
 
-func syrupProtoUint(i uint64) []byte {
-	b := append([]byte{'i'},
+func (d Delimiters) syrupUint(i uint64) []byte {
+	b := append([]byte{d.IntStart},
 		[]byte(strconv.FormatUint(i, 10))...)
-	b = append(b, 'e')
+	b = append(b, d.IntEnd)
 	return b
 }
 
-func syrupProtoBool(b bool) []byte {
+func (d Delimiters) syrupBool(b bool) []byte {
 	if b {
-		return []byte{'t'}
+		return []byte{d.True}
 	} else {
-		return []byte{'f'}
+		return []byte{d.False}
 	}
 }
 
-func syrupProtoFloat64(f float64) []byte {
+func (d Delimiters) syrupFloat64(f float64) []byte {
 	b := make([]byte, 9)
-	b[0] = 'D'
+	b[0] = d.Float64
 	binary.BigEndian.PutUint64(b[1:], math.Float64bits(f))
 	return b
 }
 
-func syrupProtoFloat32(f float32) []byte {
+func (d Delimiters) syrupFloat32(f float32) []byte {
 	b := make([]byte, 5)
-	b[0] = 'F'
+	b[0] = d.Float32
 	binary.BigEndian.PutUint32(b[1:], math.Float32bits(f))
 	return b
 }
 
-func syrupProtoBytes(s []byte) []byte {
-	b := append([]byte(strconv.FormatInt(int64(len(s)), 10)), ':')
+func (d Delimiters) syrupBytes(s []byte) []byte {
+	b := append([]byte(strconv.FormatInt(int64(len(s)), 10)), d.Bytes)
+	b = append(b, s...)
+	return b
+}
+
+func syrupProtoExtension(marker byte, s []byte) []byte {
+	b := append([]byte(strconv.FormatInt(int64(len(s)), 10)), marker)
 	b = append(b, s...)
 	return b
 }
 
-func syrupProtoListOpen() []byte {
-	return []byte{'['}
+func (d Delimiters) syrupListOpen() []byte {
+	return []byte{d.ListOpen}
 }
 
-func syrupProtoListClose() []byte {
-	return []byte{']'}
+func (d Delimiters) syrupListClose() []byte {
+	return []byte{d.ListClose}
 }
 
-func syrupProtoDictOpen() []byte {
-	return []byte{'{'}
+func (d Delimiters) syrupDictOpen() []byte {
+	return []byte{d.DictOpen}
 }
 
-func syrupProtoDictClose() []byte {
-	return []byte{'}'}
+func (d Delimiters) syrupDictClose() []byte {
+	return []byte{d.DictClose}
 }
 
-func syrupProtoSymbol(s string) []byte {
-	b := append([]byte(strconv.FormatInt(int64(len(s)), 10)), '\'')
+func (d Delimiters) syrupSymbol(s string) []byte {
+	b := append([]byte(strconv.FormatInt(int64(len(s)), 10)), d.Symbol)
 	b = append(b, []byte(s)...)
 	return b
 }
 
-func syrupProtoSetOpen() []byte {
-	return []byte{'#'}
+func (d Delimiters) syrupSetOpen() []byte {
+	return []byte{d.SetOpen}
 }
 
-func syrupProtoSetClose() []byte {
-	return []byte{'$'}
+func (d Delimiters) syrupSetClose() []byte {
+	return []byte{d.SetClose}
 }
 
-func syrupProtoRecordOpen() []byte {
-	return []byte{'<'}
+func (d Delimiters) syrupRecordOpen() []byte {
+	return []byte{d.RecordOpen}
 }
 
-func syrupProtoRecordClose() []byte {
-	return []byte{'>'}
+func (d Delimiters) syrupRecordClose() []byte {
+	return []byte{d.RecordClose}
 }
 
 // Determines the next scan state, whether to use the passed-in byte as part of
 // further processing, and any errors.
-func syrupProtoMustFindToken(b byte) (scanState, op, bool, error) {
+func (d Delimiters) syrupMustFindToken(b byte) (scanState, op, bool, error) {
 	if unicode.IsSpace(rune(b)) {
 		return scanFindToken, noop, false, nil
 	}
@@ -222,38 +236,38 @@ func syrupProtoMustFindToken(b byte) (scanState, op, bool, error) {
 		fallthrough
 	case '9':
 		return scanTokenLen, noop, true, nil
-	case 'i':
+	case d.IntStart:
 		return scanFirstInt, noop, false, nil
-	case 't':
+	case d.True:
 		fallthrough
-	case 'f':
+	case d.False:
 		return scanFindToken, valBoolop, true, nil
-	case 'F':
+	case d.Float32:
 		return scanFloat32, noop, false, nil
-	case 'D':
+	case d.Float64:
 		return scanFloat64, noop, false, nil
-	case '[':
+	case d.ListOpen:
 		return scanFindToken, openListOp, false, nil
-	case '{':
+	case d.DictOpen:
 		return scanFindToken, openDictOp, false, nil
-	case '#':
+	case d.SetOpen:
 		return scanFindToken, openSetOp, false, nil
-	case '<':
+	case d.RecordOpen:
 		return scanFindToken, openRecordOp, false, nil
-	case ']':
+	case d.ListClose:
 		return scanFindToken, closeListOp, false, nil
-	case '}':
+	case d.DictClose:
 		return scanFindToken, closeDictOp, false, nil
-	case '$':
+	case d.SetClose:
 		return scanFindToken, closeSetOp, false, nil
-	case '>':
+	case d.RecordClose:
 		return scanFindToken, closeRecordOp, false, nil
 	default:
 		return scanFindToken, noop, false, fmt.Errorf("could not determine token for byte: %v", b)
 	}
 }
 
-func syrupProtoScanTokenLen(b byte) (scanState, op, bool, error) {
+func (d Delimiters) syrupScanTokenLen(b byte) (scanState, op, bool, error) {
 	switch b {
 	case '0':
 		fallthrough
@@ -275,18 +289,18 @@ func syrupProtoScanTokenLen(b byte) (scanState, op, bool, error) {
 		fallthrough
 	case '9':
 		return scanTokenLen, noop, true, nil
-	case '\'':
+	case d.Symbol:
 		return scanSymbol, noop, false, nil
-	case '"':
+	case d.String:
 		return scanString, noop, false, nil
-	case ':':
+	case d.Bytes:
 		return scanByteArr, noop, false, nil
 	default:
 		return scanFindToken, noop, false, fmt.Errorf("malformed input during len scanning: %v", b)
 	}
 }
 
-func syrupProtoScanFirstIntToken(b byte) (scanState, op, bool, error) {
+func (d Delimiters) syrupScanFirstIntToken(b byte) (scanState, op, bool, error) {
 	switch b {
 	case '-':
 		fallthrough
@@ -310,14 +324,14 @@ func syrupProtoScanFirstIntToken(b byte) (scanState, op, bool, error) {
 		fallthrough
 	case '9':
 		return scanInt, noop, true, nil
-	case 'e':
+	case d.IntEnd:
 		return scanFindToken, valIntOp, false, nil
 	default:
 		return scanFindToken, noop, false, fmt.Errorf("malformed input during int scanning: %v", b)
 	}
 }
 
-func syrupProtoScanIntToken(b byte) (scanState, op, bool, error) {
+func (d Delimiters) syrupScanIntToken(b byte) (scanState, op, bool, error) {
 	switch b {
 	case '0':
 		fallthrough
@@ -339,14 +353,14 @@ func syrupProtoScanIntToken(b byte) (scanState, op, bool, error) {
 		fallthrough
 	case '9':
 		return scanInt, noop, true, nil
-	case 'e':
+	case d.IntEnd:
 		return scanFindToken, valIntOp, false, nil
 	default:
 		return scanFindToken, noop, false, fmt.Errorf("malformed input during int scanning: %v", b)
 	}
 }
 
-func syrupProtoScanFloat32Token(n uint8) (scanState, op, bool, error) {
+func syrupProtoScanFloat32Token(n uint64) (scanState, op, bool, error) {
 	if n == 0 {
 		return scanFindToken, valFloat32Op, true, nil
 	} else {
@@ -354,7 +368,7 @@ func syrupProtoScanFloat32Token(n uint8) (scanState, op, bool, error) {
 	}
 }
 
-func syrupProtoScanFloat64Token(n uint8) (scanState, op, bool, error) {
+func syrupProtoScanFloat64Token(n uint64) (scanState, op, bool, error) {
 	if n == 0 {
 		return scanFindToken, valFloat64Op, true, nil
 	} else {
@@ -362,11 +376,12 @@ func syrupProtoScanFloat64Token(n uint8) (scanState, op, bool, error) {
 	}
 }
 
-func syrupProtoParsedLen(s string, next scanState) (do op, l uint64, err error) {
-	l, err = strconv.ParseUint(s, 10, 64)
+func syrupProtoParsedLen(s string, _ byte, next scanState) (scanState, op, uint64, error) {
+	l, err := strconv.ParseUint(s, 10, 64)
 	if err != nil {
-		return
+		return next, noop, 0, err
 	}
+	var do op
 	if l == 0 {
 		switch next {
 		case scanSymbol:
@@ -375,20 +390,22 @@ func syrupProtoParsedLen(s string, next scanState) (do op, l uint64, err error)
 			do = valStringOp
 		case scanByteArr:
 			do = valByteArrOp
+		case scanExtension:
+			do = valExtensionOp
 		default:
 			err = fmt.Errorf("syrup len parsing bad state: %v", next)
 		}
 	}
-	return
+	return next, do, l, err
 }
 
-func syrupProtoBoolVal(b []byte) (bool, error) {
+func (d Delimiters) syrupBoolVal(b []byte) (bool, error) {
 	if len(b) != 1 {
 		return false, fmt.Errorf("syrup bool val len %d", len(b))
 	}
-	if b[0] == 't' {
+	if b[0] == d.True {
 		return true, nil
-	} else if b[0] == 'f' {
+	} else if b[0] == d.False {
 		return false, nil
 	}
 	return false, fmt.Errorf("syrup bool unknown value: %v", b)
@@ -0,0 +1,152 @@
+package syrup
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// enum holds the symbols registered for an integer type.
+type enum struct {
+	// symbols are ordered by the values they stand for.
+	symbols []Symbol
+	symbol  func(rv reflect.Value) (Symbol, bool)
+	value   func(s Symbol) (reflect.Value, bool)
+}
+
+var (
+	enumsMu sync.RWMutex
+	enums   = make(map[reflect.Type]*enum)
+)
+
+// RegisterEnum registers the symbols standing for the values of an integer
+// type, so that values of the type are encoded as their symbols rather than
+// as integers, and decoded from them:
+//
+//	syrup.RegisterEnum(map[Status]syrup.Symbol{
+//		Pending:   "pending",
+//		Fulfilled: "fulfilled",
+//		Broken:    "broken",
+//	})
+//
+// Encoding a value without a symbol results in an *UnsupportedValueError, and
+// decoding a symbol other than those registered, or a value other than a
+// symbol, results in an *EnumError or *InvalidTypeError respectively.
+//
+// RegisterEnum must be called before any value of the type is encoded or
+// decoded, typically from an init function. It panics if it has been, if the
+// type already has symbols registered or implements Marshaler or Unmarshaler,
+// or if two values share a symbol.
+func RegisterEnum[T ~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64](symbols map[T]Symbol) {
+	t := reflect.TypeOf(T(0))
+	if t.Implements(typeOfMarshaler) || reflect.PtrTo(t).Implements(typeOfMarshaler) ||
+		reflect.PtrTo(t).Implements(typeOfUnmarshaler) {
+		panic(fmt.Sprintf("syrup: RegisterEnum given %v, which encodes or decodes itself", t))
+	}
+	if _, ok := encoderCache.Load(t); ok {
+		panic(fmt.Sprintf("syrup: RegisterEnum given %v after values of it were encoded", t))
+	} else if _, ok := decoderCache.Load(t); ok {
+		panic(fmt.Sprintf("syrup: RegisterEnum given %v after values of it were decoded", t))
+	}
+	bySymbol := make(map[Symbol]T, len(symbols))
+	byValue := make(map[T]Symbol, len(symbols))
+	values := make([]T, 0, len(symbols))
+	for v, s := range symbols {
+		if other, ok := bySymbol[s]; ok {
+			panic(fmt.Sprintf("syrup: RegisterEnum given values %v and %v of %v, which are both %s", other, v, t, s))
+		}
+		bySymbol[s] = v
+		byValue[v] = s
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	x := &enum{
+		symbols: make([]Symbol, len(values)),
+		symbol: func(rv reflect.Value) (Symbol, bool) {
+			s, ok := byValue[rv.Interface().(T)]
+			return s, ok
+		},
+		value: func(s Symbol) (reflect.Value, bool) {
+			v, ok := bySymbol[s]
+			return reflect.ValueOf(v), ok
+		},
+	}
+	for i, v := range values {
+		x.symbols[i] = byValue[v]
+	}
+	enumsMu.Lock()
+	defer enumsMu.Unlock()
+	if _, ok := enums[t]; ok {
+		panic(fmt.Sprintf("syrup: RegisterEnum given %v, which already has symbols", t))
+	}
+	enums[t] = x
+}
+
+// EnumSymbols returns the symbols registered for the type t by RegisterEnum,
+// ordered by the values they stand for, or nil if it has none.
+func EnumSymbols(t reflect.Type) []Symbol {
+	if x, ok := lookupEnum(t); ok {
+		return append([]Symbol(nil), x.symbols...)
+	}
+	return nil
+}
+
+func lookupEnum(t reflect.Type) (*enum, bool) {
+	enumsMu.RLock()
+	defer enumsMu.RUnlock()
+	x, ok := enums[t]
+	return x, ok
+}
+
+// EnumError is returned when decoding a symbol that is not one of those
+// registered for a type by RegisterEnum.
+type EnumError struct {
+	Symbol Symbol
+	Type   reflect.Type
+	Offset uint64
+}
+
+func (e *EnumError) Error() string {
+	names := make([]string, 0)
+	for _, s := range EnumSymbols(e.Type) {
+		names = append(names, string(s))
+	}
+	return fmt.Sprintf("syrup: cannot decode symbol %s into Go value of type %s, whose symbols are %s, at byte offset %d", e.Symbol, e.Type, strings.Join(names, ", "), e.Offset)
+}
+
+func newEnumEncoder(x *enum) encoderFunc {
+	return func(e *Encoder, rv reflect.Value) error {
+		s, ok := x.symbol(rv)
+		if !ok {
+			return e.valueError(rv, fmt.Sprintf("%v without a symbol", rv))
+		}
+		return e.writeValue(e.enc.fmtSymbol(string(s)))
+	}
+}
+
+func newEnumDecoder(t reflect.Type, x *enum) decoderFunc {
+	return func(d *Decoder, target, v reflect.Value, oper op) error {
+		if oper == openRecordOp {
+			// Only a nil sentinel is accepted.
+			return d.decodeOp(target, v, oper)
+		} else if oper != valSymbolOp {
+			return d.typeError(oper, t)
+		}
+		s, err := d.s.Symbol()
+		d.n++
+		if err != nil {
+			return err
+		} else if d.isNilSentinel(s) {
+			d.storeNil(target)
+			return nil
+		}
+		ev, ok := x.value(s)
+		if !ok {
+			return &EnumError{Symbol: s, Type: t, Offset: d.n}
+		}
+		v.Set(ev)
+		return nil
+	}
+}
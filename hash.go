@@ -0,0 +1,48 @@
+package syrup
+
+import (
+	"hash"
+	"io"
+)
+
+// Hash writes the canonical encoding of v, using the prototype encoding, into
+// h. Values that are Equal have the same canonical encoding, so encoders on
+// either end compute the same hash for them. Bytes are written to h as they
+// are encoded, except that the contents of each dictionary and set are
+// buffered until they are sorted.
+func Hash(h hash.Hash, v interface{}) error {
+	e := NewEncoder(NewPrototypeEncoding(), h)
+	e.SetCanonical(true)
+	return e.Encode(v)
+}
+
+// Digest returns the hash of the canonical encoding of v, using a new hash
+// from newHash, such as sha256.New.
+func Digest(newHash func() hash.Hash, v interface{}) ([]byte, error) {
+	h := newHash()
+	if err := Hash(h, v); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// HashingEncoder is an Encoder that also writes everything it encodes into a
+// hash, so the hash of the encoded stream is known once encoding is done.
+type HashingEncoder struct {
+	*Encoder
+	h hash.Hash
+}
+
+// NewHashingEncoder creates an encoder writing encoded values to both 'w' and
+// 'h'. It encodes canonically unless told otherwise with SetCanonical.
+func NewHashingEncoder(enc *Encoding, w io.Writer, h hash.Hash) *HashingEncoder {
+	e := NewEncoder(enc, io.MultiWriter(w, h))
+	e.SetCanonical(true)
+	return &HashingEncoder{Encoder: e, h: h}
+}
+
+// Sum appends the hash of everything encoded so far to b and returns the
+// resulting slice.
+func (e *HashingEncoder) Sum(b []byte) []byte {
+	return e.h.Sum(b)
+}
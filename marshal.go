@@ -0,0 +1,112 @@
+package syrup
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Marshaler is implemented by types that encode themselves, typically using
+// the Encoder's Encode and EncodeToken methods. MarshalSyrup must write
+// exactly one whole value.
+type Marshaler interface {
+	MarshalSyrup(e *Encoder) error
+}
+
+// Unmarshaler is implemented by types that decode themselves, typically using
+// the Decoder's Token and Decode methods. UnmarshalSyrup must read exactly one
+// whole value.
+type Unmarshaler interface {
+	UnmarshalSyrup(d *Decoder) error
+}
+
+// Labeler is implemented by struct types that are encoded as records rather
+// than dictionaries. The record is labeled with the result of SyrupLabel, and
+// holds the exported fields of the struct in order. Decoding a record into
+// such a struct requires the label and the number of values to match.
+type Labeler interface {
+	SyrupLabel() Symbol
+}
+
+var (
+	typeOfMarshaler   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	typeOfUnmarshaler = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	typeOfLabeler     = reflect.TypeOf((*Labeler)(nil)).Elem()
+)
+
+func (e *Encoder) marshal(m Marshaler) error {
+	// Values encoded by the Marshaler are nested within this one, so keep
+	// the path to it.
+	e.nested++
+	defer func() { e.nested-- }()
+	return m.MarshalSyrup(e)
+}
+
+// unmarshal hands the value beginning with oper to the Unmarshaler.
+func (d *Decoder) unmarshal(u Unmarshaler, oper op) error {
+	d.pending = oper
+	err := u.UnmarshalSyrup(d)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && d.pending != noop {
+		err = fmt.Errorf("syrup: %T.UnmarshalSyrup did not read the value at byte offset %d", u, d.n)
+	}
+	d.pending = noop
+	return err
+}
+
+// labelOf returns the label of the records a Labeler struct is encoded as.
+func labelOf(v reflect.Value) Symbol {
+	if v.CanAddr() {
+		return v.Addr().Interface().(Labeler).SyrupLabel()
+	}
+	return reflect.New(v.Type()).Interface().(Labeler).SyrupLabel()
+}
+
+func (e *Encoder) encodeRecordStruct(rv reflect.Value, fields []encoderField) error {
+	if err := e.open(openRecordOp); err != nil {
+		return err
+	}
+	e.push(RecordLabel{})
+	if err := e.writeValue(e.enc.fmtSymbol(string(labelOf(rv)))); err != nil {
+		return err
+	}
+	e.pop()
+	for i, f := range fields {
+		e.push(i)
+		if err := f.enc(e, rv.Field(f.fieldIdx)); err != nil {
+			return err
+		}
+		e.pop()
+	}
+	return e.close(closeRecordOp)
+}
+
+func (d *Decoder) decodeRecordStruct(v reflect.Value, fields []decoderField) error {
+	var label interface{}
+	if _, err := d.runKey(reflect.ValueOf(&label), nil); err != nil {
+		return err
+	}
+	if want := labelOf(v); label != want {
+		return &InvalidTypeError{Value: fmt.Sprintf("record labeled %v", label), Type: v.Type(), Offset: d.n}
+	}
+	n := 0
+	for ; ; n++ {
+		var fv reflect.Value
+		var dec decoderFunc
+		if n < len(fields) {
+			fv, dec = v.Field(fields[n].fieldIdx), fields[n].dec
+		}
+		last, err := d.runDecoder(fv, dec)
+		if err != nil {
+			return err
+		} else if last == closeRecordOp {
+			break
+		}
+	}
+	if n != len(fields) {
+		return &InvalidTypeError{Value: fmt.Sprintf("record of %d values", n), Type: v.Type(), Offset: d.n}
+	}
+	return nil
+}
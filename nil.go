@@ -0,0 +1,205 @@
+package syrup
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// NilPolicy determines how an Encoder handles nil pointers, maps, slices, and
+// interfaces, none of which have a direct Syrup representation.
+type NilPolicy uint8
+
+const (
+	// NilIsError fails encoding of nil values with an
+	// *UnsupportedValueError. This is the default policy.
+	NilIsError NilPolicy = iota
+	// NilAsEmpty encodes nil maps as empty dictionaries, nil slices as
+	// empty lists, sets, or bytestrings, and nil pointers as the zero value
+	// of the type pointed to. Nil interfaces have no type to take an empty
+	// value of, so they remain an error.
+	NilAsEmpty
+	// NilOmitted omits struct fields and dictionary entries whose value is
+	// nil. Omitting any other nil value would change the shape of its
+	// container, so they remain an error.
+	NilOmitted
+	// NilAsSentinel encodes nil values as the Encoder's nil sentinel, which
+	// is the DefaultNilSentinel unless changed with SetNilSentinel.
+	NilAsSentinel
+)
+
+// DefaultNilSentinel returns the `<void>` record used to stand in for nil
+// values under the NilAsSentinel policy.
+func DefaultNilSentinel() Record {
+	return Record{Label: Symbol("void")}
+}
+
+// SetNilPolicy determines how the Encoder handles nil values. The default is
+// NilIsError.
+func (e *Encoder) SetNilPolicy(p NilPolicy) {
+	e.nilPolicy = p
+}
+
+// NilPolicy returns how the Encoder handles nil values.
+func (e *Encoder) NilPolicy() NilPolicy {
+	return e.nilPolicy
+}
+
+// SetNilSentinel sets the value encoded in place of nil values under the
+// NilAsSentinel policy. A Symbol or Record is recommended, as those are the
+// sentinels a Decoder is able to map back into nil.
+func (e *Encoder) SetNilSentinel(v interface{}) {
+	e.nilSentinel = v
+}
+
+// SetNilSentinel makes the Decoder store the zero value, which is nil for
+// pointers, maps, slices, and interfaces, whenever it decodes a value equal
+// to the sentinel. Record labels and dictionary keys are never taken to be
+// the sentinel. The sentinel must be a Symbol or Record. Passing nil turns off
+// sentinel detection, which is the default.
+func (d *Decoder) SetNilSentinel(v interface{}) error {
+	if v == nil {
+		d.nilSentinel = nil
+		d.nilSentinelBytes = nil
+		return nil
+	}
+	switch v.(type) {
+	case Symbol, Record:
+	default:
+		return fmt.Errorf("syrup: nil sentinel must be a Symbol or Record, got %T", v)
+	}
+	b, err := d.encodeSentinel(v)
+	if err != nil {
+		return err
+	}
+	d.nilSentinel = v
+	d.nilSentinelBytes = b
+	return nil
+}
+
+// NilSentinel returns the sentinel the Decoder decodes as nil, or nil when
+// sentinel detection is off.
+func (d *Decoder) NilSentinel() interface{} {
+	return d.nilSentinel
+}
+
+func (d *Decoder) encodeSentinel(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := NewEncoder(d.s.enc, &buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isNilSentinel determines whether the decoded Symbol or Record matches the
+// Decoder's nil sentinel.
+func (d *Decoder) isNilSentinel(v interface{}) bool {
+	if d.nilSentinel == nil || reflect.TypeOf(v) != reflect.TypeOf(d.nilSentinel) {
+		return false
+	}
+	b, err := d.encodeSentinel(v)
+	return err == nil && bytes.Equal(b, d.nilSentinelBytes)
+}
+
+// peekNilSentinel determines whether the value beginning with oper is the
+// Decoder's nil sentinel, before an Unmarshaler is given the value to read. A
+// matching value is consumed. Otherwise the bytes read are arranged to be read
+// again, and calling done once the value has been read stops the arrangement.
+func (d *Decoder) peekNilSentinel(oper op) (ok bool, done func(), err error) {
+	done = func() {}
+	if d.nilSentinel == nil {
+		return false, done, nil
+	}
+	switch oper {
+	case valSymbolOp:
+		s, err := d.s.enc.symbolVal([]byte(d.s.buf.String()))
+		if err != nil || !d.isNilSentinel(s) {
+			return false, done, nil
+		}
+		_, err = d.decodeValue(oper)
+		return err == nil, done, err
+	case openRecordOp:
+	default:
+		return false, done, nil
+	}
+	r, n := d.r, d.n
+	open := append([]op(nil), d.s.open...)
+	var buf bytes.Buffer
+	d.r = io.TeeReader(r, &buf)
+	x, err := d.decodeValue(oper)
+	d.r = r
+	if err != nil {
+		return false, nil, err
+	} else if Equal(x, d.nilSentinel) {
+		return true, done, nil
+	}
+	d.r, d.n, d.s.open = io.MultiReader(&buf, r), n, open
+	done = func() {
+		// Bytes left unread after an error remain to be read.
+		if buf.Len() == 0 {
+			d.r = r
+		}
+	}
+	return false, done, nil
+}
+
+// storeNil sets the value being decoded into to its zero value. The pointer
+// given to Decode is not itself settable, so the value it points to is
+// cleared instead.
+func (d *Decoder) storeNil(v reflect.Value) {
+	for v.Kind() == reflect.Ptr && !v.CanSet() {
+		v = v.Elem()
+	}
+	v.Set(reflect.Zero(v.Type()))
+}
+
+func isNilValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	default:
+		return false
+	}
+}
+
+func (e *Encoder) encodeNil(rv reflect.Value) error {
+	var str string
+	switch rv.Kind() {
+	case reflect.Invalid:
+		str = "nil value"
+	case reflect.Interface:
+		str = "nil interface"
+	case reflect.Ptr:
+		str = "nil pointer"
+	case reflect.Map:
+		str = "nil map"
+	case reflect.Slice:
+		str = "nil slice"
+	}
+	switch e.nilPolicy {
+	case NilAsEmpty:
+		switch rv.Kind() {
+		case reflect.Ptr:
+			return e.encode(reflect.Zero(rv.Type().Elem()))
+		case reflect.Map:
+			return e.encode(reflect.MakeMap(rv.Type()))
+		case reflect.Slice:
+			return e.encode(reflect.MakeSlice(rv.Type(), 0, 0))
+		}
+	case NilAsSentinel:
+		if e.nilSentinel == nil {
+			return e.valueError(rv, str+" with no nil sentinel")
+		}
+		return e.encode(reflect.ValueOf(e.nilSentinel))
+	}
+	return e.valueError(rv, str)
+}
+
+// omitNil determines whether a struct field or dictionary entry is omitted
+// from encoding.
+func (e *Encoder) omitNil(rv reflect.Value) bool {
+	return e.nilPolicy == NilOmitted && isNilValue(rv)
+}
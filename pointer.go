@@ -0,0 +1,368 @@
+package syrup
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Pointer addresses a value nested within another, similar to a JSON Pointer.
+// Each step is one of:
+//
+//   - a string, naming a dictionary key or a struct field
+//   - a Symbol, naming a dictionary key or a struct field
+//   - RecordLabel, naming the label of a record
+//   - an int, indexing a list, set, or record value, or naming an integer
+//     dictionary key
+//
+// The empty Pointer addresses the value itself.
+//
+// The text form of a Pointer writes each step after a '/', using the Preserves
+// text syntax, and RecordLabel as <label>: /"manifest"/3/<label> addresses the
+// label of the record at index 3 of the list under the "manifest" key, while
+// /"manifest"/3/label would address the value of a dictionary there keyed by
+// the symbol label.
+type Pointer []interface{}
+
+// RecordLabel is the Pointer step naming the label of a record.
+type RecordLabel struct{}
+
+// ParsePointer parses the text form of a Pointer.
+func ParsePointer(s string) (Pointer, error) {
+	p := Pointer{}
+	for len(s) > 0 {
+		if s[0] != '/' {
+			return nil, fmt.Errorf("syrup: pointer step must begin with '/': %q", s)
+		}
+		s = s[1:]
+		if len(s) > 0 && (s[0] == '"' || s[0] == '|') {
+			d := NewTextDecoder(strings.NewReader(s))
+			d.readByte()
+			q, err := d.quoted(s[0])
+			if err != nil {
+				return nil, fmt.Errorf("syrup: malformed pointer step %q: %v", s, err)
+			}
+			if s[0] == '"' {
+				p = append(p, q)
+			} else {
+				p = append(p, Symbol(q))
+			}
+			s = s[d.n:]
+			continue
+		}
+		step := s
+		if i := strings.IndexByte(s, '/'); i >= 0 {
+			step = s[:i]
+		}
+		s = s[len(step):]
+		switch {
+		case len(step) == 0:
+			return nil, fmt.Errorf("syrup: empty pointer step")
+		case step == "<label>":
+			p = append(p, RecordLabel{})
+		case !looksNumeric(step):
+			p = append(p, Symbol(step))
+		default:
+			i, err := strconv.Atoi(step)
+			if err != nil {
+				return nil, fmt.Errorf("syrup: malformed pointer step %q", step)
+			}
+			p = append(p, i)
+		}
+	}
+	return p, nil
+}
+
+// String returns the text form of p.
+func (p Pointer) String() string {
+	var sb strings.Builder
+	for _, step := range p {
+		sb.WriteByte('/')
+		switch s := step.(type) {
+		case string:
+			writeStringText(&sb, s)
+		case RecordLabel:
+			sb.WriteString("<label>")
+		case Symbol:
+			if isBareSymbol(string(s)) && !strings.Contains(string(s), "/") {
+				sb.WriteString(string(s))
+			} else {
+				writeQuotedSymbolText(&sb, s)
+			}
+		default:
+			p := &Printer{}
+			sb.WriteString(p.Sprint(step))
+		}
+	}
+	return sb.String()
+}
+
+// Get returns the value p addresses within v, which may be a decoded value, a
+// Value, or any Go value made of structs, slices, arrays, and maps.
+func (p Pointer) Get(v interface{}) (interface{}, error) {
+	cur := reflect.ValueOf(v)
+	for i, step := range p {
+		next, err := pointerStep(cur, step)
+		if err != nil {
+			return nil, p.error(i, err)
+		}
+		cur = next
+	}
+	if !cur.IsValid() {
+		return nil, nil
+	}
+	return cur.Interface(), nil
+}
+
+// Set replaces the value p addresses within the value pointed to by root with
+// v. Dictionary entries are added when the final step names a key that does
+// not exist. When v is not assignable to the addressed location, it is
+// converted as if encoded and then decoded into it.
+func (p Pointer) Set(root interface{}, v interface{}) error {
+	rv := reflect.ValueOf(root)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &InvalidDecodeError{reflect.TypeOf(root)}
+	}
+	return p.set(rv.Elem(), 0, v)
+}
+
+func (p Pointer) error(i int, err error) error {
+	return fmt.Errorf("syrup: pointer %s: at %s: %v", p, p[:i+1], err)
+}
+
+// pointerKey returns the Value of a step used as a dictionary key.
+func pointerKey(step interface{}) Value {
+	switch s := step.(type) {
+	case string:
+		return NewString(s)
+	case Symbol:
+		return NewSymbol(s)
+	case int:
+		return NewInt(int64(s))
+	}
+	return Value{}
+}
+
+// pointerStep returns the value within cur named by the step.
+func pointerStep(cur reflect.Value, step interface{}) (reflect.Value, error) {
+	for cur.IsValid() && (cur.Kind() == reflect.Ptr || cur.Kind() == reflect.Interface) {
+		cur = cur.Elem()
+	}
+	if !cur.IsValid() {
+		return cur, fmt.Errorf("no value")
+	}
+	index, isIndex := step.(int)
+	switch {
+	case cur.Type() == typeOfValue:
+		x := cur.Interface().(Value)
+		switch x.Kind() {
+		case RecordKind:
+			if step == (RecordLabel{}) {
+				return reflect.ValueOf(x.Label()), nil
+			}
+			fallthrough
+		case ListKind, SetKind:
+			if !isIndex || index < 0 || index >= x.Len() {
+				return cur, fmt.Errorf("no element %v in %v", step, x.Kind())
+			}
+			return reflect.ValueOf(x.Index(index)), nil
+		case DictKind:
+			if e, ok := x.Get(pointerKey(step)); ok {
+				return reflect.ValueOf(e), nil
+			}
+			return cur, fmt.Errorf("no key %v", step)
+		}
+	case cur.Type() == typeOfRecord:
+		if step == (RecordLabel{}) {
+			return cur.Field(0), nil
+		}
+		cur = cur.Field(1)
+		fallthrough
+	case cur.Kind() == reflect.Slice || cur.Kind() == reflect.Array:
+		if !isIndex || index < 0 || index >= cur.Len() {
+			return cur, fmt.Errorf("no element %v in %s", step, cur.Type())
+		}
+		return cur.Index(index), nil
+	case cur.Kind() == reflect.Map:
+		key, err := mapKey(cur.Type(), step)
+		if err != nil {
+			return cur, err
+		}
+		if e := cur.MapIndex(key); e.IsValid() {
+			return e, nil
+		}
+		return cur, fmt.Errorf("no key %v", step)
+	case cur.Kind() == reflect.Struct:
+		name, ok := step.(string)
+		if sym, isSym := step.(Symbol); isSym {
+			name, ok = string(sym), true
+		}
+		if ok {
+			m := buildCachedMetadata(cur.Type())
+			if idx, ok := m.fieldNamesIndex[name]; ok {
+				return cur.Field(m.fields[idx].fieldIdx), nil
+			}
+		}
+		return cur, fmt.Errorf("no field %v in %s", step, cur.Type())
+	}
+	return cur, fmt.Errorf("cannot step into %s", cur.Type())
+}
+
+// mapKey converts a step into a key of the map type. Maps with interface keys
+// use the representation of the key the Decoder uses.
+func mapKey(t reflect.Type, step interface{}) (reflect.Value, error) {
+	key := reflect.ValueOf(step)
+	if i, ok := step.(int); ok && t.Key().Kind() == reflect.Interface {
+		key = reflect.ValueOf(int64(i))
+	}
+	switch {
+	case key.Type().AssignableTo(t.Key()):
+		return key, nil
+	case key.Kind() == t.Key().Kind() && key.Type().ConvertibleTo(t.Key()):
+		return key.Convert(t.Key()), nil
+	}
+	return key, fmt.Errorf("key %v cannot be used in %s", step, t)
+}
+
+// set replaces the value addressed by the steps of p from i onwards within
+// cur, which must be settable.
+func (p Pointer) set(cur reflect.Value, i int, v interface{}) error {
+	if i == len(p) {
+		if err := assign(cur, v); err != nil {
+			return p.error(i-1, err)
+		}
+		return nil
+	}
+	step := p[i]
+	index, isIndex := step.(int)
+	switch {
+	case cur.Kind() == reflect.Ptr:
+		if cur.IsNil() {
+			cur.Set(reflect.New(cur.Type().Elem()))
+		}
+		return p.set(cur.Elem(), i, v)
+	case cur.Kind() == reflect.Interface:
+		if cur.IsNil() {
+			return p.error(i, fmt.Errorf("no value"))
+		}
+		// The value held by an interface is not settable, so a
+		// settable copy is modified and then stored.
+		c := reflect.New(cur.Elem().Type()).Elem()
+		c.Set(cur.Elem())
+		if err := p.set(c, i, v); err != nil {
+			return err
+		}
+		cur.Set(c)
+		return nil
+	case cur.Type() == typeOfValue:
+		x := cur.Interface().(Value)
+		child, err := pointerStep(cur, step)
+		if err != nil && !(x.Kind() == DictKind && i == len(p)-1) {
+			return p.error(i, err)
+		}
+		c := reflect.New(typeOfValue).Elem()
+		if child.IsValid() && err == nil {
+			c.Set(child)
+		}
+		if err := p.set(c, i+1, v); err != nil {
+			return err
+		}
+		cur.Set(reflect.ValueOf(x.with(step, c.Interface().(Value))))
+		return nil
+	case cur.Type() == typeOfRecord:
+		if step == (RecordLabel{}) {
+			return p.set(cur.Field(0), i+1, v)
+		}
+		cur = cur.Field(1)
+		fallthrough
+	case cur.Kind() == reflect.Slice || cur.Kind() == reflect.Array:
+		if !isIndex || index < 0 || index >= cur.Len() {
+			return p.error(i, fmt.Errorf("no element %v in %s", step, cur.Type()))
+		}
+		return p.set(cur.Index(index), i+1, v)
+	case cur.Kind() == reflect.Map:
+		key, err := mapKey(cur.Type(), step)
+		if err != nil {
+			return p.error(i, err)
+		}
+		c := reflect.New(cur.Type().Elem()).Elem()
+		if e := cur.MapIndex(key); e.IsValid() {
+			c.Set(e)
+		} else if i < len(p)-1 {
+			return p.error(i, fmt.Errorf("no key %v", step))
+		}
+		if err := p.set(c, i+1, v); err != nil {
+			return err
+		}
+		if cur.IsNil() {
+			cur.Set(reflect.MakeMap(cur.Type()))
+		}
+		cur.SetMapIndex(key, c)
+		return nil
+	case cur.Kind() == reflect.Struct:
+		f, err := pointerStep(cur, step)
+		if err != nil {
+			return p.error(i, err)
+		} else if !f.CanSet() {
+			return p.error(i, fmt.Errorf("cannot set field %v", step))
+		}
+		return p.set(f, i+1, v)
+	}
+	return p.error(i, fmt.Errorf("cannot step into %s", cur.Type()))
+}
+
+// with returns a copy of v with the value the step names replaced.
+func (v Value) with(step interface{}, child Value) Value {
+	w := Value{kind: v.kind, seq: append([]Value{}, v.seq...)}
+	switch {
+	case v.kind == RecordKind && step == (RecordLabel{}):
+		w.seq[0] = child
+	case v.kind == RecordKind:
+		w.seq[1+step.(int)] = child
+	case v.kind == DictKind:
+		key := pointerKey(step)
+		for i := 0; i+1 < len(w.seq); i += 2 {
+			if w.seq[i].Equal(key) {
+				w.seq[i+1] = child
+				return w
+			}
+		}
+		w.seq = append(w.seq, key, child)
+	default:
+		w.seq[step.(int)] = child
+	}
+	return w
+}
+
+// assign stores v in the settable dst, converting it through its encoding when
+// it is not assignable.
+func assign(dst reflect.Value, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	} else if rv.Type().AssignableTo(dst.Type()) {
+		dst.Set(rv)
+		return nil
+	} else if dst.Type() == typeOfValue {
+		x, err := ValueOf(v)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(x))
+		return nil
+	}
+	enc := NewPrototypeEncoding()
+	var buf bytes.Buffer
+	if err := NewEncoder(enc, &buf).Encode(v); err != nil {
+		return err
+	}
+	c := reflect.New(dst.Type())
+	if err := NewDecoder(enc, &buf).Decode(c.Interface()); err != nil {
+		return err
+	}
+	dst.Set(c.Elem())
+	return nil
+}
@@ -0,0 +1,247 @@
+package syrup
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Tags of the Preserves machine-oriented binary syntax.
+const (
+	preservesFalse      byte = 0x80
+	preservesTrue       byte = 0x81
+	preservesEnd        byte = 0x84
+	preservesAnnotation byte = 0x85
+	preservesEmbedded   byte = 0x86
+	preservesIEEE754    byte = 0x87
+	preservesInt        byte = 0xB0
+	preservesString     byte = 0xB1
+	preservesBytes      byte = 0xB2
+	preservesSymbol     byte = 0xB3
+	preservesRecord     byte = 0xB4
+	preservesSequence   byte = 0xB5
+	preservesSet        byte = 0xB6
+	preservesDict       byte = 0xB7
+)
+
+// NewPreservesEncoding returns an encoding for the Preserves machine-oriented
+// binary syntax, which writes the same values as Syrup using a tag byte
+// followed, for atoms, by a varint length and the value's bytes. Integers are
+// written as big-endian two's complement, and every compound value is closed
+// by the same end marker. Canonical encoding with an Encoder produces the
+// canonical Preserves form.
+//
+// Annotations and embedded values are not supported, and are reported as
+// errors while decoding.
+func NewPreservesEncoding() *Encoding {
+	return &Encoding{
+		fmtString:        func(s string) []byte { return preservesAtom(preservesString, []byte(s)) },
+		fmtBigInt:        preservesBigInt,
+		fmtInt:           preservesInt64,
+		fmtUint:          preservesUint,
+		fmtBool:          preservesBool,
+		fmtFloat64:       preservesFloat64,
+		fmtFloat32:       preservesFloat32,
+		fmtBytes:         func(b []byte) []byte { return preservesAtom(preservesBytes, b) },
+		fmtSymbol:        func(s string) []byte { return preservesAtom(preservesSymbol, []byte(s)) },
+		listOpen:         preservesTagged(preservesSequence),
+		listClose:        preservesTagged(preservesEnd),
+		dictOpen:         preservesTagged(preservesDict),
+		dictClose:        preservesTagged(preservesEnd),
+		setOpen:          preservesTagged(preservesSet),
+		setClose:         preservesTagged(preservesEnd),
+		recordOpen:       preservesTagged(preservesRecord),
+		recordClose:      preservesTagged(preservesEnd),
+		mustFindToken:    preservesMustFindToken,
+		scanTokenLen:     preservesScanTokenLen,
+		scanFloat64Token: syrupProtoScanFloat64Token,
+		scanFloat32Token: syrupProtoScanFloat32Token,
+		parseLen:         preservesParsedLen,
+		boolVal:          preservesBoolVal,
+		symbolVal:        syrupProtoSymbolVal,
+		stringVal:        syrupProtoStringVal,
+		int64Val:         preservesInt64Val,
+		float32Val:       syrupProtoFloat32Val,
+		float64Val:       syrupProtoFloat64Val,
+	}
+}
+
+func preservesTagged(tag byte) func() []byte {
+	return func() []byte {
+		return []byte{tag}
+	}
+}
+
+// preservesAtom writes the tag, the varint length of s, and then s.
+func preservesAtom(tag byte, s []byte) []byte {
+	b := make([]byte, 1, 1+binary.MaxVarintLen64+len(s))
+	b[0] = tag
+	b = appendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendUvarint(b []byte, n uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	l := binary.PutUvarint(buf[:], n)
+	return append(b, buf[:l]...)
+}
+
+func preservesBigInt(i *big.Int) []byte {
+	return preservesAtom(preservesInt, twosComplement(i))
+}
+
+func preservesInt64(i int64) []byte {
+	return preservesBigInt(big.NewInt(i))
+}
+
+func preservesUint(i uint64) []byte {
+	return preservesBigInt(new(big.Int).SetUint64(i))
+}
+
+// twosComplement returns the shortest big-endian two's complement form of i,
+// which is empty for zero.
+func twosComplement(i *big.Int) []byte {
+	switch i.Sign() {
+	case 0:
+		return nil
+	case 1:
+		b := i.Bytes()
+		if b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+	// A negative number needs enough bytes for the bits of its complement,
+	// plus the sign bit.
+	n := new(big.Int).Not(i).BitLen()/8 + 1
+	m := new(big.Int).Lsh(big.NewInt(1), uint(8*n))
+	return m.Add(m, i).Bytes()
+}
+
+func preservesBool(b bool) []byte {
+	if b {
+		return []byte{preservesTrue}
+	}
+	return []byte{preservesFalse}
+}
+
+func preservesFloat64(f float64) []byte {
+	b := []byte{preservesIEEE754, 8, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(b[2:], math.Float64bits(f))
+	return b
+}
+
+func preservesFloat32(f float32) []byte {
+	b := []byte{preservesIEEE754, 4, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[2:], math.Float32bits(f))
+	return b
+}
+
+func preservesMustFindToken(b byte) (scanState, op, bool, error) {
+	switch b {
+	case preservesFalse, preservesTrue:
+		return scanFindToken, valBoolop, true, nil
+	case preservesEnd:
+		return scanFindToken, closeAnyOp, false, nil
+	case preservesIEEE754, preservesInt, preservesString, preservesBytes, preservesSymbol:
+		return scanTokenLen, noop, false, nil
+	case preservesRecord:
+		return scanFindToken, openRecordOp, false, nil
+	case preservesSequence:
+		return scanFindToken, openListOp, false, nil
+	case preservesSet:
+		return scanFindToken, openSetOp, false, nil
+	case preservesDict:
+		return scanFindToken, openDictOp, false, nil
+	case preservesAnnotation:
+		return scanFindToken, noop, false, fmt.Errorf("preserves annotations are not supported")
+	case preservesEmbedded:
+		return scanFindToken, noop, false, fmt.Errorf("preserves embedded values are not supported")
+	default:
+		return scanFindToken, noop, false, fmt.Errorf("could not determine preserves tag for byte: %v", b)
+	}
+}
+
+// preservesScanTokenLen collects the bytes of a varint length. The state after
+// the final byte is determined once the length is parsed.
+func preservesScanTokenLen(b byte) (scanState, op, bool, error) {
+	if b&0x80 != 0 {
+		return scanTokenLen, noop, true, nil
+	}
+	return scanFindToken, noop, true, nil
+}
+
+func preservesParsedLen(s string, tag byte, _ scanState) (scanState, op, uint64, error) {
+	l, n := binary.Uvarint([]byte(s))
+	if n <= 0 {
+		return scanFindToken, noop, 0, fmt.Errorf("preserves malformed length")
+	}
+	switch tag {
+	case preservesInt:
+		if l == 0 {
+			return scanFindToken, valIntOp, 0, nil
+		}
+		return scanIntBytes, noop, l, nil
+	case preservesString:
+		if l == 0 {
+			return scanFindToken, valStringOp, 0, nil
+		}
+		return scanString, noop, l, nil
+	case preservesBytes:
+		if l == 0 {
+			return scanFindToken, valByteArrOp, 0, nil
+		}
+		return scanByteArr, noop, l, nil
+	case preservesSymbol:
+		if l == 0 {
+			return scanFindToken, valSymbolOp, 0, nil
+		}
+		return scanSymbol, noop, l, nil
+	case preservesIEEE754:
+		switch l {
+		case 4:
+			return scanFloat32, noop, l, nil
+		case 8:
+			return scanFloat64, noop, l, nil
+		}
+		return scanFindToken, noop, 0, fmt.Errorf("preserves float of unsupported length %d", l)
+	default:
+		return scanFindToken, noop, 0, fmt.Errorf("preserves len parsing bad tag: %v", tag)
+	}
+}
+
+func preservesBoolVal(b []byte) (bool, error) {
+	if len(b) != 1 {
+		return false, fmt.Errorf("preserves bool val len %d", len(b))
+	}
+	switch b[0] {
+	case preservesTrue:
+		return true, nil
+	case preservesFalse:
+		return false, nil
+	}
+	return false, fmt.Errorf("preserves bool unknown value: %v", b)
+}
+
+func preservesInt64Val(b []byte) (int64, *big.Int, error) {
+	if len(b) <= 8 {
+		var i int64
+		for _, c := range b {
+			i = i<<8 | int64(c)
+		}
+		// Sign extend from the width of the encoded integer.
+		if shift := uint(64 - 8*len(b)); len(b) > 0 {
+			i = i << shift >> shift
+		}
+		return i, nil, nil
+	}
+	bi := new(big.Int).SetBytes(b)
+	if b[0]&0x80 != 0 {
+		bi.Sub(bi, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+	}
+	if bi.IsInt64() {
+		return bi.Int64(), nil, nil
+	}
+	return 0, bi, nil
+}
@@ -0,0 +1,549 @@
+package syrup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Printer renders Syrup values in a human readable text form, following the
+// Preserves text syntax: symbols are bare, strings are quoted, bytestrings are
+// written as #"..." or #x"...", records as <label v1 v2>, lists as [v1 v2],
+// sets as #{v1 v2}, and dictionaries as {k1: v1, k2: v2}. Single precision
+// floats carry an 'f' suffix to distinguish them from double precision ones.
+// The text is read back by TextDecoder and ParseText.
+//
+// The zero Printer writes each value on a single line.
+type Printer struct {
+	// Indent, when not empty, places each element of a compound value on
+	// its own line, indented by Indent once per level of nesting.
+	Indent string
+	// HexBytes writes bytestrings as hexadecimal #x"..." rather than as
+	// escaped text.
+	HexBytes bool
+}
+
+// Fprint writes the text form of v to w. The value may be any value the
+// Encoder is able to encode.
+func (p *Printer) Fprint(w io.Writer, v interface{}) error {
+	var sb strings.Builder
+	if err := p.print(&sb, v, 0); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Sprint returns the text form of v. Values that cannot be encoded are
+// rendered as an error marker, as in the fmt package.
+func (p *Printer) Sprint(v interface{}) string {
+	var sb strings.Builder
+	if err := p.print(&sb, v, 0); err != nil {
+		return fmt.Sprintf("%%!v(%s)", err)
+	}
+	return sb.String()
+}
+
+// PrintStream writes the text form of every value decoded by d to w, one value
+// per line, until the stream is exhausted.
+func (p *Printer) PrintStream(w io.Writer, d *Decoder) error {
+	for {
+		var v Value
+		if err := d.Decode(&v); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := p.Fprint(w, v); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *Printer) print(sb *strings.Builder, v interface{}, depth int) error {
+	switch x := v.(type) {
+	case bool:
+		if x {
+			sb.WriteString("#t")
+		} else {
+			sb.WriteString("#f")
+		}
+	case int:
+		sb.WriteString(strconv.FormatInt(int64(x), 10))
+	case int8:
+		sb.WriteString(strconv.FormatInt(int64(x), 10))
+	case int16:
+		sb.WriteString(strconv.FormatInt(int64(x), 10))
+	case int32:
+		sb.WriteString(strconv.FormatInt(int64(x), 10))
+	case int64:
+		sb.WriteString(strconv.FormatInt(x, 10))
+	case uint:
+		sb.WriteString(strconv.FormatUint(uint64(x), 10))
+	case uint8:
+		sb.WriteString(strconv.FormatUint(uint64(x), 10))
+	case uint16:
+		sb.WriteString(strconv.FormatUint(uint64(x), 10))
+	case uint32:
+		sb.WriteString(strconv.FormatUint(uint64(x), 10))
+	case uint64:
+		sb.WriteString(strconv.FormatUint(x, 10))
+	case *big.Int:
+		if x == nil {
+			return p.printEncoded(sb, v, depth)
+		}
+		sb.WriteString(x.String())
+	case float32:
+		writeFloat32Text(sb, x)
+	case float64:
+		writeFloat64Text(sb, x)
+	case string:
+		writeStringText(sb, x)
+	case []byte:
+		if x == nil {
+			return p.printEncoded(sb, v, depth)
+		}
+		if p.HexBytes {
+			sb.WriteString(`#x"`)
+			sb.WriteString(hex.EncodeToString(x))
+			sb.WriteByte('"')
+		} else {
+			writeBytesText(sb, x)
+		}
+	case Symbol:
+		writeSymbolText(sb, x)
+	case Record:
+		sb.WriteByte('<')
+		if err := p.print(sb, x.Label, depth+1); err != nil {
+			return err
+		}
+		if err := p.printElems(sb, x.Values, depth, true, " "); err != nil {
+			return err
+		}
+		sb.WriteByte('>')
+	case Set:
+		sb.WriteString("#{")
+		if err := p.printElems(sb, x, depth, false, " "); err != nil {
+			return err
+		}
+		sb.WriteByte('}')
+	case []interface{}:
+		if x == nil {
+			return p.printEncoded(sb, v, depth)
+		}
+		sb.WriteByte('[')
+		if err := p.printElems(sb, x, depth, false, " "); err != nil {
+			return err
+		}
+		sb.WriteByte(']')
+	case map[interface{}]interface{}:
+		if x == nil {
+			return p.printEncoded(sb, v, depth)
+		}
+		return p.printDict(sb, x, depth)
+	case Value:
+		return p.printValue(sb, x, depth)
+	default:
+		return p.printEncoded(sb, v, depth)
+	}
+	return nil
+}
+
+// printEncoded prints any other Go value by encoding it, and then printing its
+// decoded form.
+func (p *Printer) printEncoded(sb *strings.Builder, v interface{}, depth int) error {
+	enc := NewPrototypeEncoding()
+	var buf bytes.Buffer
+	if err := NewEncoder(enc, &buf).Encode(v); err != nil {
+		return err
+	}
+	var decoded interface{}
+	if err := NewDecoder(enc, &buf).Decode(&decoded); err != nil {
+		return err
+	}
+	if t := reflect.TypeOf(decoded); t == reflect.TypeOf(v) {
+		return fmt.Errorf("syrup: cannot print value of type %T", v)
+	}
+	return p.print(sb, decoded, depth)
+}
+
+// printElems prints the elements of a compound value, where the opening
+// delimiter has already been written. When the elements follow a record label
+// they are always separated from it.
+func (p *Printer) printElems(sb *strings.Builder, vals []interface{}, depth int, afterLabel bool, sep string) error {
+	for i, val := range vals {
+		if len(p.Indent) > 0 {
+			p.newline(sb, depth+1)
+		} else if i > 0 || afterLabel {
+			sb.WriteString(sep)
+		}
+		if err := p.print(sb, val, depth+1); err != nil {
+			return err
+		}
+	}
+	if len(p.Indent) > 0 && len(vals) > 0 {
+		p.newline(sb, depth)
+	}
+	return nil
+}
+
+func (p *Printer) printDict(sb *strings.Builder, m map[interface{}]interface{}, depth int) error {
+	type entry struct {
+		key string
+		val interface{}
+	}
+	entries := make([]entry, 0, len(m))
+	for k, v := range m {
+		var ksb strings.Builder
+		if err := p.print(&ksb, k, depth+1); err != nil {
+			return err
+		}
+		entries = append(entries, entry{key: ksb.String(), val: v})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+	sb.WriteByte('{')
+	for i, e := range entries {
+		if len(p.Indent) > 0 {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			p.newline(sb, depth+1)
+		} else if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(e.key)
+		sb.WriteString(": ")
+		if err := p.print(sb, e.val, depth+1); err != nil {
+			return err
+		}
+	}
+	if len(p.Indent) > 0 && len(entries) > 0 {
+		p.newline(sb, depth)
+	}
+	sb.WriteByte('}')
+	return nil
+}
+
+// printValue prints a Value, keeping the order of its dictionary entries.
+func (p *Printer) printValue(sb *strings.Builder, v Value, depth int) error {
+	switch v.Kind() {
+	case BoolKind:
+		return p.print(sb, v.Bool(), depth)
+	case Float32Kind:
+		writeFloat32Text(sb, v.Float32())
+	case Float64Kind:
+		writeFloat64Text(sb, v.Float64())
+	case IntKind:
+		return p.print(sb, v.BigInt(), depth)
+	case StringKind:
+		writeStringText(sb, v.String())
+	case BytesKind:
+		return p.print(sb, v.Bytes(), depth)
+	case SymbolKind:
+		writeSymbolText(sb, v.Symbol())
+	case RecordKind, ListKind, SetKind:
+		open, close := "[", "]"
+		if v.Kind() == RecordKind {
+			open, close = "<", ">"
+		} else if v.Kind() == SetKind {
+			open, close = "#{", "}"
+		}
+		sb.WriteString(open)
+		if v.Kind() == RecordKind {
+			if err := p.printValue(sb, v.Label(), depth+1); err != nil {
+				return err
+			}
+		}
+		elems := v.Elems()
+		vals := make([]interface{}, len(elems))
+		for i, e := range elems {
+			vals[i] = e
+		}
+		if err := p.printElems(sb, vals, depth, v.Kind() == RecordKind, " "); err != nil {
+			return err
+		}
+		sb.WriteString(close)
+	case DictKind:
+		sb.WriteByte('{')
+		for i, e := range v.Entries() {
+			if len(p.Indent) > 0 {
+				if i > 0 {
+					sb.WriteByte(',')
+				}
+				p.newline(sb, depth+1)
+			} else if i > 0 {
+				sb.WriteString(", ")
+			}
+			if err := p.printValue(sb, e.Key, depth+1); err != nil {
+				return err
+			}
+			sb.WriteString(": ")
+			if err := p.printValue(sb, e.Value, depth+1); err != nil {
+				return err
+			}
+		}
+		if len(p.Indent) > 0 && v.Len() > 0 {
+			p.newline(sb, depth)
+		}
+		sb.WriteByte('}')
+	default:
+		return fmt.Errorf("syrup: cannot print %v Value", v.Kind())
+	}
+	return nil
+}
+
+func (p *Printer) newline(sb *strings.Builder, depth int) {
+	sb.WriteByte('\n')
+	for i := 0; i < depth; i++ {
+		sb.WriteString(p.Indent)
+	}
+}
+
+// writeFloat64Text writes a double, which always contains a decimal point or
+// exponent so that it is not mistaken for an integer. Values without a
+// decimal representation are written as their bits.
+func writeFloat64Text(sb *strings.Builder, f float64) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, math.Float64bits(f))
+		sb.WriteString(`#xd"`)
+		sb.WriteString(hex.EncodeToString(b))
+		sb.WriteByte('"')
+		return
+	}
+	sb.WriteString(floatText(f, 64))
+}
+
+// writeFloat32Text writes a single precision float with an 'f' suffix.
+func writeFloat32Text(sb *strings.Builder, f float32) {
+	if math.IsInf(float64(f), 0) || math.IsNaN(float64(f)) {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, math.Float32bits(f))
+		sb.WriteString(`#xf"`)
+		sb.WriteString(hex.EncodeToString(b))
+		sb.WriteByte('"')
+		return
+	}
+	sb.WriteString(floatText(float64(f), 32))
+	sb.WriteByte('f')
+}
+
+func floatText(f float64, bitSize int) string {
+	s := strconv.FormatFloat(f, 'g', -1, bitSize)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	} else if i := strings.IndexByte(s, 'e'); i >= 0 && !strings.Contains(s[:i], ".") {
+		s = s[:i] + ".0" + s[i:]
+	}
+	return s
+}
+
+func writeStringText(sb *strings.Builder, s string) {
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f || r == utf8.RuneError {
+				fmt.Fprintf(sb, `\u%04x`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+}
+
+func writeBytesText(sb *strings.Builder, b []byte) {
+	sb.WriteString(`#"`)
+	for _, c := range b {
+		switch c {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(sb, `\x%02x`, c)
+			} else {
+				sb.WriteByte(c)
+			}
+		}
+	}
+	sb.WriteByte('"')
+}
+
+// writeSymbolText writes a symbol bare when possible, otherwise quoted between
+// vertical bars.
+func writeSymbolText(sb *strings.Builder, s Symbol) {
+	if isBareSymbol(string(s)) {
+		sb.WriteString(string(s))
+		return
+	}
+	writeQuotedSymbolText(sb, s)
+}
+
+// writeQuotedSymbolText writes a symbol between vertical bars.
+func writeQuotedSymbolText(sb *strings.Builder, s Symbol) {
+	sb.WriteByte('|')
+	for _, r := range string(s) {
+		switch r {
+		case '|':
+			sb.WriteString(`\|`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f || r == utf8.RuneError {
+				fmt.Fprintf(sb, `\u%04x`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('|')
+}
+
+// isBareSymbol determines whether a symbol can be written without quoting,
+// meaning it consists only of symbol characters and cannot be read back as a
+// number.
+func isBareSymbol(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, r := range s {
+		if !isSymbolRune(r) {
+			return false
+		}
+	}
+	return !looksNumeric(s)
+}
+
+func isSymbolRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	case r >= utf8.RuneSelf:
+		return r != utf8.RuneError
+	}
+	return strings.ContainsRune("~!$%^&*?_=+-/.", r)
+}
+
+func looksNumeric(s string) bool {
+	if s[0] == '-' || s[0] == '+' {
+		s = s[1:]
+	}
+	return len(s) > 0 && (isDigit(s[0]) || (s[0] == '.' && len(s) > 1 && isDigit(s[1])))
+}
+
+// Format implements fmt.Formatter, writing the Printer's text form for the %v
+// verb. Other verbs, such as %s and %q, format the symbol as a plain string.
+func (s Symbol) Format(f fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && f.Flag('#'):
+		fmt.Fprintf(f, "syrup.Symbol(%q)", string(s))
+	case verb == 'v':
+		formatText(f, verb, s)
+	default:
+		formatString(f, verb, string(s))
+	}
+}
+
+// Format implements fmt.Formatter, writing the Printer's text form for the %v
+// and %s verbs.
+func (r Record) Format(f fmt.State, verb rune) {
+	if verb == 'v' && f.Flag('#') {
+		fmt.Fprintf(f, "syrup.Record{Label:%#v, Values:%#v}", r.Label, r.Values)
+		return
+	}
+	formatText(f, verb, r)
+}
+
+// Format implements fmt.Formatter, writing the Printer's text form for the %v
+// and %s verbs.
+func (s Set) Format(f fmt.State, verb rune) {
+	if verb == 'v' && f.Flag('#') {
+		io.WriteString(f, "syrup.Set{")
+		for i, v := range s {
+			if i > 0 {
+				io.WriteString(f, ", ")
+			}
+			fmt.Fprintf(f, "%#v", v)
+		}
+		io.WriteString(f, "}")
+		return
+	}
+	formatText(f, verb, s)
+}
+
+// formatString formats s as fmt would with the verb, flags, width, and
+// precision given to f.
+func formatString(f fmt.State, verb rune, s string) {
+	var sb strings.Builder
+	sb.WriteByte('%')
+	for _, c := range "+-# 0" {
+		if f.Flag(int(c)) {
+			sb.WriteRune(c)
+		}
+	}
+	if w, ok := f.Width(); ok {
+		sb.WriteString(strconv.Itoa(w))
+	}
+	if p, ok := f.Precision(); ok {
+		sb.WriteByte('.')
+		sb.WriteString(strconv.Itoa(p))
+	}
+	sb.WriteRune(verb)
+	fmt.Fprintf(f, sb.String(), s)
+}
+
+func formatText(f fmt.State, verb rune, v interface{}) {
+	if verb != 'v' && verb != 's' {
+		fmt.Fprintf(f, "%%!%c(%T)", verb, v)
+		return
+	}
+	p := &Printer{}
+	io.WriteString(f, p.Sprint(v))
+}
@@ -0,0 +1,348 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/cjslep/syrup"
+)
+
+// node is a filter in a parsed query.
+type node interface {
+	eval(in syrup.Value) ([]syrup.Value, error)
+}
+
+type identityNode struct{}
+
+func (identityNode) eval(in syrup.Value) ([]syrup.Value, error) {
+	return []syrup.Value{in}, nil
+}
+
+type literalNode struct {
+	v syrup.Value
+}
+
+func (n literalNode) eval(syrup.Value) ([]syrup.Value, error) {
+	return []syrup.Value{n.v}, nil
+}
+
+type pipeNode struct {
+	left, right node
+}
+
+func (n pipeNode) eval(in syrup.Value) ([]syrup.Value, error) {
+	lefts, err := n.left.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var outs []syrup.Value
+	for _, l := range lefts {
+		rights, err := n.right.eval(l)
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, rights...)
+	}
+	return outs, nil
+}
+
+type commaNode struct {
+	left, right node
+}
+
+func (n commaNode) eval(in syrup.Value) ([]syrup.Value, error) {
+	lefts, err := n.left.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	rights, err := n.right.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	return append(lefts, rights...), nil
+}
+
+// nameNode selects a dictionary entry by name, or the label of a record.
+type nameNode struct {
+	name string
+	// record is set for the label function, which only applies to
+	// records.
+	record bool
+}
+
+func (n nameNode) eval(in syrup.Value) ([]syrup.Value, error) {
+	switch {
+	case in.Kind() == syrup.RecordKind && n.name == "label":
+		return []syrup.Value{in.Label()}, nil
+	case in.Kind() == syrup.DictKind && !n.record:
+		if v, ok := in.Get(syrup.NewString(n.name)); ok {
+			return []syrup.Value{v}, nil
+		}
+		if v, ok := in.Get(syrup.NewSymbol(syrup.Symbol(n.name))); ok {
+			return []syrup.Value{v}, nil
+		}
+		return nil, nil
+	case n.record:
+		return nil, kindError("label", in)
+	}
+	return nil, fmt.Errorf("syrup query: cannot select .%s of %s", n.name, in.Kind())
+}
+
+// indexNode selects from the outputs of of, or the input when of is nil, by
+// each output of index evaluated against the input.
+type indexNode struct {
+	of    node
+	index node
+}
+
+func (n indexNode) eval(in syrup.Value) ([]syrup.Value, error) {
+	targets := []syrup.Value{in}
+	if n.of != nil {
+		var err error
+		if targets, err = n.of.eval(in); err != nil {
+			return nil, err
+		}
+	}
+	indices, err := n.index.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var outs []syrup.Value
+	for _, t := range targets {
+		for _, i := range indices {
+			v, ok, err := index(t, i)
+			if err != nil {
+				return nil, err
+			} else if ok {
+				outs = append(outs, v)
+			}
+		}
+	}
+	return outs, nil
+}
+
+func index(t, i syrup.Value) (syrup.Value, bool, error) {
+	switch t.Kind() {
+	case syrup.DictKind:
+		v, ok := t.Get(i)
+		return v, ok, nil
+	case syrup.RecordKind, syrup.ListKind, syrup.SetKind:
+		if i.Kind() != syrup.IntKind {
+			return syrup.Value{}, false, fmt.Errorf("syrup query: cannot index %s with %s", t.Kind(), i.Kind())
+		}
+		n, ok := i.Int64()
+		if ok && n < 0 {
+			n += int64(t.Len())
+		}
+		if !ok || n < 0 || n >= int64(t.Len()) {
+			return syrup.Value{}, false, nil
+		}
+		return t.Index(int(n)), true, nil
+	}
+	return syrup.Value{}, false, fmt.Errorf("syrup query: cannot index %s", t.Kind())
+}
+
+type iterateNode struct{}
+
+func (iterateNode) eval(in syrup.Value) ([]syrup.Value, error) {
+	switch in.Kind() {
+	case syrup.RecordKind, syrup.ListKind, syrup.SetKind:
+		return in.Elems(), nil
+	case syrup.DictKind:
+		var outs []syrup.Value
+		for _, e := range in.Entries() {
+			outs = append(outs, e.Value)
+		}
+		return outs, nil
+	}
+	return nil, fmt.Errorf("syrup query: cannot iterate over %s", in.Kind())
+}
+
+type compareNode struct {
+	cmp         func(c int) bool
+	left, right node
+}
+
+func (n compareNode) eval(in syrup.Value) ([]syrup.Value, error) {
+	lefts, err := n.left.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	rights, err := n.right.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var outs []syrup.Value
+	for _, l := range lefts {
+		for _, r := range rights {
+			outs = append(outs, syrup.NewBool(n.cmp(l.Compare(r))))
+		}
+	}
+	return outs, nil
+}
+
+// logicNode is an and or or, which only evaluates right when left does not
+// determine the result.
+type logicNode struct {
+	or          bool
+	left, right node
+}
+
+func (n logicNode) eval(in syrup.Value) ([]syrup.Value, error) {
+	lefts, err := n.left.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var outs []syrup.Value
+	for _, l := range lefts {
+		if truthy(l) == n.or {
+			outs = append(outs, syrup.NewBool(n.or))
+			continue
+		}
+		rights, err := n.right.eval(in)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rights {
+			outs = append(outs, syrup.NewBool(truthy(r)))
+		}
+	}
+	return outs, nil
+}
+
+// truthy reports whether v is anything but #f.
+func truthy(v syrup.Value) bool {
+	return v.Kind() != syrup.BoolKind || v.Bool()
+}
+
+type collectNode struct {
+	n node
+}
+
+func (n collectNode) eval(in syrup.Value) ([]syrup.Value, error) {
+	if n.n == nil {
+		return []syrup.Value{syrup.NewList()}, nil
+	}
+	elems, err := n.n.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	return []syrup.Value{syrup.NewList(elems...)}, nil
+}
+
+type recordNode struct {
+	// parts holds the label and then the values.
+	parts []node
+}
+
+func (n recordNode) eval(in syrup.Value) ([]syrup.Value, error) {
+	var outs []syrup.Value
+	err := product(in, n.parts, nil, func(vs []syrup.Value) {
+		outs = append(outs, syrup.NewRecord(vs[0], vs[1:]...))
+	})
+	return outs, err
+}
+
+type dictNode struct {
+	entries [][2]node
+}
+
+func (n dictNode) eval(in syrup.Value) ([]syrup.Value, error) {
+	parts := make([]node, 0, 2*len(n.entries))
+	for _, e := range n.entries {
+		parts = append(parts, e[0], e[1])
+	}
+	var outs []syrup.Value
+	err := product(in, parts, nil, func(vs []syrup.Value) {
+		// A later entry replaces an earlier one with an equal key.
+		var entries []syrup.DictEntry
+	next:
+		for i := 0; i < len(vs); i += 2 {
+			for j := range entries {
+				if entries[j].Key.Equal(vs[i]) {
+					entries[j].Value = vs[i+1]
+					continue next
+				}
+			}
+			entries = append(entries, syrup.DictEntry{Key: vs[i], Value: vs[i+1]})
+		}
+		outs = append(outs, syrup.NewDict(entries...))
+	})
+	return outs, err
+}
+
+// product calls f with every combination of the outputs of parts, varying the
+// last part fastest.
+func product(in syrup.Value, parts []node, prefix []syrup.Value, f func([]syrup.Value)) error {
+	if len(parts) == 0 {
+		f(prefix)
+		return nil
+	}
+	vs, err := parts[0].eval(in)
+	if err != nil {
+		return err
+	}
+	for _, v := range vs {
+		next := append(prefix[:len(prefix):len(prefix)], v)
+		if err := product(in, parts[1:], next, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type selectNode struct {
+	cond node
+}
+
+func (n selectNode) eval(in syrup.Value) ([]syrup.Value, error) {
+	conds, err := n.cond.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range conds {
+		if truthy(c) {
+			return []syrup.Value{in}, nil
+		}
+	}
+	return nil, nil
+}
+
+// funcNode is a built in function without arguments.
+type funcNode struct {
+	name string
+}
+
+func (n funcNode) eval(in syrup.Value) ([]syrup.Value, error) {
+	switch n.name {
+	case "length":
+		switch in.Kind() {
+		case syrup.RecordKind, syrup.ListKind, syrup.SetKind, syrup.DictKind:
+			return []syrup.Value{syrup.NewInt(int64(in.Len()))}, nil
+		case syrup.StringKind:
+			return []syrup.Value{syrup.NewInt(int64(len(in.String())))}, nil
+		case syrup.BytesKind:
+			return []syrup.Value{syrup.NewInt(int64(len(in.Bytes())))}, nil
+		case syrup.SymbolKind:
+			return []syrup.Value{syrup.NewInt(int64(len(in.Symbol())))}, nil
+		}
+	case "keys":
+		if in.Kind() == syrup.DictKind {
+			var keys []syrup.Value
+			for _, e := range in.Entries() {
+				keys = append(keys, e.Key)
+			}
+			return []syrup.Value{syrup.NewList(keys...)}, nil
+		}
+	case "kind":
+		return []syrup.Value{syrup.NewSymbol(syrup.Symbol(in.Kind().String()))}, nil
+	case "not":
+		return []syrup.Value{syrup.NewBool(!truthy(in))}, nil
+	case "empty":
+		return nil, nil
+	}
+	return nil, kindError(n.name, in)
+}
+
+func kindError(name string, in syrup.Value) error {
+	return fmt.Errorf("syrup query: cannot apply %s to %s", name, in.Kind())
+}
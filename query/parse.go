@@ -0,0 +1,474 @@
+package query
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cjslep/syrup"
+)
+
+// SyntaxError describes a query that cannot be parsed.
+type SyntaxError struct {
+	Msg string
+	// Offset is the byte offset of the error within the query.
+	Offset int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syrup query: syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+type tokenKind uint8
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokIdent
+	tokLiteral
+)
+
+type token struct {
+	kind tokenKind
+	// text is the punctuation or identifier.
+	text string
+	// lit is the value of a literal.
+	lit syrup.Value
+	// offset is where the token begins.
+	offset int
+	// spaced is whether whitespace precedes the token.
+	spaced bool
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+var punctuation = []string{"==", "!=", "<=", ">=", ".", "[", "]", "(", ")", "<", ">", "{", "}", ",", "|", ":"}
+
+func (l *lexer) next() (token, error) {
+	start := l.pos
+	for l.pos < len(l.src) && strings.ContainsRune(" \t\r\n", rune(l.src[l.pos])) {
+		l.pos++
+	}
+	t := token{offset: l.pos, spaced: l.pos > start}
+	if l.pos == len(l.src) {
+		return t, nil
+	}
+	rest := l.src[l.pos:]
+	c := rest[0]
+	switch {
+	case c == '"':
+		end, s, err := unquote(rest, '"')
+		if err != nil {
+			return t, l.error(err.Error())
+		}
+		l.pos += end
+		t.kind, t.lit = tokLiteral, syrup.NewString(s)
+		return t, nil
+	case c == '\'' && len(rest) > 1 && rest[1] == '|':
+		end, s, err := unquote(rest[1:], '|')
+		if err != nil {
+			return t, l.error(err.Error())
+		}
+		l.pos += 1 + end
+		t.kind, t.lit = tokLiteral, syrup.NewSymbol(syrup.Symbol(s))
+		return t, nil
+	case c == '\'':
+		n := 1
+		for n < len(rest) && isSymbolByte(rest[n]) {
+			n++
+		}
+		if n == 1 {
+			return t, l.error("empty symbol")
+		}
+		l.pos += n
+		t.kind, t.lit = tokLiteral, syrup.NewSymbol(syrup.Symbol(rest[1:n]))
+		return t, nil
+	case c == '#' && len(rest) > 1 && (rest[1] == 't' || rest[1] == 'f'):
+		l.pos += 2
+		t.kind, t.lit = tokLiteral, syrup.NewBool(rest[1] == 't')
+		return t, nil
+	case isDigit(c) || (c == '-' && len(rest) > 1 && isDigit(rest[1])):
+		n := 1
+		for n < len(rest) && (isDigit(rest[n]) || strings.IndexByte(".eE+-", rest[n]) >= 0) {
+			n++
+		}
+		lit, err := number(rest[:n])
+		if err != nil {
+			return t, l.error(err.Error())
+		}
+		l.pos += n
+		t.kind, t.lit = tokLiteral, lit
+		return t, nil
+	case isIdentByte(c) && !isDigit(c):
+		n := 1
+		for n < len(rest) && isIdentByte(rest[n]) {
+			n++
+		}
+		l.pos += n
+		t.kind, t.text = tokIdent, rest[:n]
+		return t, nil
+	}
+	for _, p := range punctuation {
+		if strings.HasPrefix(rest, p) {
+			l.pos += len(p)
+			t.kind, t.text = tokPunct, p
+			return t, nil
+		}
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return t, l.error(fmt.Sprintf("unexpected %q", r))
+}
+
+func (l *lexer) error(msg string) error {
+	return &SyntaxError{Msg: msg, Offset: l.pos}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) || c == '_'
+}
+
+func isSymbolByte(c byte) bool {
+	return isIdentByte(c) || c >= utf8.RuneSelf || strings.IndexByte("~!$%^&*?=+-/.:", c) >= 0
+}
+
+// unquote reads a quoted string or symbol at the start of s, returning the
+// number of bytes read.
+func unquote(s string, quote byte) (int, string, error) {
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case quote:
+			return i + 1, sb.String(), nil
+		case '\\':
+			if i+1 == len(s) {
+				break
+			}
+			i++
+			switch e := s[i]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			default:
+				sb.WriteByte(e)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return 0, "", fmt.Errorf("unterminated %c", quote)
+}
+
+func number(s string) (syrup.Value, error) {
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return syrup.NewInt(i), nil
+		}
+		if bi, ok := new(big.Int).SetString(s, 10); ok {
+			return syrup.NewBigInt(bi), nil
+		}
+	} else if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return syrup.NewFloat64(f), nil
+	}
+	return syrup.Value{}, fmt.Errorf("malformed number %s", s)
+}
+
+type parser struct {
+	lex lexer
+	tok token
+}
+
+func (p *parser) advance() error {
+	t, err := p.lex.next()
+	p.tok = t
+	return err
+}
+
+func (p *parser) is(text string) bool {
+	return (p.tok.kind == tokPunct || p.tok.kind == tokIdent) && p.tok.text == text
+}
+
+func (p *parser) expect(text string) error {
+	if !p.is(text) {
+		return p.error(fmt.Sprintf("expected %q", text))
+	}
+	return p.advance()
+}
+
+func (p *parser) error(msg string) error {
+	if p.tok.kind == tokEOF {
+		msg += " at end of query"
+	}
+	return &SyntaxError{Msg: msg, Offset: p.tok.offset}
+}
+
+func (p *parser) parse() (node, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	n, err := p.pipe()
+	if err != nil {
+		return nil, err
+	} else if p.tok.kind != tokEOF {
+		return nil, p.error("unexpected token")
+	}
+	return n, nil
+}
+
+func (p *parser) pipe() (node, error) {
+	n, err := p.comma()
+	for err == nil && p.is("|") {
+		var right node
+		if err = p.advance(); err != nil {
+			break
+		}
+		if right, err = p.comma(); err == nil {
+			n = pipeNode{n, right}
+		}
+	}
+	return n, err
+}
+
+func (p *parser) comma() (node, error) {
+	n, err := p.or()
+	for err == nil && p.is(",") {
+		var right node
+		if err = p.advance(); err != nil {
+			break
+		}
+		if right, err = p.or(); err == nil {
+			n = commaNode{n, right}
+		}
+	}
+	return n, err
+}
+
+func (p *parser) or() (node, error) {
+	n, err := p.and()
+	for err == nil && p.is("or") {
+		var right node
+		if err = p.advance(); err != nil {
+			break
+		}
+		if right, err = p.and(); err == nil {
+			n = logicNode{or: true, left: n, right: right}
+		}
+	}
+	return n, err
+}
+
+func (p *parser) and() (node, error) {
+	n, err := p.comparison()
+	for err == nil && p.is("and") {
+		var right node
+		if err = p.advance(); err != nil {
+			break
+		}
+		if right, err = p.comparison(); err == nil {
+			n = logicNode{left: n, right: right}
+		}
+	}
+	return n, err
+}
+
+var comparisons = map[string]func(c int) bool{
+	"==": func(c int) bool { return c == 0 },
+	"!=": func(c int) bool { return c != 0 },
+	"<":  func(c int) bool { return c < 0 },
+	"<=": func(c int) bool { return c <= 0 },
+	">":  func(c int) bool { return c > 0 },
+	">=": func(c int) bool { return c >= 0 },
+}
+
+func (p *parser) comparison() (node, error) {
+	n, err := p.postfix()
+	if err != nil {
+		return nil, err
+	}
+	if cmp, ok := comparisons[p.tok.text]; ok && p.tok.kind == tokPunct {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.postfix()
+		if err != nil {
+			return nil, err
+		}
+		return compareNode{cmp: cmp, left: n, right: right}, nil
+	}
+	return n, nil
+}
+
+// postfix parses a primary filter followed by any selectors.
+func (p *parser) postfix() (node, error) {
+	n, err := p.primary()
+	for err == nil {
+		switch {
+		case p.is(".") && !p.tok.spaced:
+			if err = p.advance(); err == nil {
+				n, err = p.selector(n)
+			}
+		case p.is("[") && !p.tok.spaced:
+			n, err = p.selector(n)
+		default:
+			return n, nil
+		}
+	}
+	return nil, err
+}
+
+// selector parses the selector following a '.', applied to the outputs of n.
+func (p *parser) selector(n node) (node, error) {
+	switch {
+	case p.tok.kind == tokIdent && !p.tok.spaced:
+		name := p.tok.text
+		return pipeNode{n, nameNode{name: name}}, p.advance()
+	case p.tok.kind == tokLiteral && p.tok.lit.Kind() == syrup.StringKind && !p.tok.spaced:
+		key := p.tok.lit
+		return pipeNode{n, indexNode{index: literalNode{key}}}, p.advance()
+	case p.is("[") && !p.tok.spaced:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.is("]") {
+			return pipeNode{n, iterateNode{}}, p.advance()
+		}
+		index, err := p.pipe()
+		if err != nil {
+			return nil, err
+		}
+		// The index is evaluated against the input of n, rather than
+		// its outputs.
+		return indexNode{of: n, index: index}, p.expect("]")
+	}
+	return n, nil
+}
+
+func (p *parser) primary() (node, error) {
+	switch {
+	case p.tok.kind == tokLiteral:
+		n := literalNode{p.tok.lit}
+		return n, p.advance()
+	case p.is("."):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return p.selector(identityNode{})
+	case p.is("("):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		n, err := p.pipe()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	case p.is("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.is("]") {
+			return collectNode{}, p.advance()
+		}
+		n, err := p.pipe()
+		if err != nil {
+			return nil, err
+		}
+		return collectNode{n}, p.expect("]")
+	case p.is("<"):
+		return p.record()
+	case p.is("{"):
+		return p.dict()
+	case p.tok.kind == tokIdent:
+		return p.builtin()
+	}
+	return nil, p.error("expected a filter")
+}
+
+func (p *parser) record() (node, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var parts []node
+	for !p.is(">") {
+		if p.tok.kind == tokEOF {
+			return nil, p.error("unterminated record")
+		}
+		n, err := p.postfix()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, n)
+	}
+	if len(parts) == 0 {
+		return nil, p.error("record without a label")
+	}
+	return recordNode{parts}, p.advance()
+}
+
+func (p *parser) dict() (node, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var entries [][2]node
+	for !p.is("}") {
+		if len(entries) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		var key node
+		var err error
+		if p.tok.kind == tokIdent {
+			key = literalNode{syrup.NewString(p.tok.text)}
+			err = p.advance()
+		} else {
+			key, err = p.postfix()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		val, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, [2]node{key, val})
+	}
+	return dictNode{entries}, p.advance()
+}
+
+func (p *parser) builtin() (node, error) {
+	name := p.tok.text
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	switch name {
+	case "label":
+		return nameNode{name: "label", record: true}, nil
+	case "length", "keys", "kind", "not", "empty":
+		return funcNode{name}, nil
+	case "select":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		cond, err := p.pipe()
+		if err != nil {
+			return nil, err
+		}
+		return selectNode{cond}, p.expect(")")
+	}
+	return nil, &SyntaxError{Msg: fmt.Sprintf("unknown function %s", name), Offset: p.tok.offset - len(name)}
+}
@@ -0,0 +1,124 @@
+// Package query filters and transforms Syrup values using a small language in
+// the style of jq.
+//
+// A query is a filter which turns each input value into zero or more output
+// values. The filters are:
+//
+//	.                 the input itself
+//	.name             the dictionary entry with the string or symbol key name,
+//	                  or the label of a record for .label
+//	.[q]              for each output of q: the element at that index of a
+//	                  list, set, or record's values, counting back from the
+//	                  end when negative, or else the dictionary entry with
+//	                  that key
+//	.[]               every element of a list or set, value of a record, or
+//	                  value of a dictionary
+//	"s" 'sym 12 1.5 #t #f
+//	                  a string, symbol, integer, double, or boolean literal
+//	a | b             each output of b for each output of a
+//	a, b              the outputs of a followed by those of b
+//	a == b            also !=, <, <=, >, and >=, comparing each output of a
+//	                  with each output of b using syrup.Compare
+//	a and b, a or b   booleans, where only #f is false
+//	[q]               a list of every output of q
+//	<l q1 q2>         a record for each output of l, q1, and q2
+//	{k: q, name: q}   a dictionary for each output of the key and value
+//	                  filters, where a bare name is a string key and a
+//	                  value containing '|' or ',' must be parenthesized
+//	(q)               grouping
+//
+// Selectors may be chained after any filter, as in .manifest[3].label, where
+// a '[' directly following a filter without whitespace indexes it.
+//
+// The built in functions are:
+//
+//	label             the label of a record
+//	length            the number of elements or entries of a compound value,
+//	                  or bytes of an atom
+//	keys              a list of the keys of a dictionary, in order
+//	kind              the kind of the input, as a symbol such as 'record
+//	select(q)         the input, when any output of q is true
+//	not               the negation of a boolean
+//	empty             no output
+//
+// For example, the following outputs each value of every record labeled
+// op:deliver:
+//
+//	select(label == 'op:deliver) | .[]
+//
+// Symbols may contain ':', so a symbol key of a dictionary is written
+// '|name|: q.
+//
+// Missing dictionary entries produce no output, while selecting from a value
+// of the wrong kind is an error.
+package query
+
+import (
+	"io"
+
+	"github.com/cjslep/syrup"
+)
+
+// Query is a parsed query, which may be evaluated any number of times and is
+// safe for concurrent use.
+type Query struct {
+	src  string
+	root node
+}
+
+// Parse parses the text of a query.
+func Parse(src string) (*Query, error) {
+	p := &parser{lex: lexer{src: src}}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &Query{src: src, root: root}, nil
+}
+
+// MustParse is like Parse but panics if the query cannot be parsed. It
+// simplifies initializing global variables holding queries.
+func MustParse(src string) *Query {
+	q, err := Parse(src)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// String returns the text the query was parsed from.
+func (q *Query) String() string {
+	return q.src
+}
+
+// Eval returns the outputs of the query for the input, which may be any value
+// syrup.ValueOf accepts.
+func (q *Query) Eval(v interface{}) ([]syrup.Value, error) {
+	in, err := syrup.ValueOf(v)
+	if err != nil {
+		return nil, err
+	}
+	return q.root.eval(in)
+}
+
+// Run evaluates the query over every value decoded by d, calling emit with
+// each output, until the stream is exhausted or emit returns an error.
+func (q *Query) Run(d *syrup.Decoder, emit func(syrup.Value) error) error {
+	for {
+		var in syrup.Value
+		if err := d.Decode(&in); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		outs, err := q.root.eval(in)
+		if err != nil {
+			return err
+		}
+		for _, out := range outs {
+			if err := emit(out); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package query
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cjslep/syrup"
+)
+
+func TestEval(t *testing.T) {
+	in := parseText(t, `{
+		"name": "carol",
+		age: 30,
+		"pets": ["cat" "dog" "eel"],
+		"msgs": [<|op:deliver| 1 "hi"> <|op:abort|> <|op:deliver| 2 "bye">],
+	}`)
+	tests := []struct {
+		query  string
+		expect string
+	}{
+		{".", `{age: 30, "msgs": [<|op:deliver| 1 "hi"> <|op:abort|> <|op:deliver| 2 "bye">], "name": "carol", "pets": ["cat" "dog" "eel"]}`},
+		{".name", `"carol"`},
+		{".age", `30`},
+		{".missing", ``},
+		{`."pets"[1]`, `"dog"`},
+		{".pets[-1]", `"eel"`},
+		{".pets[5]", ``},
+		{".pets[]", `"cat" "dog" "eel"`},
+		{".pets[0, 2]", `"cat" "eel"`},
+		{".pets | length", `3`},
+		{".name, .age", `"carol" 30`},
+		{".msgs[] | label", `|op:deliver| |op:abort| |op:deliver|`},
+		{".msgs[0].label", `|op:deliver|`},
+		{".msgs[] | select(label == 'op:deliver) | .[1]", `"hi" "bye"`},
+		{"[.msgs[] | select(length > 0) | .[0]]", `[1 2]`},
+		{"[.msgs[] | select(length == 0)] | length", `1`},
+		{".age >= 18 and .age < 65", `#t`},
+		{".age < 18 or .name == \"carol\"", `#t`},
+		{".age | not", `#f`},
+		{"keys", `[age "msgs" "name" "pets"]`},
+		{".pets, .msgs[1], .age | kind", `list record int`},
+		{"<'person .name .age>", `<person "carol" 30>`},
+		{"<'pet .pets[]>", `<pet "cat"> <pet "dog"> <pet "eel">`},
+		{"{who: .name, '|n|: (.pets | length)}", `{"who": "carol", n: 3}`},
+		{"{a: 1, a: 2}", `{"a": 2}`},
+		{"[]", `[]`},
+		{"[empty]", `[]`},
+		{"(1, 2) | [., .]", `[1 1] [2 2]`},
+		{"#t, #f, -1.5, 'sym, '|two words|", `#t #f -1.5 sym |two words|`},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			outs, err := MustParse(test.query).Eval(in)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			var got []string
+			for _, out := range outs {
+				got = append(got, fmt.Sprint(out))
+			}
+			if s := strings.Join(got, " "); s != test.expect {
+				t.Errorf("got %s, want %s", s, test.expect)
+			}
+		})
+	}
+}
+
+// parseText returns the value of the Preserves text, with dictionaries in
+// canonical order.
+func parseText(t *testing.T, text string) syrup.Value {
+	t.Helper()
+	v, err := syrup.ParseText(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	e := syrup.NewEncoder(syrup.NewPrototypeEncoding(), &b)
+	e.SetCanonical(true)
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	var out syrup.Value
+	if err := syrup.NewDecoder(syrup.NewPrototypeEncoding(), &b).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		in    interface{}
+	}{
+		{".name", []interface{}{1}},
+		{".[0]", "str"},
+		{`.["a"]`, []interface{}{1}},
+		{".[]", int64(1)},
+		{"label", map[string]interface{}{"label": 1}},
+		{"keys", []interface{}{}},
+		{"length", true},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			if outs, err := MustParse(test.query).Eval(test.in); err == nil {
+				t.Errorf("got %v, want an error", outs)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query  string
+		offset int
+	}{
+		{"", 0},
+		{".a |", 4},
+		{".[1", 3},
+		{"(.", 2},
+		{"<>", 1},
+		{"<'a", 3},
+		{"{a 1}", 3},
+		{"frobnicate", 0},
+		{"select 1", 7},
+		{`"open`, 0},
+		{"' ", 0},
+		{". .", 2},
+		{". [1]", 2},
+		{". .", 2},
+		{". [1]", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			_, err := Parse(test.query)
+			serr, ok := err.(*SyntaxError)
+			if !ok {
+				t.Fatalf("got %v, want a *SyntaxError", err)
+			}
+			if serr.Offset != test.offset {
+				t.Errorf("got offset %d, want %d: %v", serr.Offset, test.offset, err)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	d := syrup.NewDecoder(syrup.NewPrototypeEncoding(), strings.NewReader("<3'msgi1e><3'msgi2e>i3e"))
+	var got []string
+	err := MustParse("select(kind == 'record) | .[0]").Run(d, func(v syrup.Value) error {
+		got = append(got, fmt.Sprint(v))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if s := strings.Join(got, " "); s != "1 2" {
+		t.Errorf("got %s, want 1 2", s)
+	}
+}
@@ -0,0 +1,115 @@
+package syrup
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Record1 is a record holding one value of type A. Unlike the values of a
+// Record, it is encoded and decoded directly, and decoding checks that a
+// record holds exactly one value of the type.
+type Record1[A any] struct {
+	Label Symbol
+	A     A
+}
+
+// MarshalSyrup implements Marshaler.
+func (r Record1[A]) MarshalSyrup(e *Encoder) error {
+	return e.encodeRecordOf(r.Label, &r.A)
+}
+
+// UnmarshalSyrup implements Unmarshaler.
+func (r *Record1[A]) UnmarshalSyrup(d *Decoder) error {
+	return d.decodeRecordOf(reflect.TypeOf(*r), &r.Label, &r.A)
+}
+
+// Record2 is a record holding two values of types A and B, as for Record1.
+type Record2[A, B any] struct {
+	Label Symbol
+	A     A
+	B     B
+}
+
+// MarshalSyrup implements Marshaler.
+func (r Record2[A, B]) MarshalSyrup(e *Encoder) error {
+	return e.encodeRecordOf(r.Label, &r.A, &r.B)
+}
+
+// UnmarshalSyrup implements Unmarshaler.
+func (r *Record2[A, B]) UnmarshalSyrup(d *Decoder) error {
+	return d.decodeRecordOf(reflect.TypeOf(*r), &r.Label, &r.A, &r.B)
+}
+
+// Record3 is a record holding three values of types A, B, and C, as for
+// Record1.
+type Record3[A, B, C any] struct {
+	Label Symbol
+	A     A
+	B     B
+	C     C
+}
+
+// MarshalSyrup implements Marshaler.
+func (r Record3[A, B, C]) MarshalSyrup(e *Encoder) error {
+	return e.encodeRecordOf(r.Label, &r.A, &r.B, &r.C)
+}
+
+// UnmarshalSyrup implements Unmarshaler.
+func (r *Record3[A, B, C]) UnmarshalSyrup(d *Decoder) error {
+	return d.decodeRecordOf(reflect.TypeOf(*r), &r.Label, &r.A, &r.B, &r.C)
+}
+
+// encodeRecordOf writes a record with the label holding the values pointed
+// to by ptrs.
+func (e *Encoder) encodeRecordOf(label Symbol, ptrs ...interface{}) error {
+	if err := e.open(openRecordOp); err != nil {
+		return err
+	}
+	e.push(RecordLabel{})
+	if err := e.writeValue(e.enc.fmtSymbol(string(label))); err != nil {
+		return err
+	}
+	e.pop()
+	for i, p := range ptrs {
+		e.push(i)
+		if err := e.encode(reflect.ValueOf(p).Elem()); err != nil {
+			return err
+		}
+		e.pop()
+	}
+	return e.close(closeRecordOp)
+}
+
+// decodeRecordOf reads a record into the label and the values pointed to by
+// ptrs, which must be as many as the record holds. Errors report the type t.
+func (d *Decoder) decodeRecordOf(t reflect.Type, label *Symbol, ptrs ...interface{}) error {
+	oper, err := d.nextOp()
+	if err != nil {
+		return err
+	} else if oper != openRecordOp {
+		return d.typeError(oper, t)
+	}
+	d.n++
+	if last, err := d.runKey(reflect.ValueOf(label), nil); err != nil {
+		return err
+	} else if last == closeRecordOp {
+		return &InvalidTypeError{Value: "record without a label", Type: t, Offset: d.n}
+	}
+	n := 0
+	for ; ; n++ {
+		var v reflect.Value
+		if n < len(ptrs) {
+			v = reflect.ValueOf(ptrs[n]).Elem()
+		}
+		last, err := d.run(v)
+		if err != nil {
+			return err
+		} else if last == closeRecordOp {
+			break
+		}
+	}
+	if n != len(ptrs) {
+		return &InvalidTypeError{Value: fmt.Sprintf("record of %d values", n), Type: t, Offset: d.n}
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package syrup
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// The typed methods below encode and decode single values without the
+// reflection done by Encode and Decode, for use by Marshalers and
+// Unmarshalers such as those generated by syrup-marshalgen. They write and
+// read the same bytes as Encode and Decode do for values of the same types.
+
+// EncodeBool writes b as a bool.
+func (e *Encoder) EncodeBool(b bool) error {
+	return e.writeValue(e.enc.fmtBool(b))
+}
+
+// EncodeInt writes i as an integer.
+func (e *Encoder) EncodeInt(i int64) error {
+	return e.writeValue(e.enc.fmtInt(i))
+}
+
+// EncodeUint writes u as an integer.
+func (e *Encoder) EncodeUint(u uint64) error {
+	return e.writeValue(e.enc.fmtUint(u))
+}
+
+// EncodeFloat32 writes f as a single precision float.
+func (e *Encoder) EncodeFloat32(f float32) error {
+	return e.writeValue(e.enc.fmtFloat32(f))
+}
+
+// EncodeFloat64 writes f as a double precision float.
+func (e *Encoder) EncodeFloat64(f float64) error {
+	return e.writeValue(e.enc.fmtFloat64(f))
+}
+
+// EncodeString writes s as a string.
+func (e *Encoder) EncodeString(s string) error {
+	return e.writeValue(e.enc.fmtString(s))
+}
+
+// EncodeBytes writes b as a bytestring. A nil b is handled according to the
+// Encoder's NilPolicy, as Encode does.
+func (e *Encoder) EncodeBytes(b []byte) error {
+	if b == nil {
+		return e.Encode(b)
+	}
+	return e.writeValue(e.enc.fmtBytes(b))
+}
+
+// EncodeSymbol writes s as a symbol.
+func (e *Encoder) EncodeSymbol(s Symbol) error {
+	return e.writeValue(e.enc.fmtSymbol(string(s)))
+}
+
+// OmitField reports whether Encode omits the struct field pointed to by ptr
+// from the dictionary a struct is encoded as: either because it is nil and
+// the NilPolicy is NilOmitted, or because it is optional and holds its zero
+// value. It is used by generated Marshalers for fields of types they cannot
+// inspect themselves.
+func (e *Encoder) OmitField(ptr interface{}, optional bool) bool {
+	v := reflect.ValueOf(ptr).Elem()
+	return e.omitNil(v) || optional && v.IsZero()
+}
+
+var (
+	typeOfBool    = reflect.TypeOf(false)
+	typeOfString  = reflect.TypeOf("")
+	typeOfFloat32 = reflect.TypeOf(float32(0))
+	typeOfFloat64 = reflect.TypeOf(float64(0))
+	intTypes      = map[int]reflect.Type{
+		8:  reflect.TypeOf(int8(0)),
+		16: reflect.TypeOf(int16(0)),
+		32: reflect.TypeOf(int32(0)),
+		64: reflect.TypeOf(int64(0)),
+	}
+	uintTypes = map[int]reflect.Type{
+		8:  reflect.TypeOf(uint8(0)),
+		16: reflect.TypeOf(uint16(0)),
+		32: reflect.TypeOf(uint32(0)),
+		64: reflect.TypeOf(uint64(0)),
+	}
+)
+
+// opValues describes the value beginning with each op in errors.
+var opValues = map[op]string{
+	valBoolop:      "bool",
+	valByteArrOp:   "bytestring",
+	valSymbolOp:    "symbol",
+	valStringOp:    "string",
+	valIntOp:       "integer",
+	valFloat32Op:   "single precision float",
+	valFloat64Op:   "double precision float",
+	valExtensionOp: "extension",
+	openListOp:     "list",
+	openDictOp:     "dict",
+	openSetOp:      "set",
+	openRecordOp:   "record",
+}
+
+// DecodeBool reads the next value, which must be a bool.
+func (d *Decoder) DecodeBool() (bool, error) {
+	oper, err := d.nextOp()
+	if err != nil {
+		return false, err
+	} else if oper != valBoolop {
+		return false, d.typeError(oper, typeOfBool)
+	}
+	b, err := d.s.Bool()
+	d.n++
+	return b, err
+}
+
+// DecodeInt reads the next value, which must be an integer that fits in a
+// signed integer of the given bit size. A bit size of 0 is that of int.
+func (d *Decoder) DecodeInt(bitSize int) (int64, error) {
+	if bitSize == 0 {
+		bitSize = strconv.IntSize
+	}
+	oper, err := d.nextOp()
+	if err != nil {
+		return 0, err
+	} else if oper != valIntOp {
+		return 0, d.typeError(oper, intTypes[bitSize])
+	}
+	i, bi, err := d.s.Int64()
+	d.n++
+	if err != nil {
+		return 0, err
+	} else if bi != nil {
+		return 0, &OverflowError{Value: bi.String(), Type: intTypes[bitSize], Offset: d.n}
+	} else if shift := uint(64 - bitSize); i<<shift>>shift != i {
+		return 0, &OverflowError{Value: strconv.FormatInt(i, 10), Type: intTypes[bitSize], Offset: d.n}
+	}
+	return i, nil
+}
+
+// DecodeUint reads the next value, which must be an integer that fits in an
+// unsigned integer of the given bit size. A bit size of 0 is that of uint.
+func (d *Decoder) DecodeUint(bitSize int) (uint64, error) {
+	if bitSize == 0 {
+		bitSize = strconv.IntSize
+	}
+	oper, err := d.nextOp()
+	if err != nil {
+		return 0, err
+	} else if oper != valIntOp {
+		return 0, d.typeError(oper, uintTypes[bitSize])
+	}
+	i, bi, err := d.s.Int64()
+	d.n++
+	var u uint64
+	if err != nil {
+		return 0, err
+	} else if bi != nil {
+		if !bi.IsUint64() {
+			return 0, &OverflowError{Value: bi.String(), Type: uintTypes[bitSize], Offset: d.n}
+		}
+		u = bi.Uint64()
+	} else if i < 0 {
+		return 0, &OverflowError{Value: strconv.FormatInt(i, 10), Type: uintTypes[bitSize], Offset: d.n}
+	} else {
+		u = uint64(i)
+	}
+	if shift := uint(64 - bitSize); u<<shift>>shift != u {
+		return 0, &OverflowError{Value: strconv.FormatUint(u, 10), Type: uintTypes[bitSize], Offset: d.n}
+	}
+	return u, nil
+}
+
+// DecodeFloat reads the next value, which must be a single or double
+// precision float that fits in a float of the given bit size, 32 or 64.
+func (d *Decoder) DecodeFloat(bitSize int) (float64, error) {
+	t := typeOfFloat64
+	if bitSize == 32 {
+		t = typeOfFloat32
+	}
+	oper, err := d.nextOp()
+	if err != nil {
+		return 0, err
+	}
+	var f float64
+	switch oper {
+	case valFloat32Op:
+		var f32 float32
+		f32, err = d.s.Float32()
+		f = float64(f32)
+	case valFloat64Op:
+		f, err = d.s.Float64()
+	default:
+		return 0, d.typeError(oper, t)
+	}
+	d.n++
+	if err != nil {
+		return 0, err
+	} else if bitSize == 32 && math.MaxFloat32 < math.Abs(f) && !math.IsInf(f, 0) {
+		return 0, &InvalidTypeError{Value: opValues[oper] + " overflow", Type: t, Offset: d.n}
+	}
+	return f, nil
+}
+
+// DecodeString reads the next value, which must be a string or bytestring.
+func (d *Decoder) DecodeString() (string, error) {
+	oper, err := d.nextOp()
+	if err != nil {
+		return "", err
+	}
+	var s string
+	switch oper {
+	case valStringOp:
+		s, err = d.s.String()
+	case valByteArrOp:
+		var b []byte
+		b, err = d.s.Bytes()
+		s = string(b)
+	default:
+		return "", d.typeError(oper, typeOfString)
+	}
+	d.n++
+	return s, err
+}
+
+// DecodeBytes reads the next value, which must be a bytestring or string.
+func (d *Decoder) DecodeBytes() ([]byte, error) {
+	oper, err := d.nextOp()
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	switch oper {
+	case valByteArrOp:
+		b, err = d.s.Bytes()
+	case valStringOp:
+		var s string
+		s, err = d.s.String()
+		b = []byte(s)
+	default:
+		return nil, d.typeError(oper, typeOfByteSlice)
+	}
+	d.n++
+	return b, err
+}
+
+// DecodeSymbol reads the next value, which must be a symbol. As with Decode,
+// a string or bytestring is also accepted.
+func (d *Decoder) DecodeSymbol() (Symbol, error) {
+	oper, err := d.nextOp()
+	if err != nil {
+		return "", err
+	}
+	var s string
+	switch oper {
+	case valSymbolOp:
+		var sym Symbol
+		sym, err = d.s.Symbol()
+		s = string(sym)
+	case valStringOp:
+		s, err = d.s.String()
+	case valByteArrOp:
+		var b []byte
+		b, err = d.s.Bytes()
+		s = string(b)
+	default:
+		return "", d.typeError(oper, typeOfSymbol)
+	}
+	d.n++
+	return Symbol(s), err
+}
+
+// DecodeKey reads the next value, which is the key of a dictionary entry, and
+// returns the name of the struct field it matches when decoding into a
+// struct. String and symbol keys are returned as is, while other keys are
+// read and discarded, returning the empty string.
+func (d *Decoder) DecodeKey() (string, error) {
+	oper, err := d.nextOp()
+	if err != nil {
+		return "", err
+	}
+	switch oper {
+	case valStringOp:
+		d.n++
+		return d.s.String()
+	case valSymbolOp:
+		d.n++
+		s, err := d.s.Symbol()
+		return string(s), err
+	}
+	return "", d.skip(oper)
+}
+
+// Skip reads the next value and discards it.
+func (d *Decoder) Skip() error {
+	oper, err := d.nextOp()
+	if err != nil {
+		return err
+	}
+	return d.skip(oper)
+}
+
+// skip discards the value beginning with oper.
+func (d *Decoder) skip(oper op) (err error) {
+	for depth := 0; ; {
+		switch {
+		case isCloseOp(oper):
+			if depth == 0 {
+				return fmt.Errorf("syrup: expected a value but found the end of a compound value at byte offset %d", d.n)
+			}
+			depth--
+		case oper >= openListOp && oper <= openRecordOp:
+			depth++
+		default:
+			if _, err = d.token(oper); err != nil {
+				return err
+			}
+		}
+		d.n++
+		if depth == 0 {
+			return nil
+		}
+		if oper, err = d.nextOp(); err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// typeError reports that the value beginning with oper cannot be decoded
+// into the type t, after reading the value when it is a scalar.
+func (d *Decoder) typeError(oper op, t reflect.Type) error {
+	if isCloseOp(oper) {
+		return fmt.Errorf("syrup: expected a value but found the end of a compound value at byte offset %d", d.n)
+	} else if _, ok := delimOps[oper]; !ok {
+		if _, err := d.token(oper); err != nil {
+			return err
+		}
+		d.n++
+	}
+	return &InvalidTypeError{Value: opValues[oper], Type: t, Offset: d.n}
+}
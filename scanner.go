@@ -18,6 +18,8 @@ const (
 	scanFloat32
 	scanSymbol
 	scanByteArr
+	scanExtension
+	scanIntBytes
 )
 
 type op uint8
@@ -39,13 +41,28 @@ const (
 	closeDictOp
 	closeSetOp
 	closeRecordOp
+	valExtensionOp
+	// closeAnyOp is returned by an Encoding using a single delimiter to
+	// close every kind of compound value. The scanner replaces it with the
+	// close op matching the innermost open value.
+	closeAnyOp
 )
 
+// scanner holds all of the mutable state needed to scan a stream of bytes
+// using an Encoding, so that a single Encoding can be shared between Decoders.
 type scanner struct {
-	enc  *Encoding
-	s    scanState
-	buf  strings.Builder
+	enc *Encoding
+	s   scanState
+	buf strings.Builder
+	// nlen counts the bytes remaining in a length-determined type or a
+	// fixed-width floating point number.
 	nlen uint64
+	// marker is the Extension marker of the value being scanned.
+	marker byte
+	// tag is the byte that began a length-prefixed value.
+	tag byte
+	// open holds the open ops of the compound values being scanned.
+	open []op
 }
 
 // Process handles one byte of input at a time, processing the syrup encoding
@@ -82,20 +99,27 @@ func (s *scanner) Process(b byte) (oper op, err error) {
 		next, oper, include = s.processLengthDeterminedType(valStringOp)
 	case scanByteArr:
 		next, oper, include = s.processLengthDeterminedType(valByteArrOp)
+	case scanExtension:
+		next, oper, include = s.processLengthDeterminedType(valExtensionOp)
+	case scanIntBytes:
+		next, oper, include = s.processLengthDeterminedType(valIntOp)
 	case scanInt:
 		next, oper, include, err = s.enc.scanIntToken(b)
 	case scanFirstInt:
 		next, oper, include, err = s.enc.scanFirstIntToken(b)
 	case scanFloat64:
-		next, oper, include, err = s.enc.scanFloat64Token(b)
+		next, oper, include, err = s.processFixedWidthType(s.enc.scanFloat64Token, "float64")
 	case scanFloat32:
-		next, oper, include, err = s.enc.scanFloat32Token(b)
+		next, oper, include, err = s.processFixedWidthType(s.enc.scanFloat32Token, "float32")
 	default:
 		err = fmt.Errorf("syrup unknown scanstate: %d", s.s)
 	}
 	if err != nil {
 		return
 	}
+	if oper, err = s.processNesting(oper); err != nil {
+		return
+	}
 
 	// 2. Include the bytes into the buffer if necessary.
 	if include {
@@ -107,23 +131,66 @@ func (s *scanner) Process(b byte) (oper op, err error) {
 	//
 	// Unfortunately this is a leak between the encoding and this generic
 	// scanner.
+	if s.s == scanFindToken && next == scanTokenLen {
+		s.tag = b
+	}
 	if s.s == scanTokenLen && next != scanTokenLen {
-		if oper, err = s.processParsedLen(next); err != nil {
+		if next == scanExtension {
+			s.marker = b
+		}
+		if next, oper, err = s.processParsedLen(next); err != nil {
 			return
 		}
+		if oper != noop {
+			// A zero length value is already complete.
+			next = scanFindToken
+		}
 	}
-	// 4. Finally, transition to the next state.
+	// 4. When starting a floating point number, count down its bytes.
+	if s.s != next {
+		switch next {
+		case scanFloat32:
+			s.nlen = 4
+		case scanFloat64:
+			s.nlen = 8
+		}
+	}
+	// 5. Finally, transition to the next state.
 	s.s = next
-	// 5. If a value-op was returned, it is up to the caller to ensure they
+	// 6. If a value-op was returned, it is up to the caller to ensure they
 	// call one of the value functions, which has the side effect of
 	// clearing the internal buffer.
 	return
 }
 
-func (s *scanner) processParsedLen(next scanState) (oper op, err error) {
-	oper, s.nlen, err = s.enc.parseLen(s.buf.String(), next)
+func (s *scanner) processParsedLen(next scanState) (scanState, op, error) {
+	next, oper, n, err := s.enc.parseLen(s.buf.String(), s.tag, next)
+	s.nlen = n
 	s.buf.Reset()
-	return
+	return next, oper, err
+}
+
+// processNesting tracks the compound values that are open, resolving a
+// closeAnyOp into the specific close op.
+func (s *scanner) processNesting(oper op) (op, error) {
+	switch oper {
+	case openListOp, openDictOp, openSetOp, openRecordOp:
+		s.open = append(s.open, oper)
+	case closeListOp, closeDictOp, closeSetOp, closeRecordOp, closeAnyOp:
+		if len(s.open) == 0 {
+			if oper == closeAnyOp {
+				return noop, fmt.Errorf("syrup end marker outside of a compound value")
+			}
+			return oper, nil
+		}
+		top := s.open[len(s.open)-1]
+		s.open = s.open[:len(s.open)-1]
+		if oper == closeAnyOp {
+			// Close ops are declared in the same order as open ops.
+			oper = top + (closeListOp - openListOp)
+		}
+	}
+	return oper, nil
 }
 
 func (s *scanner) processLengthDeterminedType(maybeOp op) (next scanState, oper op, include bool) {
@@ -137,6 +204,14 @@ func (s *scanner) processLengthDeterminedType(maybeOp op) (next scanState, oper
 	return
 }
 
+func (s *scanner) processFixedWidthType(scan func(n uint64) (scanState, op, bool, error), name string) (scanState, op, bool, error) {
+	if s.nlen == 0 {
+		return scanFindToken, noop, false, fmt.Errorf("missing %s syrup delimiter or too many calls to parse %s", name, name)
+	}
+	s.nlen--
+	return scan(s.nlen)
+}
+
 func (s *scanner) Bool() (bool, error) {
 	b, err := s.enc.boolVal([]byte(s.buf.String()))
 	s.buf.Reset()
@@ -178,3 +253,14 @@ func (s *scanner) Float64() (float64, error) {
 	s.buf.Reset()
 	return f, err
 }
+
+func (s *scanner) Extension() (interface{}, error) {
+	x, ok := s.enc.extMarkers[s.marker]
+	if !ok {
+		s.buf.Reset()
+		return nil, fmt.Errorf("syrup unknown extension marker: %v", s.marker)
+	}
+	v, err := x.Unmarshal([]byte(s.buf.String()))
+	s.buf.Reset()
+	return v, err
+}
@@ -0,0 +1,569 @@
+package schema
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cjslep/syrup"
+)
+
+// SyntaxError describes a schema that cannot be parsed.
+type SyntaxError struct {
+	Msg string
+	// Offset is the byte offset of the error within the schema.
+	Offset int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syrup schema: syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+// Parse parses the text of a schema. Every definition referred to must be
+// defined, and a definition may only refer to itself from within a list, set,
+// dictionary, or record.
+func Parse(src string) (*Schema, error) {
+	p := &parser{lex: lexer{src: src}}
+	return p.parse()
+}
+
+// MustParse is like Parse but panics if the schema cannot be parsed. It
+// simplifies initializing global variables holding schemas.
+func MustParse(src string) *Schema {
+	s, err := Parse(src)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Read parses the text of a schema from r.
+func Read(r io.Reader) (*Schema, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(string(b))
+}
+
+var atoms = map[string]Pattern{
+	"any":    Any{},
+	"bool":   Atom{syrup.BoolKind},
+	"float":  Atom{syrup.Float32Kind},
+	"double": Atom{syrup.Float64Kind},
+	"int":    Atom{syrup.IntKind},
+	"string": Atom{syrup.StringKind},
+	"bytes":  Atom{syrup.BytesKind},
+	"symbol": Atom{syrup.SymbolKind},
+}
+
+type tokenKind uint8
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	// tokSymbol is a bare symbol.
+	tokSymbol
+	// tokLiteral is a string, integer, boolean, or quoted symbol.
+	tokLiteral
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	lit    syrup.Value
+	offset int
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+var punctuation = []string{"...:...", "...", "#{", "=", ".", "/", "<", ">", "[", "]", "{", "}", ":", "?", "@"}
+
+func (l *lexer) next() (token, error) {
+	l.skipSpace()
+	t := token{offset: l.pos}
+	if l.pos == len(l.src) {
+		return t, nil
+	}
+	rest := l.src[l.pos:]
+	c := rest[0]
+	switch {
+	case c == '"' || c == '|':
+		end, s, err := unquote(rest)
+		if err != nil {
+			return t, l.error(err.Error())
+		}
+		l.pos += end
+		t.kind, t.lit = tokLiteral, syrup.NewString(s)
+		if c == '|' {
+			t.lit = syrup.NewSymbol(syrup.Symbol(s))
+		}
+		return t, nil
+	case c == '#' && len(rest) > 1 && (rest[1] == 't' || rest[1] == 'f'):
+		l.pos += 2
+		t.kind, t.lit = tokLiteral, syrup.NewBool(rest[1] == 't')
+		return t, nil
+	case isDigit(c) || c == '-' && len(rest) > 1 && isDigit(rest[1]):
+		n := 1
+		for n < len(rest) && isDigit(rest[n]) {
+			n++
+		}
+		i, ok := new(big.Int).SetString(rest[:n], 10)
+		if !ok {
+			return t, l.error(fmt.Sprintf("malformed integer %s", rest[:n]))
+		}
+		l.pos += n
+		t.kind, t.lit = tokLiteral, syrup.NewBigInt(i)
+		if i.IsInt64() {
+			t.lit = syrup.NewInt(i.Int64())
+		}
+		return t, nil
+	}
+	if n := symbolLen(rest); n > 0 {
+		l.pos += n
+		t.kind, t.text = tokSymbol, rest[:n]
+		return t, nil
+	}
+	for _, p := range punctuation {
+		if strings.HasPrefix(rest, p) {
+			l.pos += len(p)
+			t.kind, t.text = tokPunct, p
+			return t, nil
+		}
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return t, l.error(fmt.Sprintf("unexpected %q", r))
+}
+
+// skipSpace skips whitespace, commas, and comments.
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case ' ', '\t', '\r', '\n', ',':
+			l.pos++
+		case ';':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) error(msg string) error {
+	return &SyntaxError{Msg: msg, Offset: l.pos}
+}
+
+// symbolLen returns the length of the bare symbol at the start of s. A ':' is
+// only part of a symbol when another symbol character follows it.
+func symbolLen(s string) int {
+	n := 0
+	for n < len(s) {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !isSymbolRune(r) || r == ':' && (n == 0 || n+1 == len(s) || !isSymbolRune(rune(s[n+1]))) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// unquote reads a quoted string or symbol at the start of s, returning the
+// number of bytes read.
+func unquote(s string) (int, string, error) {
+	quote := s[0]
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case quote:
+			return i + 1, sb.String(), nil
+		case '\\':
+			if i+1 == len(s) {
+				break
+			}
+			i++
+			switch e := s[i]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			default:
+				sb.WriteByte(e)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return 0, "", fmt.Errorf("unterminated %c", quote)
+}
+
+type parser struct {
+	lex lexer
+	tok token
+	// refs holds every reference, to check once all definitions are
+	// parsed.
+	refs []token
+	// names holds the name of every definition, in order.
+	names []token
+}
+
+func (p *parser) advance() error {
+	t, err := p.lex.next()
+	p.tok = t
+	return err
+}
+
+func (p *parser) is(text string) bool {
+	return p.tok.kind == tokPunct && p.tok.text == text
+}
+
+func (p *parser) expect(text string) error {
+	if !p.is(text) {
+		return p.error(fmt.Sprintf("expected %q", text))
+	}
+	return p.advance()
+}
+
+func (p *parser) error(msg string) error {
+	if p.tok.kind == tokEOF {
+		msg += " at end of schema"
+	}
+	return &SyntaxError{Msg: msg, Offset: p.tok.offset}
+}
+
+func (p *parser) parse() (*Schema, error) {
+	s := &Schema{}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	for p.tok.kind != tokEOF {
+		name := p.tok
+		text, err := p.name()
+		if err != nil {
+			return nil, p.error("expected a definition")
+		}
+		name.text = text
+		if name.text == "version" && name.kind == tokSymbol && p.tok.kind == tokLiteral {
+			if err := p.advance(); err != nil {
+				return nil, err
+			} else if err := p.expect("."); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, ok := atoms[name.text]; ok {
+			return nil, &SyntaxError{Msg: fmt.Sprintf("cannot redefine %s", name.text), Offset: name.offset}
+		} else if _, ok := s.Lookup(name.text); ok {
+			return nil, &SyntaxError{Msg: fmt.Sprintf("%s is already defined", name.text), Offset: name.offset}
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		pat, err := p.union()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("."); err != nil {
+			return nil, err
+		}
+		s.Definitions = append(s.Definitions, Definition{Name: name.text, Pattern: pat})
+		p.names = append(p.names, name)
+	}
+	for _, ref := range p.refs {
+		if _, ok := s.Lookup(ref.text); !ok {
+			return nil, &SyntaxError{Msg: fmt.Sprintf("%s is not defined", ref.text), Offset: ref.offset}
+		}
+	}
+	for i, d := range s.Definitions {
+		if refersTo(s, d.Pattern, d.Name, map[string]bool{}) {
+			return nil, &SyntaxError{Msg: fmt.Sprintf("%s refers to itself outside of a list, set, dictionary, or record", d.Name), Offset: p.names[i].offset}
+		}
+	}
+	return s, nil
+}
+
+// refersTo reports whether p refers to the named definition without an
+// enclosing compound pattern. Such a reference would match a value against
+// itself forever without consuming any of it.
+func refersTo(s *Schema, p Pattern, name string, seen map[string]bool) bool {
+	switch p := p.(type) {
+	case Ref:
+		if p.Name == name {
+			return true
+		} else if seen[p.Name] {
+			return false
+		}
+		seen[p.Name] = true
+		def, _ := s.Lookup(p.Name)
+		return refersTo(s, def, name, seen)
+	case Union:
+		for _, a := range p.Alternatives {
+			if refersTo(s, a.Pattern, name, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// union parses one or more alternatives separated by '/', allowing a leading
+// '/'.
+func (p *parser) union() (Pattern, error) {
+	if p.is("/") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	var u Union
+	var offsets []int
+	for {
+		offset := p.tok.offset
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		u.Alternatives = append(u.Alternatives, Alternative(f))
+		offsets = append(offsets, offset)
+		if !p.is("/") {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if len(u.Alternatives) == 1 {
+		return u.Alternatives[0].Pattern, nil
+	}
+	for i := range u.Alternatives {
+		a := &u.Alternatives[i]
+		if a.Name == "" {
+			a.Name = defaultName(a.Pattern)
+		}
+		if a.Name == "" {
+			return nil, &SyntaxError{Msg: "alternative needs a name", Offset: offsets[i]}
+		}
+		for _, other := range u.Alternatives[:i] {
+			if other.Name == a.Name {
+				return nil, &SyntaxError{Msg: fmt.Sprintf("alternative %s is already defined", a.Name), Offset: offsets[i]}
+			}
+		}
+	}
+	return u, nil
+}
+
+func (p *parser) field() (Field, error) {
+	var f Field
+	if p.is("@") {
+		if err := p.advance(); err != nil {
+			return f, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return f, err
+		}
+		f.Name = name
+	}
+	var err error
+	f.Pattern, err = p.pattern()
+	return f, err
+}
+
+// name parses a bare or quoted symbol.
+func (p *parser) name() (string, error) {
+	var name string
+	switch {
+	case p.tok.kind == tokSymbol:
+		name = p.tok.text
+	case p.tok.kind == tokLiteral && p.tok.lit.Kind() == syrup.SymbolKind:
+		name = string(p.tok.lit.Symbol())
+	default:
+		return "", p.error("expected a name")
+	}
+	return name, p.advance()
+}
+
+// literal parses a literal value, where a bare symbol is a symbol.
+func (p *parser) literal() (syrup.Value, error) {
+	var v syrup.Value
+	switch {
+	case p.is("="):
+		if err := p.advance(); err != nil {
+			return v, err
+		}
+		name, err := p.name()
+		return syrup.NewSymbol(syrup.Symbol(name)), err
+	case p.tok.kind == tokSymbol:
+		v = syrup.NewSymbol(syrup.Symbol(p.tok.text))
+	case p.tok.kind == tokLiteral:
+		v = p.tok.lit
+	default:
+		return v, p.error("expected a literal")
+	}
+	return v, p.advance()
+}
+
+func (p *parser) pattern() (Pattern, error) {
+	switch {
+	case p.is("="), p.tok.kind == tokLiteral && p.tok.lit.Kind() != syrup.SymbolKind:
+		v, err := p.literal()
+		return Literal{v}, err
+	case p.tok.kind == tokSymbol:
+		if atom, ok := atoms[p.tok.text]; ok {
+			return atom, p.advance()
+		}
+		fallthrough
+	case p.tok.kind == tokLiteral:
+		// A quoted symbol is always a reference.
+		t := p.tok
+		name, err := p.name()
+		t.text = name
+		p.refs = append(p.refs, t)
+		return Ref{name}, err
+	case p.is("<"):
+		return p.record()
+	case p.is("["):
+		return p.list()
+	case p.is("#{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		elem, err := p.pattern()
+		if err != nil {
+			return nil, err
+		}
+		return SetOf{elem}, p.expect("}")
+	case p.is("{"):
+		return p.dict()
+	}
+	return nil, p.error("expected a pattern")
+}
+
+func (p *parser) record() (Pattern, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	label, err := p.literal()
+	if err != nil {
+		return nil, err
+	}
+	fields, err := p.fields(">")
+	if err != nil {
+		return nil, err
+	}
+	return Record{Label: label, Fields: fields}, p.advance()
+}
+
+// fields parses fields until the closing punctuation, without consuming it.
+func (p *parser) fields(end string) ([]Field, error) {
+	var fields []Field
+	for !p.is(end) {
+		if p.tok.kind == tokEOF {
+			return nil, p.error(fmt.Sprintf("expected %q", end))
+		}
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func (p *parser) list() (Pattern, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var fields []Field
+	for !p.is("]") {
+		if p.is("...") {
+			if len(fields) != 1 || fields[0].Name != "" {
+				return nil, p.error("'...' must follow a single unnamed pattern")
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			return ListOf{fields[0].Pattern}, p.expect("]")
+		}
+		if p.tok.kind == tokEOF {
+			return nil, p.error(`expected "]"`)
+		}
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return Tuple{fields}, p.advance()
+}
+
+func (p *parser) dict() (Pattern, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var d Dict
+	for !p.is("}") {
+		// The key is a literal, unless this turns out to be a
+		// dictionary of any size, when it is reparsed as a pattern.
+		start, tok := p.lex, p.tok
+		key, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		e := Entry{Key: key}
+		if p.is("?") {
+			e.Optional = true
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if e.Pattern, err = p.pattern(); err != nil {
+			return nil, err
+		}
+		if p.is("...:...") {
+			if len(d.Entries) > 0 || e.Optional {
+				return nil, p.error("'...:...' must follow a single entry")
+			}
+			p.lex, p.tok = start, tok
+			return p.dictOf()
+		}
+		for _, other := range d.Entries {
+			if other.Key.Equal(key) {
+				return nil, &SyntaxError{Msg: fmt.Sprintf("duplicate key %v", key), Offset: tok.offset}
+			}
+		}
+		d.Entries = append(d.Entries, e)
+	}
+	return d, p.advance()
+}
+
+// dictOf parses the remainder of a dictionary of any size, from its key
+// pattern.
+func (p *parser) dictOf() (Pattern, error) {
+	key, err := p.pattern()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	val, err := p.pattern()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("...:..."); err != nil {
+		return nil, err
+	}
+	return DictOf{Key: key, Value: val}, p.expect("}")
+}
@@ -0,0 +1,274 @@
+package schema
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+
+	"github.com/cjslep/syrup"
+)
+
+var (
+	typeOfValue     = reflect.TypeOf(syrup.Value{})
+	typeOfSymbol    = reflect.TypeOf(syrup.Symbol(""))
+	typeOfByteSlice = reflect.TypeOf([]byte(nil))
+	typeOfByte      = typeOfByteSlice.Elem()
+	typeOfSet       = reflect.TypeOf(syrup.Set{})
+	typeOfRecord    = reflect.TypeOf(syrup.Record{})
+	typeOfBigInt    = reflect.TypeOf(big.Int{})
+	typeOfMarshaler = reflect.TypeOf((*syrup.Marshaler)(nil)).Elem()
+	typeOfLabeler   = reflect.TypeOf((*syrup.Labeler)(nil)).Elem()
+)
+
+// Reflect returns a schema describing how syrup's Encoder encodes the Go types
+// of the values, so that the values can be read without the Go source. Each
+// value, typically the zero value of its type, must be of a named type, which
+// is given a definition of the same name. So is every named struct, union, and
+// enumerated type they refer to, while other types are described where they
+// are used:
+//
+//   - structs implementing syrup.Labeler are records of their fields, labeled
+//     with the symbol returned by SyrupLabel
+//   - other structs are dictionaries keyed by the names of their fields, with
+//     optional fields marked as such
+//   - slices and arrays are lists, []byte and byte arrays are bytes, and
+//     syrup.Set is a set of any values
+//   - maps are dictionaries of any size
+//   - pointers are described by the types they point to
+//   - integer types with symbols registered by syrup.RegisterEnum are unions
+//     of the symbols
+//   - interfaces with implementations registered by syrup.RegisterUnion are
+//     unions of them, named by their labels, or by the symbols of those
+//     standing for a single value
+//   - other interfaces, syrup.Value, syrup.Record, and types other than
+//     structs implementing syrup.Marshaler may hold any value
+//
+// Structs implementing syrup.Marshaler, such as those generated by
+// syrup-marshalgen, are described by their fields like any other struct, and
+// so must encode their fields as the Encoder would.
+//
+// The schema describes values encoded with the NilIsError policy: nil values
+// encoded under other policies may not match it. Types registered as
+// extensions of an Encoding are described by their Go types. Types that
+// cannot be encoded result in an error, as do two named types of different
+// packages sharing a name.
+func Reflect(values ...interface{}) (*Schema, error) {
+	r := &reflector{
+		s:     &Schema{},
+		types: make(map[string]reflect.Type),
+	}
+	for _, v := range values {
+		t := reflect.TypeOf(v)
+		if t == nil || t.Name() == "" {
+			return nil, fmt.Errorf("syrup schema: cannot name a definition for unnamed type %v", t)
+		}
+		if _, err := r.define(t); err != nil {
+			return nil, err
+		}
+	}
+	return r.s, nil
+}
+
+type reflector struct {
+	s *Schema
+	// types holds the type given each definition.
+	types map[string]reflect.Type
+}
+
+// define adds a definition for the named type t, unless it already has one,
+// and returns a reference to it.
+func (r *reflector) define(t reflect.Type) (Pattern, error) {
+	name := t.Name()
+	if other, ok := r.types[name]; ok {
+		if other != t {
+			return nil, fmt.Errorf("syrup schema: types %v and %v are both named %s", other, t, name)
+		}
+		return Ref{Name: name}, nil
+	}
+	r.types[name] = t
+	i := len(r.s.Definitions)
+	r.s.Definitions = append(r.s.Definitions, Definition{Name: name})
+	p, err := r.describe(t)
+	if err != nil {
+		return nil, err
+	}
+	r.s.Definitions[i].Pattern = p
+	return Ref{Name: name}, nil
+}
+
+// pattern describes a type used by another, referring to the definitions of
+// named struct types.
+func (r *reflector) pattern(t reflect.Type) (Pattern, error) {
+	if t.Kind() == reflect.Struct && t.Name() != "" && isPlainStruct(t) || isUnion(t) || isEnum(t) {
+		return r.define(t)
+	}
+	return r.describe(t)
+}
+
+// isEnum reports whether t is a named type with symbols registered by
+// syrup.RegisterEnum, which is described by a definition as a union of them.
+func isEnum(t reflect.Type) bool {
+	return t.Name() != "" && len(syrup.EnumSymbols(t)) > 0
+}
+
+// isUnion reports whether t is a named interface type with implementations
+// registered by syrup.RegisterUnion, which is described by a definition as
+// unions may only be.
+func isUnion(t reflect.Type) bool {
+	return t.Kind() == reflect.Interface && t.Name() != "" && len(syrup.UnionTypes(t)) > 0
+}
+
+// isPlainStruct reports whether the struct type t is described by its fields.
+func isPlainStruct(t reflect.Type) bool {
+	return t != typeOfValue && t != typeOfRecord && t != typeOfBigInt
+}
+
+// isMarshaler reports whether t, or the type it points to, implements
+// syrup.Marshaler other than as a struct, leaving its encoding unknown.
+func isMarshaler(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() != reflect.Struct && (t.Implements(typeOfMarshaler) || reflect.PtrTo(t).Implements(typeOfMarshaler))
+}
+
+// describe returns the pattern of values of the type t.
+func (r *reflector) describe(t reflect.Type) (Pattern, error) {
+	if t == typeOfValue || t == typeOfRecord || isMarshaler(t) {
+		return Any{}, nil
+	} else if isEnum(t) {
+		var u Union
+		for _, s := range syrup.EnumSymbols(t) {
+			u.Alternatives = append(u.Alternatives, Alternative{Name: string(s), Pattern: Literal{Value: syrup.NewSymbol(s)}})
+		}
+		return u, nil
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		if isUnion(t) {
+			return r.unionOf(t)
+		}
+		return Any{}, nil
+	case reflect.Bool:
+		return Atom{Kind: syrup.BoolKind}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Atom{Kind: syrup.IntKind}, nil
+	case reflect.Float32:
+		return Atom{Kind: syrup.Float32Kind}, nil
+	case reflect.Float64:
+		return Atom{Kind: syrup.Float64Kind}, nil
+	case reflect.String:
+		if t == typeOfSymbol {
+			return Atom{Kind: syrup.SymbolKind}, nil
+		}
+		return Atom{Kind: syrup.StringKind}, nil
+	case reflect.Ptr:
+		return r.pattern(t.Elem())
+	case reflect.Slice:
+		if t == typeOfByteSlice {
+			return Atom{Kind: syrup.BytesKind}, nil
+		} else if t == typeOfSet {
+			return SetOf{Elem: Any{}}, nil
+		}
+		return r.listOf(t.Elem())
+	case reflect.Array:
+		if t.Elem() == typeOfByte {
+			return Atom{Kind: syrup.BytesKind}, nil
+		}
+		return r.listOf(t.Elem())
+	case reflect.Map:
+		key, err := r.pattern(t.Key())
+		if err != nil {
+			return nil, err
+		}
+		value, err := r.pattern(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return DictOf{Key: key, Value: value}, nil
+	case reflect.Struct:
+		if t == typeOfBigInt {
+			return Atom{Kind: syrup.IntKind}, nil
+		}
+		return r.structOf(t)
+	}
+	return nil, fmt.Errorf("syrup schema: cannot describe type %v", t)
+}
+
+func (r *reflector) listOf(elem reflect.Type) (Pattern, error) {
+	p, err := r.pattern(elem)
+	if err != nil {
+		return nil, err
+	}
+	return ListOf{Elem: p}, nil
+}
+
+// structOf describes a struct type as a record when it implements
+// syrup.Labeler, and otherwise as a dictionary.
+func (r *reflector) structOf(t reflect.Type) (Pattern, error) {
+	fields := syrup.StructFields(t)
+	if reflect.PtrTo(t).Implements(typeOfLabeler) {
+		label := reflect.New(t).Interface().(syrup.Labeler).SyrupLabel()
+		rec := Record{Label: syrup.NewSymbol(label), Fields: make([]Field, len(fields))}
+		for i, f := range fields {
+			p, err := r.pattern(f.Type)
+			if err != nil {
+				return nil, err
+			}
+			rec.Fields[i] = Field{Name: f.Name, Pattern: p}
+		}
+		return rec, nil
+	}
+	d := Dict{Entries: make([]Entry, len(fields))}
+	for i, f := range fields {
+		p, err := r.pattern(f.Type)
+		if err != nil {
+			return nil, err
+		}
+		key := syrup.NewString(f.Name)
+		if f.Symbol {
+			key = syrup.NewSymbol(syrup.Symbol(f.Name))
+		}
+		d.Entries[i] = Entry{Key: key, Pattern: p, Optional: f.Optional}
+	}
+	return d, nil
+}
+
+// unionOf describes an interface type as a union of its registered
+// implementations, each named by its label. Implementations standing for a
+// single value are literals, named by their symbol or else by their type.
+func (r *reflector) unionOf(t reflect.Type) (Pattern, error) {
+	var u Union
+	literals := syrup.UnionLiterals(t)
+	for _, it := range syrup.UnionTypes(t) {
+		if !it.Implements(typeOfLabeler) {
+			for _, lit := range literals {
+				if reflect.TypeOf(lit) != it {
+					continue
+				}
+				x, err := syrup.ValueOf(lit)
+				if err != nil {
+					return nil, err
+				}
+				name := it.Name()
+				if x.Kind() == syrup.SymbolKind {
+					name = string(x.Symbol())
+				}
+				u.Alternatives = append(u.Alternatives, Alternative{Name: name, Pattern: Literal{Value: x}})
+			}
+			continue
+		}
+		p, err := r.pattern(it)
+		if err != nil {
+			return nil, err
+		}
+		impl := reflect.New(it).Elem()
+		if it.Kind() == reflect.Ptr {
+			impl = reflect.New(it.Elem())
+		}
+		label := impl.Interface().(syrup.Labeler).SyrupLabel()
+		u.Alternatives = append(u.Alternatives, Alternative{Name: string(label), Pattern: p})
+	}
+	return u, nil
+}
@@ -0,0 +1,190 @@
+package schema
+
+import (
+	"bytes"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/cjslep/syrup"
+)
+
+type reflectPerson struct {
+	Name syrup.Symbol `syrup:"name"`
+	Age  uint8        `syrup:"age"`
+	skip int
+}
+
+func (reflectPerson) SyrupLabel() syrup.Symbol { return "person" }
+
+type reflectByte byte
+
+type reflectConfig struct {
+	Host    string                   `syrup:"host,symbol"`
+	Port    int                      `syrup:"port,optional"`
+	Owner   *reflectPerson           `syrup:"owner"`
+	Admins  []reflectPerson          `syrup:"admins,optional"`
+	Weights map[syrup.Symbol]float32 `syrup:"weights"`
+	Key     [4]byte                  `syrup:"key"`
+	Mask    [2]reflectByte           `syrup:"mask"`
+	Data    []byte                   `syrup:"data"`
+	Tags    syrup.Set                `syrup:"tags"`
+	Size    *big.Int                 `syrup:"size"`
+	Extra   interface{}              `syrup:"extra"`
+	Raw     syrup.Value              `syrup:"raw"`
+	Ignored bool                     `syrup:"-"`
+	Child   struct{ Ratio float64 }
+	Tree    reflectTree `syrup:"tree"`
+}
+
+type reflectTree struct {
+	Children []reflectTree
+}
+
+func TestReflect(t *testing.T) {
+	s, err := Reflect(reflectConfig{}, reflectPerson{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `reflectConfig = {host: string "port"?: int "owner": reflectPerson "admins"?: [reflectPerson ...] "weights": {symbol: float ...:...} "key": bytes "mask": [int ...] "data": bytes "tags": #{any} "size": int "extra": any "raw": any "Child": {"Ratio": double} "tree": reflectTree} .
+reflectPerson = <person @name symbol @age int> .
+reflectTree = {"Children": [reflectTree ...]} .
+`
+	if got := s.String(); got != expect {
+		t.Errorf("got\n%s\nwant\n%s", got, expect)
+	}
+	if _, err := Parse(expect); err != nil {
+		t.Errorf("Parse: %v", err)
+	}
+
+	v := reflectConfig{
+		Host:    "example.com",
+		Owner:   &reflectPerson{Name: "carol", Age: 30},
+		Weights: map[syrup.Symbol]float32{"a": 1},
+		Data:    []byte{1},
+		Tags:    syrup.Set{"x"},
+		Size:    big.NewInt(7),
+		Extra:   []interface{}{1, "two"},
+		Raw:     syrup.NewBool(true),
+		Tree:    reflectTree{Children: []reflectTree{{Children: []reflectTree{}}}},
+	}
+	var buf bytes.Buffer
+	if err := syrup.NewEncoder(syrup.NewPrototypeEncoding(), &buf).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ValidateStream("reflectConfig", syrup.NewDecoder(syrup.NewPrototypeEncoding(), &buf)); err != nil {
+		t.Errorf("ValidateStream: %v", err)
+	}
+}
+
+type reflectShape interface {
+	area() float64
+}
+
+type reflectCircle struct {
+	R float64
+}
+
+func (reflectCircle) SyrupLabel() syrup.Symbol { return "circle" }
+func (c reflectCircle) area() float64          { return 3 * c.R * c.R }
+
+type reflectSquare struct {
+	Side float64
+}
+
+func (reflectSquare) SyrupLabel() syrup.Symbol { return "square" }
+func (s *reflectSquare) area() float64         { return s.Side * s.Side }
+
+type reflectNone struct{}
+
+func (reflectNone) MarshalSyrup(e *syrup.Encoder) error { return e.Encode(syrup.Symbol("none")) }
+func (reflectNone) area() float64                       { return 0 }
+
+type reflectColor int
+
+var registerColor sync.Once
+
+type reflectDrawing struct {
+	Shapes []reflectShape `syrup:"shapes"`
+	Color  reflectColor   `syrup:"color"`
+}
+
+func TestReflectUnionAndEnum(t *testing.T) {
+	syrup.RegisterUnion((*reflectShape)(nil), reflectCircle{}, &reflectSquare{}, reflectNone{})
+	registerColor.Do(func() {
+		syrup.RegisterEnum(map[reflectColor]syrup.Symbol{0: "red", 1: "blue"})
+	})
+	s, err := Reflect(reflectDrawing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `reflectDrawing = {"shapes": [reflectShape ...] "color": reflectColor} .
+reflectShape = @circle reflectCircle / @square reflectSquare / =none .
+reflectCircle = <circle @R double> .
+reflectSquare = <square @Side double> .
+reflectColor = =red / =blue .
+`
+	if got := s.String(); got != expect {
+		t.Errorf("got\n%s\nwant\n%s", got, expect)
+	}
+	v := reflectDrawing{Shapes: []reflectShape{reflectCircle{R: 1}, &reflectSquare{Side: 2}, reflectNone{}}, Color: 1}
+	if err := s.Validate("reflectDrawing", v); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+// reflectGenerated encodes its fields as the Encoder would, as the types
+// generated by syrup-marshalgen do.
+type reflectGenerated struct {
+	Name  string    `syrup:"name"`
+	Upper reflectUp `syrup:"upper"`
+}
+
+func (g reflectGenerated) MarshalSyrup(e *syrup.Encoder) error {
+	type plain reflectGenerated
+	return e.Encode(plain(g))
+}
+
+// reflectUp encodes as a symbol rather than a string.
+type reflectUp string
+
+func (u reflectUp) MarshalSyrup(e *syrup.Encoder) error { return e.Encode(syrup.Symbol(u)) }
+
+func TestReflectMarshaler(t *testing.T) {
+	s, err := Reflect(reflectGenerated{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `reflectGenerated = {"name": string "upper": any} .
+`
+	if got := s.String(); got != expect {
+		t.Errorf("got\n%s\nwant\n%s", got, expect)
+	}
+	if err := s.Validate("reflectGenerated", reflectGenerated{Name: "a", Upper: "B"}); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestReflectErrors(t *testing.T) {
+	type reflectTree struct{}
+	type unsupported struct {
+		C chan int
+	}
+	tests := []struct {
+		name   string
+		values []interface{}
+		want   string
+	}{
+		{"unnamed", []interface{}{struct{}{}}, "syrup schema: cannot name a definition for unnamed type struct {}"},
+		{"nil", []interface{}{nil}, "syrup schema: cannot name a definition for unnamed type <nil>"},
+		{"unsupported", []interface{}{unsupported{}}, "syrup schema: cannot describe type chan int"},
+		{"same name", []interface{}{reflectConfig{}, reflectTree{}}, "syrup schema: types schema.reflectTree and schema.reflectTree are both named reflectTree"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Reflect(test.values...); err == nil || err.Error() != test.want {
+				t.Errorf("got %v, want %q", err, test.want)
+			}
+		})
+	}
+}
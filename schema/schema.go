@@ -0,0 +1,557 @@
+// Package schema describes the expected shapes of Syrup values and validates
+// values against them.
+//
+// A schema is written in a subset of the Preserves Schema syntax, as a series
+// of definitions each ending with a '.':
+//
+//	version 1 .
+//
+//	; A comment runs to the end of the line.
+//	Person = <person @name string @age int> .
+//	People = [Person ...] .
+//	Tags = #{symbol} .
+//	Point = [@x double @y double] .
+//	Config = {host: string "port"?: int} .
+//	Counts = {string: int ...:...} .
+//	Status = =pending / =fulfilled / =broken .
+//	Shape = @circle <circle double> / @rect <rect double double> .
+//
+// The patterns are:
+//
+//	any                any value
+//	bool float double  a value of that kind, where float is 32 bits and
+//	int string bytes   double is 64 bits
+//	symbol
+//	Name               a value matching the definition Name
+//	=sym  =|sym|       exactly that symbol
+//	"s"  12  #t  #f    exactly that string, integer, or boolean
+//	<label f1 f2>      a record with that literal label and exactly one value
+//	                   matching each field
+//	[f1 f2]            a list with exactly one element matching each field
+//	[p ...]            a list of any length, each element matching p
+//	#{p}               a set, each element matching p
+//	{k: p k2?: p2}     a dictionary with an entry for the literal key k
+//	                   matching p, and optionally one for k2 matching p2,
+//	                   where a bare key is a symbol; other entries are
+//	                   allowed
+//	{k: v ...:...}     a dictionary of any size, each key matching k and
+//	                   value matching v
+//	p1 / p2            a value matching either, only at the top level of a
+//	                   definition
+//
+// A field is a pattern optionally preceded by @name, naming it for generated
+// code. Union alternatives may be named the same way, and otherwise take the
+// name of their record label, literal symbol, or definition.
+//
+// Symbols may contain ':', so a colon ending a bare dictionary key must be
+// followed by whitespace.
+package schema
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cjslep/syrup"
+)
+
+// Schema is an ordered series of named definitions.
+type Schema struct {
+	Definitions []Definition
+}
+
+// Definition names a pattern.
+type Definition struct {
+	Name    string
+	Pattern Pattern
+}
+
+// Lookup returns the pattern of the definition with the name.
+func (s *Schema) Lookup(name string) (Pattern, bool) {
+	for _, d := range s.Definitions {
+		if d.Name == name {
+			return d.Pattern, true
+		}
+	}
+	return nil, false
+}
+
+// String returns the schema in the syntax Parse accepts.
+func (s *Schema) String() string {
+	var sb strings.Builder
+	for _, d := range s.Definitions {
+		fmt.Fprintf(&sb, "%s = %s .\n", symbolText(d.Name), d.Pattern)
+	}
+	return sb.String()
+}
+
+// Validate checks that v, which may be any value syrup.ValueOf accepts,
+// matches the definition with the name. A value that does not match results in
+// a *ValidationError.
+func (s *Schema) Validate(name string, v interface{}) error {
+	p, ok := s.Lookup(name)
+	if !ok {
+		return fmt.Errorf("syrup schema: no definition named %s", name)
+	}
+	val, err := syrup.ValueOf(v)
+	if err != nil {
+		return err
+	}
+	return p.match(s, val, syrup.Pointer{})
+}
+
+// ValidateStream checks that every value decoded by d matches the definition
+// with the name, until the stream is exhausted.
+func (s *Schema) ValidateStream(name string, d *syrup.Decoder) error {
+	p, ok := s.Lookup(name)
+	if !ok {
+		return fmt.Errorf("syrup schema: no definition named %s", name)
+	}
+	for n := 0; ; n++ {
+		var v syrup.Value
+		if err := d.Decode(&v); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("value %d: %w", n, err)
+		}
+		if err := p.match(s, v, syrup.Pointer{}); err != nil {
+			return fmt.Errorf("value %d: %w", n, err)
+		}
+	}
+}
+
+// ValidationError describes a value that does not match a schema.
+type ValidationError struct {
+	// Path addresses the mismatched value within the validated value.
+	Path syrup.Pointer
+	Msg  string
+	// shallow is set when the value at Path is not of the shape of the
+	// pattern at all, rather than mismatched within.
+	shallow bool
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Path) == 0 {
+		return "syrup schema: " + e.Msg
+	}
+	return fmt.Sprintf("syrup schema: at %s: %s", e.Path, e.Msg)
+}
+
+func mismatch(path syrup.Pointer, format string, args ...interface{}) error {
+	return &ValidationError{Path: path, Msg: fmt.Sprintf(format, args...)}
+}
+
+func shallowMismatch(path syrup.Pointer, format string, args ...interface{}) error {
+	return &ValidationError{Path: path, Msg: fmt.Sprintf(format, args...), shallow: true}
+}
+
+// step returns path followed by one more step.
+func step(path syrup.Pointer, s interface{}) syrup.Pointer {
+	return append(path[:len(path):len(path)], s)
+}
+
+// keyStep returns the Pointer step naming a dictionary key.
+func keyStep(key syrup.Value) interface{} {
+	switch key.Kind() {
+	case syrup.StringKind:
+		return key.String()
+	case syrup.SymbolKind:
+		return key.Symbol()
+	case syrup.IntKind:
+		if i, ok := key.Int64(); ok && int64(int(i)) == i {
+			return int(i)
+		}
+	}
+	return key
+}
+
+// Pattern is a shape that values may match.
+type Pattern interface {
+	// String returns the pattern in schema syntax.
+	String() string
+	match(s *Schema, v syrup.Value, path syrup.Pointer) error
+}
+
+// Any matches any value.
+type Any struct{}
+
+func (Any) String() string {
+	return "any"
+}
+
+func (Any) match(*Schema, syrup.Value, syrup.Pointer) error {
+	return nil
+}
+
+// Atom matches any value of an atomic Kind.
+type Atom struct {
+	Kind syrup.Kind
+}
+
+var atomNames = map[syrup.Kind]string{
+	syrup.BoolKind:    "bool",
+	syrup.Float32Kind: "float",
+	syrup.Float64Kind: "double",
+	syrup.IntKind:     "int",
+	syrup.StringKind:  "string",
+	syrup.BytesKind:   "bytes",
+	syrup.SymbolKind:  "symbol",
+}
+
+func (a Atom) String() string {
+	if name, ok := atomNames[a.Kind]; ok {
+		return name
+	}
+	return a.Kind.String()
+}
+
+func (a Atom) match(_ *Schema, v syrup.Value, path syrup.Pointer) error {
+	if v.Kind() != a.Kind {
+		return shallowMismatch(path, "expected %s, got %s", a, v.Kind())
+	}
+	return nil
+}
+
+// Literal matches values equal to its Value.
+type Literal struct {
+	Value syrup.Value
+}
+
+func (l Literal) String() string {
+	if l.Value.Kind() == syrup.SymbolKind {
+		return "=" + symbolText(string(l.Value.Symbol()))
+	}
+	return fmt.Sprint(l.Value)
+}
+
+func (l Literal) match(_ *Schema, v syrup.Value, path syrup.Pointer) error {
+	if !v.Equal(l.Value) {
+		return shallowMismatch(path, "expected %v, got %v", l.Value, v)
+	}
+	return nil
+}
+
+// Ref matches values matching the definition with its Name.
+type Ref struct {
+	Name string
+}
+
+func (r Ref) String() string {
+	return symbolText(r.Name)
+}
+
+func (r Ref) match(s *Schema, v syrup.Value, path syrup.Pointer) error {
+	p, ok := s.Lookup(r.Name)
+	if !ok {
+		return fmt.Errorf("syrup schema: no definition named %s", r.Name)
+	}
+	return p.match(s, v, path)
+}
+
+// Field is an optionally named pattern for one value of a record or list.
+type Field struct {
+	Name    string
+	Pattern Pattern
+}
+
+func (f Field) String() string {
+	if f.Name == "" {
+		return f.Pattern.String()
+	}
+	return "@" + symbolText(f.Name) + " " + f.Pattern.String()
+}
+
+func fieldsText(fields []Field) string {
+	s := make([]string, len(fields))
+	for i, f := range fields {
+		s[i] = f.String()
+	}
+	return strings.Join(s, " ")
+}
+
+func matchFields(s *Schema, fields []Field, vs []syrup.Value, path syrup.Pointer) error {
+	if len(vs) != len(fields) {
+		return mismatch(path, "expected %d values, got %d", len(fields), len(vs))
+	}
+	for i, f := range fields {
+		if err := f.Pattern.match(s, vs[i], step(path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record matches records with its Label and a value matching each field.
+type Record struct {
+	Label  syrup.Value
+	Fields []Field
+}
+
+func (r Record) String() string {
+	label := fmt.Sprint(r.Label)
+	if r.Label.Kind() == syrup.SymbolKind {
+		label = symbolText(string(r.Label.Symbol()))
+	}
+	if len(r.Fields) == 0 {
+		return "<" + label + ">"
+	}
+	return "<" + label + " " + fieldsText(r.Fields) + ">"
+}
+
+func (r Record) match(s *Schema, v syrup.Value, path syrup.Pointer) error {
+	if v.Kind() != syrup.RecordKind {
+		return shallowMismatch(path, "expected record, got %s", v.Kind())
+	} else if !v.Label().Equal(r.Label) {
+		return shallowMismatch(path, "expected record labeled %v, got %v", r.Label, v.Label())
+	}
+	return matchFields(s, r.Fields, v.Elems(), path)
+}
+
+// Tuple matches lists with an element matching each field.
+type Tuple struct {
+	Fields []Field
+}
+
+func (t Tuple) String() string {
+	return "[" + fieldsText(t.Fields) + "]"
+}
+
+func (t Tuple) match(s *Schema, v syrup.Value, path syrup.Pointer) error {
+	if v.Kind() != syrup.ListKind {
+		return shallowMismatch(path, "expected list, got %s", v.Kind())
+	}
+	return matchFields(s, t.Fields, v.Elems(), path)
+}
+
+// ListOf matches lists of elements matching Elem.
+type ListOf struct {
+	Elem Pattern
+}
+
+func (l ListOf) String() string {
+	return "[" + l.Elem.String() + " ...]"
+}
+
+func (l ListOf) match(s *Schema, v syrup.Value, path syrup.Pointer) error {
+	if v.Kind() != syrup.ListKind {
+		return shallowMismatch(path, "expected list, got %s", v.Kind())
+	}
+	return matchElems(s, l.Elem, v.Elems(), path)
+}
+
+func matchElems(s *Schema, p Pattern, vs []syrup.Value, path syrup.Pointer) error {
+	for i, e := range vs {
+		if err := p.match(s, e, step(path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetOf matches sets of elements matching Elem.
+type SetOf struct {
+	Elem Pattern
+}
+
+func (l SetOf) String() string {
+	return "#{" + l.Elem.String() + "}"
+}
+
+func (l SetOf) match(s *Schema, v syrup.Value, path syrup.Pointer) error {
+	if v.Kind() != syrup.SetKind {
+		return shallowMismatch(path, "expected set, got %s", v.Kind())
+	}
+	return matchElems(s, l.Elem, v.Elems(), path)
+}
+
+// DictOf matches dictionaries with keys matching Key and values matching
+// Value.
+type DictOf struct {
+	Key   Pattern
+	Value Pattern
+}
+
+func (d DictOf) String() string {
+	return "{" + d.Key.String() + ": " + d.Value.String() + " ...:...}"
+}
+
+func (d DictOf) match(s *Schema, v syrup.Value, path syrup.Pointer) error {
+	if v.Kind() != syrup.DictKind {
+		return shallowMismatch(path, "expected dict, got %s", v.Kind())
+	}
+	for _, e := range v.Entries() {
+		p := step(path, keyStep(e.Key))
+		if err := d.Key.match(s, e.Key, p); err != nil {
+			if verr, ok := err.(*ValidationError); ok {
+				return mismatch(p, "key %s", verr.Msg)
+			}
+			return err
+		}
+		if err := d.Value.match(s, e.Value, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Entry is a dictionary entry expected by a Dict.
+type Entry struct {
+	Key      syrup.Value
+	Pattern  Pattern
+	Optional bool
+}
+
+func (e Entry) String() string {
+	key := fmt.Sprint(e.Key)
+	if e.Key.Kind() == syrup.SymbolKind {
+		key = symbolText(string(e.Key.Symbol()))
+	}
+	if e.Optional {
+		key += "?"
+	}
+	return key + ": " + e.Pattern.String()
+}
+
+// Dict matches dictionaries with its required entries, and any of its optional
+// entries, each matching the entry's pattern. Dictionaries may have other
+// entries.
+type Dict struct {
+	Entries []Entry
+}
+
+func (d Dict) String() string {
+	s := make([]string, len(d.Entries))
+	for i, e := range d.Entries {
+		s[i] = e.String()
+	}
+	return "{" + strings.Join(s, " ") + "}"
+}
+
+func (d Dict) match(s *Schema, v syrup.Value, path syrup.Pointer) error {
+	if v.Kind() != syrup.DictKind {
+		return shallowMismatch(path, "expected dict, got %s", v.Kind())
+	}
+	for _, e := range d.Entries {
+		val, ok := v.Get(e.Key)
+		if !ok {
+			if e.Optional {
+				continue
+			}
+			return mismatch(path, "missing key %v", e.Key)
+		}
+		if err := e.Pattern.match(s, val, step(path, keyStep(e.Key))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Alternative is a named pattern of a Union.
+type Alternative struct {
+	Name    string
+	Pattern Pattern
+}
+
+// defaultName returns the name an Alternative takes when it is not named
+// explicitly.
+func defaultName(p Pattern) string {
+	switch p := p.(type) {
+	case Record:
+		if p.Label.Kind() == syrup.SymbolKind {
+			return string(p.Label.Symbol())
+		}
+	case Literal:
+		if p.Value.Kind() == syrup.SymbolKind {
+			return string(p.Value.Symbol())
+		}
+	case Ref:
+		return p.Name
+	}
+	return ""
+}
+
+// Union matches values matching any of its Alternatives.
+type Union struct {
+	Alternatives []Alternative
+}
+
+func (u Union) String() string {
+	s := make([]string, len(u.Alternatives))
+	for i, a := range u.Alternatives {
+		s[i] = a.Pattern.String()
+		if a.Name != defaultName(a.Pattern) {
+			s[i] = "@" + symbolText(a.Name) + " " + s[i]
+		}
+	}
+	return strings.Join(s, " / ")
+}
+
+// match reports the mismatch within the alternative the value most nearly
+// matched, or else that it matched none of them.
+func (u Union) match(s *Schema, v syrup.Value, path syrup.Pointer) error {
+	var nearest *ValidationError
+	names := make([]string, len(u.Alternatives))
+	for i, a := range u.Alternatives {
+		names[i] = a.Name
+		err := a.Pattern.match(s, v, path)
+		if err == nil {
+			return nil
+		}
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			return err
+		}
+		if shallow := verr.shallow && len(verr.Path) == len(path); !shallow && (nearest == nil || len(verr.Path) > len(nearest.Path)) {
+			nearest = verr
+		}
+	}
+	if nearest != nil {
+		return nearest
+	}
+	return shallowMismatch(path, "expected one of %s, got %v", strings.Join(names, ", "), v)
+}
+
+// symbolText returns the symbol as written in schema syntax, quoting it when
+// it would not be read back as a bare symbol.
+func symbolText(s string) string {
+	if isBareSymbol(s) {
+		return s
+	}
+	var sb strings.Builder
+	sb.WriteByte('|')
+	for _, r := range s {
+		if r == '|' || r == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	sb.WriteByte('|')
+	return sb.String()
+}
+
+func isBareSymbol(s string) bool {
+	if s == "" || isDigit(s[0]) || s[0] == '-' && len(s) > 1 && isDigit(s[1]) || s[len(s)-1] == ':' {
+		return false
+	}
+	for _, r := range s {
+		if !isSymbolRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSymbolRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	case r >= utf8.RuneSelf:
+		return r != utf8.RuneError
+	}
+	return strings.ContainsRune("_-+*!$%&~^:", r)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,184 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cjslep/syrup"
+)
+
+var testSchema = MustParse(`
+version 1 .
+
+; People and their belongings.
+Person = <person @name string @age int> .
+People = [Person ...] .
+Tags = #{symbol} .
+Point = [@x double @y double] .
+Config = {host: string "port"?: int} .
+Counts = {string: int ...:...} .
+Status = =pending / =fulfilled / =broken .
+Shape = @circle <circle double> / @rect <rect double double> .
+Message = <op:deliver @to Person @body any> / <op:abort @reason string> / Status .
+Flag = #t .
+`)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		def  string
+		text string
+		// path and msg describe the expected mismatch, if any.
+		path string
+		msg  string
+	}{
+		{"Person", `<person "carol" 30>`, "", ""},
+		{"Person", `<animal "carol" 30>`, "", "expected record labeled person, got animal"},
+		{"Person", `<person "carol">`, "", "expected 2 values, got 1"},
+		{"Person", `<person "carol" "30">`, "/1", "expected int, got string"},
+		{"Person", `["carol" 30]`, "", "expected record, got list"},
+		{"People", `[<person "a" 1> <person "b" 2>]`, "", ""},
+		{"People", `[]`, "", ""},
+		{"People", `[<person "a" 1> <person "b" 2.0>]`, "/1/1", "expected int, got float64"},
+		{"Tags", `#{a b}`, "", ""},
+		{"Tags", `#{a "b"}`, "/1", "expected symbol, got string"},
+		{"Tags", `[a]`, "", "expected set, got list"},
+		{"Point", `[1.0 2.0]`, "", ""},
+		{"Point", `[1.0 2.0 3.0]`, "", "expected 2 values, got 3"},
+		{"Config", `{host: "example.com"}`, "", ""},
+		{"Config", `{host: "example.com", "port": 80, extra: #t}`, "", ""},
+		{"Config", `{"port": 80}`, "", "missing key host"},
+		{"Config", `{host: "example.com", "port": "80"}`, `/"port"`, "expected int, got string"},
+		{"Counts", `{"a": 1, "b": 2}`, "", ""},
+		{"Counts", `{"a": 1, b: 2}`, "/b", "key expected string, got symbol"},
+		{"Counts", `{"a": 1, "b": #f}`, `/"b"`, "expected int, got bool"},
+		{"Status", `fulfilled`, "", ""},
+		{"Status", `lost`, "", "expected one of pending, fulfilled, broken, got lost"},
+		{"Shape", `<rect 1.0 2.0>`, "", ""},
+		{"Shape", `<rect 1.0>`, "", "expected 2 values, got 1"},
+		{"Message", `<|op:deliver| <person "a" 1> [1 2]>`, "", ""},
+		{"Message", `broken`, "", ""},
+		{"Message", `<|op:deliver| <person "a" "1"> #t>`, "/0/1", "expected int, got string"},
+		{"Message", `<|op:abort|>`, "", "expected 1 values, got 0"},
+		{"Message", `<|op:other|>`, "", "expected one of op:deliver, op:abort, Status, got <|op:other|>"},
+		{"Flag", `#t`, "", ""},
+		{"Flag", `#f`, "", "expected #t, got #f"},
+	}
+	for _, test := range tests {
+		t.Run(test.def+" "+test.text, func(t *testing.T) {
+			v, err := syrup.ParseText(test.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = testSchema.Validate(test.def, v)
+			if test.msg == "" {
+				if err != nil {
+					t.Errorf("got error %v", err)
+				}
+				return
+			}
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("got %v, want a *ValidationError", err)
+			}
+			if verr.Path.String() != test.path || verr.Msg != test.msg {
+				t.Errorf("got %s: %s, want %s: %s", verr.Path, verr.Msg, test.path, test.msg)
+			}
+		})
+	}
+}
+
+func TestValidateStream(t *testing.T) {
+	d := syrup.NewDecoder(syrup.NewPrototypeEncoding(), strings.NewReader(`7'pending9'fulfilled4'lost`))
+	err := testSchema.ValidateStream("Status", d)
+	if err == nil || !strings.HasPrefix(err.Error(), "value 2: ") {
+		t.Errorf("got %v, want a mismatch of value 2", err)
+	}
+	d = syrup.NewDecoder(syrup.NewPrototypeEncoding(), strings.NewReader(`<6'personi1e`))
+	if err := testSchema.ValidateStream("Status", d); err == nil {
+		t.Errorf("expected error for a truncated stream")
+	}
+	if err := testSchema.Validate("Missing", 1); err == nil {
+		t.Errorf("expected error for a missing definition")
+	}
+}
+
+func TestSchemaString(t *testing.T) {
+	expect := `Person = <person @name string @age int> .
+People = [Person ...] .
+Tags = #{symbol} .
+Point = [@x double @y double] .
+Config = {host: string "port"?: int} .
+Counts = {string: int ...:...} .
+Status = =pending / =fulfilled / =broken .
+Shape = <circle double> / <rect double double> .
+Message = <op:deliver @to Person @body any> / <op:abort @reason string> / Status .
+Flag = #t .
+`
+	if got := testSchema.String(); got != expect {
+		t.Errorf("got\n%s\nwant\n%s", got, expect)
+	}
+	reparsed, err := Parse(expect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reparsed.String() != expect {
+		t.Errorf("reparsed as\n%s", reparsed)
+	}
+	s := &Schema{Definitions: []Definition{
+		{"a.b", Union{[]Alternative{
+			{"x y", Literal{syrup.NewSymbol("|")}},
+			{"z", Record{Label: syrup.NewString("s"), Fields: []Field{{"", Ref{"a.b"}}}}},
+		}}},
+	}}
+	expect = `|a.b| = @|x y| =|\|| / @z <"s" |a.b|> .
+`
+	if got := s.String(); got != expect {
+		t.Errorf("got %s, want %s", got, expect)
+	}
+	reparsed, err = Parse(expect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reparsed.String() != expect {
+		t.Errorf("reparsed as %s", reparsed)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src    string
+		offset int
+	}{
+		{"A = int", 7},
+		{"A = Missing .", 4},
+		{"A = int . A = int .", 10},
+		{"int = bool .", 0},
+		{"A = <> .", 5},
+		{"A = <a int .", 11},
+		{"A = [int @x int ...] .", 16},
+		{"A = {a: int b: int ...:...} .", 19},
+		{"A = {a: int a: int} .", 12},
+		{"A = {a int} .", 7},
+		{"A = [int] / [int] .", 4},
+		{"A = =a / =a .", 9},
+		{`A = "open .`, 4},
+		{"A = ? .", 4},
+		{"= int .", 0},
+		{"A = B .\nB = A .", 0},
+		{"A = A / int .", 8},
+		{"A = A / @n int .", 0},
+		{"A = int .\nB = @l [int] / C .\nC = B .", 10},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			_, err := Parse(test.src)
+			serr, ok := err.(*SyntaxError)
+			if !ok {
+				t.Fatalf("got %v, want a *SyntaxError", err)
+			}
+			if serr.Offset != test.offset {
+				t.Errorf("got offset %d, want %d: %v", serr.Offset, test.offset, err)
+			}
+		})
+	}
+}
@@ -1,10 +1,14 @@
 package syrup
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
 	"reflect"
+	"sort"
+	"strconv"
 )
 
 const (
@@ -14,7 +18,7 @@ const (
 // NewEncoder creates a new syrup encoder using the specified encoding, and
 // writes encoded values to 'w'.
 func NewEncoder(enc *Encoding, w io.Writer) *Encoder {
-	return &Encoder{enc: enc, w: w}
+	return &Encoder{enc: enc, w: w, nilSentinel: DefaultNilSentinel()}
 }
 
 // NewDecoder creates a new syrup decoder using the specified encoding, decoding
@@ -25,166 +29,347 @@ func NewDecoder(enc *Encoding, r io.Reader) *Decoder {
 
 // Encoder uses a specific syrup encoding to write encoded values.
 type Encoder struct {
-	enc *Encoding
-	w   io.Writer
+	enc         *Encoding
+	w           io.Writer
+	path        []interface{}
+	nilPolicy   NilPolicy
+	nilSentinel interface{}
+	canonical   bool
+	frames      []*frame
+	// nested counts the Marshalers being run, within which calls to
+	// Encode continue the path of the enclosing value.
+	nested int
 }
 
 var typeOfByteSlice = reflect.TypeOf([]byte(nil))
 
+var typeOfByte = typeOfByteSlice.Elem()
+
 var typeOfBigInt = reflect.TypeOf(big.NewInt(0))
 
+var typeOfBigIntValue = typeOfBigInt.Elem()
+
 // Encode writes the encoded value to the Encoder's writer. Syrup encodes
-// privitive values into their Syrup counterparts. Slices are encoded as lists,
-// maps are encoded as dictionaries, and structs are encoded as dictionaries
-// using their public fields. Pointers are never encoded raw; they are
-// dereferenced before encoding.
+// privitive values into their Syrup counterparts. Slices and arrays are encoded
+// as lists, except for []byte and byte arrays which are encoded as
+// bytestrings. Maps are encoded as dictionaries, and structs are encoded as
+// dictionaries using their public fields. Pointers are never encoded raw; they
+// are dereferenced before encoding.
 //
 // For Symbols, Records, and Sets use the types provided by the syrup library as
-// hints.
+// hints. Struct fields are named by their `syrup` struct tag when present, and
+// structs implementing Labeler are encoded as records. Values implementing
+// Marshaler encode themselves.
+//
+// Values without a Syrup representation result in an *UnsupportedTypeError or
+// *UnsupportedValueError, which match ErrUnsupportedType and
+// ErrUnsupportedValue respectively when using errors.Is. Errors from the
+// underlying writer are returned unchanged.
 func (e *Encoder) Encode(v interface{}) error {
-	var b []byte
-	rv := reflect.ValueOf(v)
-	switch rv.Kind() {
-	case reflect.String:
-		if rv.Type() == typeOfSymbol {
-			b = e.enc.fmtSymbol(rv.String())
-		} else {
-			b = e.enc.fmtString(rv.String())
+	if e.nested == 0 {
+		e.path = e.path[:0]
+	}
+	depth := len(e.frames)
+	err := e.encode(reflect.ValueOf(v))
+	if err != nil {
+		// Abandon any compound values the failed value left open.
+		e.frames = e.frames[:depth]
+	}
+	return err
+}
+
+func (e *Encoder) encode(rv reflect.Value) error {
+	if !rv.IsValid() {
+		return e.encodeNil(rv)
+	}
+	return typeEncoder(rv.Type())(e, rv)
+}
+
+func (e *Encoder) encodeExtension(rv reflect.Value, x *Extension) error {
+	xb, err := x.Marshal(rv.Interface())
+	if err != nil {
+		return e.valueError(rv, err.Error())
+	}
+	return e.writeValue(e.enc.fmtExtension(x.Marker, xb))
+}
+
+func (e *Encoder) encodeElems(rv reflect.Value, elem encoderFunc) error {
+	for idx := 0; idx < rv.Len(); idx++ {
+		e.push(idx)
+		if err := elem(e, rv.Index(idx)); err != nil {
+			return err
 		}
-	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
-		b = e.enc.fmtInt(rv.Int())
-	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
-		b = e.enc.fmtUint(rv.Uint())
-	case reflect.Bool:
-		b = e.enc.fmtBool(rv.Bool())
-	case reflect.Float32:
-		b = e.enc.fmtFloat32(float32(rv.Float()))
-	case reflect.Float64:
-		b = e.enc.fmtFloat64(rv.Float())
-	case reflect.Slice:
-		if rv.IsNil() {
-			return fmt.Errorf("cannot encode nil pointer: %T", v)
+		e.pop()
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMap(rv reflect.Value, key, elem encoderFunc) error {
+	if err := e.open(openDictOp); err != nil {
+		return err
+	}
+	iter := rv.MapRange()
+	for iter.Next() {
+		if e.omitNil(iter.Value()) {
+			continue
 		}
-		if rv.Type() == typeOfByteSlice {
-			b = e.enc.fmtBytes(rv.Bytes())
-			break
-			// b is used, break out
-		} else if rv.Type() == typeOfSet {
-			if err := e.write(e.enc.setOpen()); err != nil {
-				return err
-			}
-			for idx := 0; idx < rv.Len(); idx++ {
-				val := rv.Index(idx).Interface()
-				if err := e.Encode(val); err != nil {
-					return err
-				}
-			}
-			return e.write(e.enc.setClose())
-			// b is unused, return before leaving statement
-		} else {
-			if err := e.write(e.enc.listOpen()); err != nil {
-				return err
-			}
-			for idx := 0; idx < rv.Len(); idx++ {
-				val := rv.Index(idx).Interface()
-				if err := e.Encode(val); err != nil {
-					return err
-				}
-			}
-			return e.write(e.enc.listClose())
-			// b is unused, return before leaving statement
+		k := iter.Key()
+		e.push(k.Interface())
+		if err := key(e, k); err != nil {
+			return err
 		}
-	case reflect.Ptr:
-		if rv.IsNil() {
-			return fmt.Errorf("cannot encode nil pointer: %T", v)
+		if err := elem(e, iter.Value()); err != nil {
+			return err
 		}
-		if rv.Type() == typeOfBigInt {
-			// Encode as big int
-			b = e.enc.fmtBigInt(rv.Interface().(*big.Int))
-		} else {
-			return e.Encode(rv.Elem().Interface())
+		e.pop()
+	}
+	return e.close(closeDictOp)
+}
+
+func (e *Encoder) encodeRecord(record Record) error {
+	if err := e.open(openRecordOp); err != nil {
+		return err
+	}
+	e.push(RecordLabel{})
+	if err := e.encode(reflect.ValueOf(record.Label)); err != nil {
+		return err
+	}
+	e.pop()
+	for i, val := range record.Values {
+		e.push(i)
+		if err := e.encode(reflect.ValueOf(val)); err != nil {
+			return err
 		}
-		// b is unused, return before leaving statement
-	case reflect.Map:
-		if rv.IsNil() {
-			return fmt.Errorf("cannot encode nil pointer: %T", v)
+		e.pop()
+	}
+	return e.close(closeRecordOp)
+}
+
+// encodeStruct encodes a struct as a dictionary of its fields.
+func (e *Encoder) encodeStruct(rv reflect.Value, fields []encoderField) error {
+	if err := e.open(openDictOp); err != nil {
+		return err
+	}
+	for _, f := range fields {
+		v := rv.Field(f.fieldIdx)
+		if e.omitNil(v) || f.optional && v.IsZero() {
+			continue
+		}
+		key := e.enc.fmtString(f.name)
+		if f.symbol {
+			key = e.enc.fmtSymbol(f.name)
 		}
-		if err := e.write(e.enc.dictOpen()); err != nil {
+		e.push(f.seg)
+		if err := e.writeValue(key); err != nil {
 			return err
 		}
-		iter := rv.MapRange()
-		for iter.Next() {
-			k := iter.Key()
-			if err := e.Encode(k.Interface()); err != nil {
-				return err
-			}
-			v := iter.Value()
-			if err := e.Encode(v.Interface()); err != nil {
-				return err
-			}
+		if err := f.enc(e, v); err != nil {
+			return err
 		}
-		return e.write(e.enc.dictClose())
-		// b is unused, return before leaving statement
-	case reflect.Struct:
-		if rv.Type() == typeOfRecord {
-			// Encode as record
-			record := rv.Interface().(Record)
-			if err := e.write(e.enc.recordOpen()); err != nil {
+		e.pop()
+	}
+	return e.close(closeDictOp)
+}
+
+// SetCanonical determines whether the Encoder writes the canonical form of
+// each value, where dictionary entries are sorted by their encoded keys and
+// set elements are sorted by their encoded bytes. Canonical encoding buffers
+// each dictionary and set in memory before writing it.
+func (e *Encoder) SetCanonical(canonical bool) {
+	e.canonical = canonical
+}
+
+// frame is an open compound value.
+type frame struct {
+	oper op
+	// buf collects the bytes of a dictionary or set when encoding
+	// canonically, so its items can be sorted. Other compound values share
+	// the buf of their parent, which is nil at the top level.
+	buf   *bytes.Buffer
+	items [][]byte
+	start int
+}
+
+func (e *Encoder) open(oper op) error {
+	var b []byte
+	switch oper {
+	case openListOp:
+		b = e.enc.listOpen()
+	case openDictOp:
+		b = e.enc.dictOpen()
+	case openSetOp:
+		b = e.enc.setOpen()
+	case openRecordOp:
+		b = e.enc.recordOpen()
+	}
+	if err := e.write(b); err != nil {
+		return err
+	}
+	f := &frame{oper: oper}
+	if e.canonical && (oper == openDictOp || oper == openSetOp) {
+		f.buf = &bytes.Buffer{}
+	} else if e.canonical && len(e.frames) > 0 {
+		f.buf = e.frames[len(e.frames)-1].buf
+	}
+	e.frames = append(e.frames, f)
+	return nil
+}
+
+func (e *Encoder) close(oper op) error {
+	var b []byte
+	switch oper {
+	case closeListOp:
+		b = e.enc.listClose()
+	case closeDictOp:
+		b = e.enc.dictClose()
+	case closeSetOp:
+		b = e.enc.setClose()
+	case closeRecordOp:
+		b = e.enc.recordClose()
+	}
+	f := e.frames[len(e.frames)-1]
+	e.frames = e.frames[:len(e.frames)-1]
+	if !e.canonical {
+		return e.write(b)
+	}
+	switch f.oper {
+	case openDictOp:
+		// Items alternate between keys and values.
+		pairs := make([][2][]byte, 0, len(f.items)/2)
+		for i := 0; i+1 < len(f.items); i += 2 {
+			pairs = append(pairs, [2][]byte{f.items[i], f.items[i+1]})
+		}
+		sort.SliceStable(pairs, func(i, j int) bool {
+			return bytes.Compare(pairs[i][0], pairs[j][0]) < 0
+		})
+		for _, p := range pairs {
+			if err := e.write(p[0]); err != nil {
 				return err
 			}
-			if err := e.Encode(record.Label); err != nil {
+			if err := e.write(p[1]); err != nil {
 				return err
 			}
-			for _, val := range record.Values {
-				if err := e.Encode(val); err != nil {
-					return err
-				}
-			}
-			return e.write(e.enc.recordClose())
-		} else {
-			// Encode as dictionary
-			if err := e.write(e.enc.dictOpen()); err != nil {
+		}
+	case openSetOp:
+		sort.SliceStable(f.items, func(i, j int) bool {
+			return bytes.Compare(f.items[i], f.items[j]) < 0
+		})
+		for _, item := range f.items {
+			if err := e.write(item); err != nil {
 				return err
 			}
-			n := rv.NumField()
-			rvt := rv.Type()
-			for i := 0; i < n; i++ {
-				k := rvt.Field(i)
-				if len(k.PkgPath) > 0 {
-					// Skip unexported fields
-					continue
-				}
-				name := k.Name
-				if tname, ok := k.Tag.Lookup(kSyrupStructTag); ok {
-					name = tname
-				}
-				if err := e.Encode(name); err != nil {
-					return err
-				}
-				v := rv.Field(i)
-				if err := e.Encode(v.Interface()); err != nil {
-					return err
-				}
-			}
-			return e.write(e.enc.dictClose())
 		}
-		// b is unused, return before leaving statement
-	default:
-		return fmt.Errorf("unknown type: %T", v)
 	}
-	return e.write(b)
+	return e.writeValue(b)
+}
+
+// writeValue writes the bytes that complete a value.
+func (e *Encoder) writeValue(b []byte) error {
+	if err := e.write(b); err != nil {
+		return err
+	}
+	if len(e.frames) > 0 {
+		// Cut the completed value into its own item, when it is an
+		// item of a dictionary or set.
+		if f := e.frames[len(e.frames)-1]; f.buf != nil && (f.oper == openDictOp || f.oper == openSetOp) {
+			item := make([]byte, f.buf.Len()-f.start)
+			copy(item, f.buf.Bytes()[f.start:])
+			f.items = append(f.items, item)
+			f.start = f.buf.Len()
+		}
+	}
+	return nil
 }
 
 func (e *Encoder) write(b []byte) error {
+	if len(e.frames) > 0 {
+		if buf := e.frames[len(e.frames)-1].buf; buf != nil {
+			// bytes.Buffer.Write always returns a nil error
+			_, _ = buf.Write(b)
+			return nil
+		}
+	}
 	n, err := e.w.Write(b)
 	if err != nil {
 		return err
 	} else if n != len(b) {
-		return fmt.Errorf("wrote %d of %d bytes", n, len(b))
+		return io.ErrShortWrite
 	}
 	return nil
 }
 
+// push and pop track the path from the top-level value to the value being
+// encoded, so that errors can report where encoding failed.
+func (e *Encoder) push(seg interface{}) {
+	e.path = append(e.path, seg)
+}
+
+func (e *Encoder) pop() {
+	e.path = e.path[:len(e.path)-1]
+}
+
+// pointer returns a copy of the path to the value being encoded.
+func (e *Encoder) pointer() Pointer {
+	return append(Pointer{}, e.path...)
+}
+
+func (e *Encoder) valueError(rv reflect.Value, str string) error {
+	return &UnsupportedValueError{Value: rv, Str: str, Path: e.pointer()}
+}
+
+var (
+	// ErrUnsupportedType matches any *UnsupportedTypeError using errors.Is.
+	ErrUnsupportedType = errors.New("syrup: unsupported type")
+	// ErrUnsupportedValue matches any *UnsupportedValueError using
+	// errors.Is.
+	ErrUnsupportedValue = errors.New("syrup: unsupported value")
+)
+
+// UnsupportedTypeError is returned by Encode when attempting to encode a Go
+// type that has no Syrup representation, such as a channel or function.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+	// Path locates the offending value within the top-level value, such as
+	// `/"Field"/2`. It is empty for the top-level value itself.
+	Path Pointer
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "syrup: unsupported type " + e.Type.String() + atPath(e.Path)
+}
+
+func (e *UnsupportedTypeError) Is(target error) bool {
+	return target == ErrUnsupportedType
+}
+
+// UnsupportedValueError is returned by Encode when attempting to encode a value
+// of a supported type that cannot be represented, such as a nil pointer.
+type UnsupportedValueError struct {
+	Value reflect.Value
+	Str   string
+	// Path locates the offending value within the top-level value, such as
+	// `/"Field"/2`. It is empty for the top-level value itself.
+	Path Pointer
+}
+
+func (e *UnsupportedValueError) Error() string {
+	if e.Value.IsValid() {
+		return "syrup: unsupported value: " + e.Str + " of type " + e.Value.Type().String() + atPath(e.Path)
+	}
+	return "syrup: unsupported value: " + e.Str + atPath(e.Path)
+}
+
+func (e *UnsupportedValueError) Is(target error) bool {
+	return target == ErrUnsupportedValue
+}
+
+func atPath(path Pointer) string {
+	if len(path) == 0 {
+		return ""
+	}
+	return " at " + path.String()
+}
+
 type InvalidTypeError struct {
 	Value  string
 	Type   reflect.Type
@@ -195,6 +380,19 @@ func (e *InvalidTypeError) Error() string {
 	return fmt.Sprintf("syrup: cannot decode %s into Go value of type %s at byte offset %d", e.Value, e.Type, e.Offset)
 }
 
+// OverflowError is returned when decoding an integer that does not fit into
+// the Go value's type.
+type OverflowError struct {
+	// Value is the integer in base 10.
+	Value  string
+	Type   reflect.Type
+	Offset uint64
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("syrup: integer %s overflows Go value of type %s at byte offset %d", e.Value, e.Type, e.Offset)
+}
+
 type InvalidDecodeError struct {
 	Type reflect.Type
 }
@@ -211,67 +409,121 @@ func (e *InvalidDecodeError) Error() string {
 }
 
 type Decoder struct {
-	r io.Reader
-	s *scanner
-	n uint64
+	r                io.Reader
+	s                *scanner
+	n                uint64
+	nilSentinel      interface{}
+	nilSentinelBytes []byte
+	// started is whether any value has begun since Decode was called.
+	started bool
+	// pending is an op already read, which begins the next value for an
+	// Unmarshaler to read.
+	pending op
+	buf     [1]byte
 }
 
+// Decode reads the next encoded value from the Decoder's reader and stores it
+// in the value pointed to by v. Values may be concatenated in the stream, so
+// Decode may be called repeatedly. It returns io.EOF once the stream ends
+// before any further value begins, and io.ErrUnexpectedEOF if the stream ends
+// partway through a value.
+//
+// Dictionaries are decoded into structs by matching string or symbol keys to
+// the names of fields, as given by their `syrup` struct tags when present.
+// Records are decoded into structs implementing Labeler, and values into
+// interfaces as the implementations registered with RegisterUnion match them.
+// Values implementing Unmarshaler decode themselves.
 func (d *Decoder) Decode(v interface{}) error {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		return &InvalidDecodeError{reflect.TypeOf(v)}
 	}
+	d.started = false
 	_, err := d.run(reflect.ValueOf(v))
-	if err == io.EOF {
-		err = nil
+	if err == io.EOF && (d.started || d.s.s != scanFindToken) {
+		err = io.ErrUnexpectedEOF
 	}
 	return err
 }
 
 func (d *Decoder) run(v reflect.Value) (last op, err error) {
-	nb := make([]byte, 1)
+	return d.runDecoder(v, nil)
+}
+
+// runKey decodes a record label or dictionary key into v using dec, as for
+// runDecoder. Labels and keys do not stand in for nil values, so the nil
+// sentinel is not matched within them.
+func (d *Decoder) runKey(v reflect.Value, dec decoderFunc) (last op, err error) {
+	sentinel := d.nilSentinel
+	d.nilSentinel = nil
+	defer func() { d.nilSentinel = sentinel }()
+	return d.runDecoder(v, dec)
+}
+
+// runDecoder decodes the next value into v using dec, the compiled decoder of
+// its type, or looking it up when dec is nil.
+func (d *Decoder) runDecoder(v reflect.Value, dec decoderFunc) (last op, err error) {
 	stop := false
 	for err == nil && !stop {
-		var n int
-		n, err = d.r.Read(nb)
-		if n != 1 && err == nil {
-			err = fmt.Errorf("syrup read %d bytes instead of 1 byte", n)
-		}
-		if n == 1 {
+		if d.pending != noop {
+			last, d.pending = d.pending, noop
+		} else {
+			var n int
+			n, err = d.r.Read(d.buf[:])
+			if n != 1 && err == nil {
+				err = fmt.Errorf("syrup read %d bytes instead of 1 byte", n)
+			}
+			if n != 1 {
+				continue
+			}
 			var err2 error
-			last, err2 = d.s.Process(nb[0])
+			last, err2 = d.s.Process(d.buf[0])
 			if err2 != nil {
 				return last, err2
 			}
-			var err3 error
-			stop, err3 = d.handleOp(v, last)
-			if err3 != nil {
-				return last, err3
-			}
+		}
+		if last != noop {
+			d.started = true
+		}
+		var err3 error
+		stop, err3 = d.handleOp(v, dec, last)
+		if err3 != nil {
+			return last, err3
 		}
 	}
 	return last, err
 }
 
-func (d *Decoder) handleOp(v reflect.Value, oper op) (stop bool, err error) {
+func (d *Decoder) handleOp(v reflect.Value, dec decoderFunc, oper op) (stop bool, err error) {
 	if !v.IsValid() {
 		// Silently skip some values, similar to encoding/json.
 		//
 		// When a fixed array runs out of space, we keep similar
 		// behavior to encoding/json and silently drop the tail end
-		// of things.
+		// of things. The value must still be consumed in its
+		// entirety, so it is decoded and then discarded.
+		var discard interface{}
+		v = reflect.ValueOf(&discard).Elem()
+		dec = nil
+	}
+	if oper == noop {
 		d.n++
 		return
+	} else if isCloseOp(oper) {
+		// Ends the compound value being decoded by the caller.
+		return true, nil
 	}
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
+	if dec == nil {
+		dec = typeDecoder(v.Type())
 	}
-	stop = true
+	return true, dec(d, v, v, oper)
+}
+
+// decodeOp decodes the value beginning with oper into v, which is reached
+// from target through pointers. Compiled decoders handle compound values of
+// structs, slices, arrays, and maps, leaving the rest to decodeOp.
+func (d *Decoder) decodeOp(target, v reflect.Value, oper op) (err error) {
 	switch oper {
-	case noop:
-		stop = false
-		d.n++
-		break
 	case valBoolop:
 		b := false
 		b, err = d.s.Bool()
@@ -294,7 +546,19 @@ func (d *Decoder) handleOp(v reflect.Value, oper op) (stop bool, err error) {
 		if err != nil {
 			return
 		}
-		err = d.storeSymbol(v, s)
+		if d.isNilSentinel(s) {
+			d.storeNil(target)
+		} else {
+			err = d.storeSymbol(v, s)
+		}
+		d.n++
+	case valExtensionOp:
+		var x interface{}
+		x, err = d.s.Extension()
+		if err != nil {
+			return
+		}
+		err = d.storeExtension(target, x)
 		d.n++
 	case valStringOp:
 		var s string
@@ -334,93 +598,19 @@ func (d *Decoder) handleOp(v reflect.Value, oper op) (stop bool, err error) {
 		err = d.storeFloat64(v, f)
 		d.n++
 	case openListOp:
-		err = d.recurCreatingSliceOrArray(v, oper, closeListOp, "list")
+		err = d.interfaceSlice(v, oper, closeListOp, "list")
 	case openDictOp:
-		pv := v
-		if v.Kind() == reflect.Ptr {
-			pv = v.Elem()
-		}
-		var m structMetadata
-		var mt reflect.Type
-		switch pv.Kind() {
-		case reflect.Interface:
-			// Non-reflective shortcut
-			err = d.interfaceDict(pv, oper)
-			return
-		case reflect.Map:
-			// Maps must have interface or string key
-			mt = pv.Type()
-			if mt.Key().Kind() != reflect.Interface &&
-				mt.Key().Kind() != reflect.String {
-				err = &InvalidTypeError{Value: "dict", Type: pv.Type(), Offset: d.n}
-				return
-			}
-			if pv.IsNil() {
-				pv.Set(reflect.MakeMap(mt))
-			}
-		case reflect.Struct:
-			m = buildCachedMetadata(pv.Type())
-			if v.Kind() == reflect.Ptr && v.IsNil() {
-				pv.Set(reflect.New(pv.Type()).Elem())
-			}
-		default:
-			err = &InvalidTypeError{Value: "dict", Type: pv.Type(), Offset: d.n}
-		}
-		d.n++
-		var last op
-		for last != closeDictOp {
-			if pv.Kind() == reflect.Map {
-				key := reflect.New(mt.Key()).Elem()
-				if last, err = d.run(key); err != nil {
-					return
-				}
-				if last != closeDictOp {
-					val := reflect.New(mt.Elem()).Elem()
-					if last, err = d.run(val); err != nil {
-						return
-					}
-					pv.SetMapIndex(key, val)
-				}
-			} else { // reflect.Struct
-				// Only strings supported as keys
-				var skey string
-				key := reflect.ValueOf(&skey)
-				if last, err = d.run(key); err != nil {
-					return
-				}
-				if last != closeDictOp {
-					var val reflect.Value
-					if idx, ok := m.fieldNamesIndex[skey]; ok {
-						val = pv.Field(m.fields[idx].fieldIdx)
-						if !val.CanSet() {
-							err = fmt.Errorf("syrup: cannot set field %s when processing dict at byte offset %d", skey, d.n)
-							return
-						}
-						if val.Kind() == reflect.Ptr && val.IsNil() {
-							val.Set(reflect.New(val.Type().Elem()))
-							val = val.Elem()
-						}
-					}
-					if last, err = d.run(val); err != nil {
-						return
-					}
-				}
-			}
+		// Non-reflective shortcut
+		if v.Kind() != reflect.Interface {
+			return &InvalidTypeError{Value: "dict", Type: v.Type(), Offset: d.n}
 		}
+		err = d.interfaceDict(v, oper)
 	case openSetOp:
-		err = d.recurCreatingSliceOrArray(v, oper, closeSetOp, "set")
+		err = d.interfaceSlice(v, oper, closeSetOp, "set")
 	case openRecordOp:
-		pv := v
-		if v.Kind() == reflect.Ptr {
-			pv = v.Elem()
-		}
-		if pv.Type() != typeOfRecord && pv.Kind() != reflect.Interface {
-			err = &InvalidTypeError{Value: "record", Type: pv.Type(), Offset: d.n}
-			return
-		}
 		var r Record
 		var last op
-		if last, err = d.run(reflect.ValueOf(&r.Label)); err != nil {
+		if last, err = d.runKey(reflect.ValueOf(&r.Label), nil); err != nil {
 			return
 		}
 		for last != closeRecordOp {
@@ -434,27 +624,103 @@ func (d *Decoder) handleOp(v reflect.Value, oper op) (stop bool, err error) {
 		if len(r.Values) > 0 {
 			r.Values = r.Values[:len(r.Values)-1]
 		}
-		pv.Set(reflect.ValueOf(r))
-	case closeListOp:
-		break
-	case closeDictOp:
-		break
-	case closeSetOp:
-		break
-	case closeRecordOp:
-		break
+		if d.isNilSentinel(r) {
+			d.storeNil(target)
+		} else if v.Type() != typeOfRecord && v.Kind() != reflect.Interface {
+			err = &InvalidTypeError{Value: "record", Type: v.Type(), Offset: d.n}
+		} else {
+			v.Set(reflect.ValueOf(r))
+		}
 	default:
 		err = fmt.Errorf("syrup unknown op: %v", oper)
 	}
 	return
 }
 
+func isCloseOp(oper op) bool {
+	return oper == closeListOp || oper == closeDictOp || oper == closeSetOp || oper == closeRecordOp
+}
+
+// indirect walks through pointers until reaching the value being pointed at,
+// allocating any nil pointers along the way. A settable *big.Int is left as-is
+// since it is decoded into directly.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr && !(v.Type() == typeOfBigInt && v.CanSet()) {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// decodeStruct decodes a dictionary into a struct, matching string or symbol
+// keys to the names of its fields. Entries with other keys are skipped.
+func (d *Decoder) decodeStruct(v reflect.Value, fields []decoderField, index map[string]int) (err error) {
+	d.n++
+	var last op
+	for last != closeDictOp {
+		var key interface{}
+		if last, err = d.runKey(reflect.ValueOf(&key), nil); err != nil {
+			return
+		}
+		if last == closeDictOp {
+			break
+		}
+		var name string
+		switch k := key.(type) {
+		case string:
+			name = k
+		case Symbol:
+			name = string(k)
+		}
+		var val reflect.Value
+		var dec decoderFunc
+		if idx, ok := index[name]; ok {
+			val = v.Field(fields[idx].fieldIdx)
+			if !val.CanSet() {
+				return fmt.Errorf("syrup: cannot set field %s when processing dict at byte offset %d", name, d.n)
+			}
+			dec = fields[idx].dec
+		}
+		if last, err = d.runDecoder(val, dec); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// decodeMap decodes a dictionary into a map, which must have interface or
+// string keys.
+func (d *Decoder) decodeMap(v reflect.Value, key, elem decoderFunc) (err error) {
+	mt := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(mt))
+	}
+	d.n++
+	var last op
+	for last != closeDictOp {
+		k := reflect.New(mt.Key()).Elem()
+		if last, err = d.runKey(k, key); err != nil {
+			return
+		}
+		if last != closeDictOp {
+			val := reflect.New(mt.Elem()).Elem()
+			if last, err = d.runDecoder(val, elem); err != nil {
+				return
+			}
+			v.SetMapIndex(k, val)
+		}
+	}
+	return
+}
+
 func (d *Decoder) interfaceDict(v reflect.Value, oper op) (err error) {
 	vals := make(map[interface{}]interface{}, 0)
 	var last op
 	for last != closeDictOp {
 		var k interface{}
-		if last, err = d.run(reflect.ValueOf(&k)); err != nil {
+		if last, err = d.runKey(reflect.ValueOf(&k), nil); err != nil {
 			return
 		}
 		if last != closeDictOp {
@@ -462,6 +728,12 @@ func (d *Decoder) interfaceDict(v reflect.Value, oper op) (err error) {
 			if last, err = d.run(reflect.ValueOf(&vi)); err != nil {
 				return
 			}
+			if k != nil && !reflect.TypeOf(k).Comparable() {
+				// Such keys cannot be held by a Go map, but can be
+				// held by a Value.
+				err = &InvalidTypeError{Value: fmt.Sprintf("dict key of type %T", k), Type: v.Type(), Offset: d.n}
+				return
+			}
 			vals[k] = vi
 		}
 	}
@@ -469,45 +741,32 @@ func (d *Decoder) interfaceDict(v reflect.Value, oper op) (err error) {
 	return
 }
 
-func (d *Decoder) recurCreatingSliceOrArray(v reflect.Value, oper op, stop op, errHint string) (err error) {
-	pv := v
-	if v.Kind() == reflect.Ptr {
-		pv = v.Elem()
-	}
-	switch pv.Kind() {
-	case reflect.Interface:
-		// Non-reflective shortcut
-		err = d.interfaceSlice(pv, oper)
-		return
-	case reflect.Array, reflect.Slice:
-		break
-	default:
-		err = &InvalidTypeError{Value: errHint, Type: pv.Type(), Offset: d.n}
-		return
-	}
+// decodeElems decodes a list or set into a slice or array, decoding its
+// elements with elem.
+func (d *Decoder) decodeElems(v reflect.Value, elem decoderFunc, stop op) (err error) {
 	d.n++
 	i := 0
 	var last op
 	for last != stop {
 		// When a slice, grow its length by 1 and capacity by a
 		// factor of half.
-		if pv.Kind() == reflect.Slice {
-			if i >= pv.Cap() {
-				capt := pv.Cap() + pv.Cap()/2
+		if v.Kind() == reflect.Slice {
+			if i >= v.Cap() {
+				capt := v.Cap() + v.Cap()/2
 				if capt < 4 {
 					capt = 4
 				}
-				next := reflect.MakeSlice(pv.Type(), pv.Len(), capt)
-				reflect.Copy(next, pv)
-				pv.Set(next)
+				next := reflect.MakeSlice(v.Type(), v.Len(), capt)
+				reflect.Copy(next, v)
+				v.Set(next)
 			}
-			if i >= pv.Len() {
-				pv.SetLen(i + 1)
+			if i >= v.Len() {
+				v.SetLen(i + 1)
 			}
 		}
 		// Recursively populate the list.
 		if i < v.Len() {
-			if last, err = d.run(pv.Index(i)); err != nil {
+			if last, err = d.runDecoder(v.Index(i), elem); err != nil {
 				return
 			}
 		} else {
@@ -522,26 +781,30 @@ func (d *Decoder) recurCreatingSliceOrArray(v reflect.Value, oper op, stop op, e
 	// returns clostListOp still had created a spot in the
 	// array/slice.
 	i--
-	if pv.Kind() == reflect.Array {
+	if v.Kind() == reflect.Array {
 		// Pad the rest of the array with zero values.
-		zero := reflect.Zero(pv.Type().Elem())
-		for ; i < pv.Len(); i++ {
-			pv.Index(i).Set(zero)
+		zero := reflect.Zero(v.Type().Elem())
+		for ; i < v.Len(); i++ {
+			v.Index(i).Set(zero)
 		}
 	} else if i == 0 {
 		// Zero slice
-		pv.Set(reflect.MakeSlice(pv.Type(), 0, 0))
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
 	} else {
 		// Shrinkwrap -- we had 1 more element than necessary.
-		pv.SetLen(i)
+		v.SetLen(i)
 	}
 	return
 }
 
-func (d *Decoder) interfaceSlice(v reflect.Value, oper op) (err error) {
+// interfaceSlice decodes a list or set into an empty interface.
+func (d *Decoder) interfaceSlice(v reflect.Value, oper op, stop op, errHint string) (err error) {
+	if v.Kind() != reflect.Interface {
+		return &InvalidTypeError{Value: errHint, Type: v.Type(), Offset: d.n}
+	}
 	vals := make([]interface{}, 0)
 	var last op
-	for last != closeListOp {
+	for last != stop {
 		var n interface{}
 		if last, err = d.run(reflect.ValueOf(&n)); err != nil {
 			return
@@ -549,7 +812,12 @@ func (d *Decoder) interfaceSlice(v reflect.Value, oper op) (err error) {
 		vals = append(vals, n)
 	}
 	// We have 1 extra element.
-	v.Set(reflect.ValueOf(vals[:len(vals)-1]))
+	vals = vals[:len(vals)-1]
+	if oper == openSetOp {
+		v.Set(reflect.ValueOf(Set(vals)))
+	} else {
+		v.Set(reflect.ValueOf(vals))
+	}
 	return
 }
 
@@ -581,6 +849,19 @@ func (d *Decoder) storeByteArr(v reflect.Value, b []byte) error {
 		} else {
 			v.SetBytes(b)
 		}
+	case reflect.Array:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			err = &InvalidTypeError{Value: "bytestring", Type: v.Type(), Offset: d.n}
+		} else if v.Len() != len(b) {
+			err = &InvalidTypeError{Value: fmt.Sprintf("bytestring of length %d", len(b)), Type: v.Type(), Offset: d.n}
+		} else if v.Type().Elem() == typeOfByte {
+			reflect.Copy(v, reflect.ValueOf(b))
+		} else {
+			// reflect.Copy requires the element types to be the same.
+			for i, c := range b {
+				v.Index(i).SetUint(uint64(c))
+			}
+		}
 	case reflect.Interface:
 		if v.NumMethod() == 0 {
 			v.Set(reflect.ValueOf(b))
@@ -639,15 +920,52 @@ func (d *Decoder) storeString(v reflect.Value, s string) error {
 	return err
 }
 
+// storeExtension assigns the decoded extension value to the first value it is
+// assignable to, which may be a pointer that has yet to be walked through.
+func (d *Decoder) storeExtension(v reflect.Value, x interface{}) error {
+	xv := reflect.ValueOf(x)
+	for {
+		if v.CanSet() && xv.IsValid() && xv.Type().AssignableTo(v.Type()) {
+			v.Set(xv)
+			return nil
+		} else if v.Kind() != reflect.Ptr {
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return &InvalidTypeError{Value: fmt.Sprintf("extension %T", x), Type: v.Type(), Offset: d.n}
+}
+
 func (d *Decoder) storeBigInt(v reflect.Value, i *big.Int) error {
 	var err error
 	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !i.IsInt64() || v.OverflowInt(i.Int64()) {
+			err = &OverflowError{Value: i.String(), Type: v.Type(), Offset: d.n}
+		} else {
+			v.SetInt(i.Int64())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !i.IsUint64() || v.OverflowUint(i.Uint64()) {
+			err = &OverflowError{Value: i.String(), Type: v.Type(), Offset: d.n}
+		} else {
+			v.SetUint(i.Uint64())
+		}
 	case reflect.Ptr:
 		if v.Type() == typeOfBigInt {
 			v.Set(reflect.ValueOf(i))
 		} else {
 			err = &InvalidTypeError{Value: "big integer", Type: v.Type(), Offset: d.n}
 		}
+	case reflect.Struct:
+		if v.Type() == typeOfBigIntValue {
+			v.Addr().Interface().(*big.Int).Set(i)
+		} else {
+			err = &InvalidTypeError{Value: "big integer", Type: v.Type(), Offset: d.n}
+		}
 	case reflect.Interface:
 		if v.NumMethod() == 0 {
 			v.Set(reflect.ValueOf(i))
@@ -665,16 +983,18 @@ func (d *Decoder) storeInt(v reflect.Value, i int64) error {
 	switch v.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		if v.OverflowInt(i) {
-			err = &InvalidTypeError{Value: "integer overflow", Type: v.Type(), Offset: d.n}
+			err = &OverflowError{Value: strconv.FormatInt(i, 10), Type: v.Type(), Offset: d.n}
 		} else {
 			v.SetInt(i)
 		}
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		if v.OverflowUint(uint64(i)) {
-			err = &InvalidTypeError{Value: "unsigned integer overflow", Type: v.Type(), Offset: d.n}
+		if i < 0 || v.OverflowUint(uint64(i)) {
+			err = &OverflowError{Value: strconv.FormatInt(i, 10), Type: v.Type(), Offset: d.n}
 		} else {
 			v.SetUint(uint64(i))
 		}
+	case reflect.Ptr, reflect.Struct:
+		err = d.storeBigInt(v, big.NewInt(i))
 	case reflect.Interface:
 		if v.NumMethod() == 0 {
 			v.Set(reflect.ValueOf(i))
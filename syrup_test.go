@@ -2,9 +2,17 @@ package syrup
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"math/big"
+	"net/url"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -71,8 +79,13 @@ var astruct2 Struct2
 var astruct3 Struct3
 var astruct4 Struct4
 var ainterface interface{}
+var abytearr [4]byte
+var abigintval big.Int
+var aintarr [4]int
+var anamedbytearr [4]namedByte
 
 func resetAddressables() {
+	abigint = nil
 	abyte = nil
 	astringarr = nil
 	aMapStringInt = nil
@@ -146,6 +159,24 @@ var tests = []test{
 		encoding: []byte("i2147483648e"),
 		decode:   &auint64,
 	},
+	{
+		name:     "Max Uint64",
+		goValue:  uint64(math.MaxUint64),
+		encoding: []byte("i18446744073709551615e"),
+		decode:   &auint64,
+	},
+	{
+		name:     "Small BigInt",
+		goValue:  big.NewInt(42),
+		encoding: []byte("i42e"),
+		decode:   &abigint,
+	},
+	{
+		name:     "BigInt Value",
+		goValue:  *big.NewInt(0).Mul(big.NewInt(9223372036854775807), big.NewInt(-10)),
+		encoding: []byte("i-92233720368547758070e"),
+		decode:   &abigintval,
+	},
 	{
 		name:     "Uint",
 		goValue:  uint(919),
@@ -216,7 +247,25 @@ var tests = []test{
 			[]byte{54, 55, 56, 57},
 		},
 		encoding: []byte("[3\"stri5e3:1234:6789]"),
-		decode: &ainterface,
+		decode:   &ainterface,
+	},
+	{
+		name:     "[4]byte",
+		goValue:  [4]byte{1, 2, 3, 4},
+		encoding: []byte{'4', ':', 1, 2, 3, 4},
+		decode:   &abytearr,
+	},
+	{
+		name:     "[4]namedByte",
+		goValue:  [4]namedByte{1, 2, 3, 4},
+		encoding: []byte("[i1ei2ei3ei4e]"),
+		decode:   &anamedbytearr,
+	},
+	{
+		name:     "[4]int",
+		goValue:  [4]int{1, -2, 3, 4},
+		encoding: []byte("[i1ei-2ei3ei4e]"),
+		decode:   &aintarr,
 	},
 	{
 		name:     "[]string",
@@ -455,6 +504,18 @@ func TestDecodeInterface(t *testing.T) {
 	}
 }
 
+func TestDecodeInterfaceSet(t *testing.T) {
+	buf := bytes.NewBuffer([]byte("[#5\"Hello[i1e]$i42e]"))
+	var v interface{}
+	if err := NewDecoder(NewPrototypeEncoding(), buf).Decode(&v); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expected := []interface{}{Set{"Hello", []interface{}{int64(1)}}, int64(42)}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("got %#v, want %#v", v, expected)
+	}
+}
+
 func TestDecodeArraySilentDrop(t *testing.T) {
 	buf := bytes.NewBuffer([]byte("[5\"Hello7\"PtrToIt6\"World!]"))
 	dec := NewDecoder(NewPrototypeEncoding(), buf)
@@ -499,3 +560,1796 @@ func TestDecodeArrayNilInterface(t *testing.T) {
 		t.Errorf("got %v, want %v", v, expected)
 	}
 }
+
+func TestEncodeErrors(t *testing.T) {
+	type withChan struct {
+		C chan int
+	}
+	tests := []struct {
+		name   string
+		v      interface{}
+		target error
+		path   string
+	}{
+		{
+			name:   "Unsupported type",
+			v:      make(chan int),
+			target: ErrUnsupportedType,
+		},
+		{
+			name:   "Unsupported field type",
+			v:      withChan{C: make(chan int)},
+			target: ErrUnsupportedType,
+			path:   `/"C"`,
+		},
+		{
+			name:   "Nil pointer",
+			v:      Struct2{},
+			target: ErrUnsupportedValue,
+			path:   `/"S1"`,
+		},
+		{
+			name:   "Nil list element",
+			v:      []interface{}{"a", nil},
+			target: ErrUnsupportedValue,
+			path:   `/1`,
+		},
+		{
+			name:   "Nil record label",
+			v:      Record{},
+			target: ErrUnsupportedValue,
+			path:   `/<label>`,
+		},
+		{
+			name:   "Symbol label key",
+			v:      map[Symbol]interface{}{"label": make(chan int)},
+			target: ErrUnsupportedType,
+			path:   `/label`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := NewEncoder(NewPrototypeEncoding(), &buf)
+			err := enc.Encode(test.v)
+			if !errors.Is(err, test.target) {
+				t.Fatalf("got %v, want %v", err, test.target)
+			}
+			var path string
+			var te *UnsupportedTypeError
+			var ve *UnsupportedValueError
+			if errors.As(err, &te) {
+				path = te.Path.String()
+			} else if errors.As(err, &ve) {
+				path = ve.Path.String()
+			}
+			if path != test.path {
+				t.Errorf("got path %q, want %q", path, test.path)
+			}
+		})
+	}
+}
+
+type Struct5 struct {
+	S1   *Struct1
+	M    map[string]int
+	L    []string
+	Rest interface{}
+}
+
+func TestEncodeNilPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   NilPolicy
+		sentinel interface{}
+		value    Struct5
+		encoding []byte
+	}{
+		{
+			name:     "Empty",
+			policy:   NilAsEmpty,
+			value:    Struct5{Rest: ""},
+			encoding: []byte("{2\"S1{1\"Ii0e2\"DoD\x00\x00\x00\x00\x00\x00\x00\x003\"Str0\"}1\"M{}1\"L[]4\"Rest0\"}"),
+		},
+		{
+			name:     "Omitted",
+			policy:   NilOmitted,
+			encoding: []byte("{}"),
+		},
+		{
+			name:     "Default Sentinel",
+			policy:   NilAsSentinel,
+			encoding: []byte("{2\"S1<4'void>1\"M<4'void>1\"L<4'void>4\"Rest<4'void>}"),
+		},
+		{
+			name:     "Symbol Sentinel",
+			policy:   NilAsSentinel,
+			sentinel: Symbol("nil"),
+			encoding: []byte("{2\"S13'nil1\"M3'nil1\"L3'nil4\"Rest3'nil}"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := NewEncoder(NewPrototypeEncoding(), &buf)
+			enc.SetNilPolicy(test.policy)
+			if test.sentinel != nil {
+				enc.SetNilSentinel(test.sentinel)
+			}
+			if err := enc.Encode(test.value); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), test.encoding) {
+				t.Errorf("got %q, want %q", buf.Bytes(), test.encoding)
+			}
+		})
+	}
+}
+
+func TestEncodeNilPolicyError(t *testing.T) {
+	for _, policy := range []NilPolicy{NilIsError, NilAsEmpty, NilOmitted} {
+		var buf bytes.Buffer
+		enc := NewEncoder(NewPrototypeEncoding(), &buf)
+		enc.SetNilPolicy(policy)
+		// Nil list elements cannot be omitted, nor have an empty value.
+		err := enc.Encode([]interface{}{nil})
+		if !errors.Is(err, ErrUnsupportedValue) {
+			t.Errorf("policy %d: got %v, want %v", policy, err, ErrUnsupportedValue)
+		}
+	}
+}
+
+func TestDecodeNilSentinel(t *testing.T) {
+	for _, sentinel := range []interface{}{DefaultNilSentinel(), Symbol("nil")} {
+		t.Run(fmt.Sprintf("%v", sentinel), func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := NewEncoder(NewPrototypeEncoding(), &buf)
+			enc.SetNilPolicy(NilAsSentinel)
+			enc.SetNilSentinel(sentinel)
+			in := Struct5{L: []string{"a"}}
+			if err := enc.Encode(in); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			dec := NewDecoder(NewPrototypeEncoding(), &buf)
+			if err := dec.SetNilSentinel(sentinel); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			out := Struct5{S1: &Struct1{I: 1}, M: map[string]int{}, Rest: 5}
+			if err := dec.Decode(&out); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if !reflect.DeepEqual(out, in) {
+				t.Errorf("got %#v, want %#v", out, in)
+			}
+		})
+	}
+}
+
+func TestDecodeNilSentinelPositions(t *testing.T) {
+	dec := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("[{3'nil3'nil}<3'nil3'nil>]"))
+	if err := dec.SetNilSentinel(Symbol("nil")); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	var out interface{}
+	if err := dec.Decode(&out); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expect := []interface{}{
+		map[interface{}]interface{}{Symbol("nil"): nil},
+		Record{Label: Symbol("nil"), Values: []interface{}{nil}},
+	}
+	if !reflect.DeepEqual(out, expect) {
+		t.Errorf("got %#v, want %#v", out, expect)
+	}
+}
+
+// labelOnly decodes any record, keeping only its label.
+type labelOnly Symbol
+
+func (l *labelOnly) UnmarshalSyrup(d *Decoder) error {
+	var r Record
+	if err := d.Decode(&r); err != nil {
+		return err
+	}
+	*l = labelOnly(fmt.Sprint(r.Label))
+	return nil
+}
+
+func TestDecodeNilSentinelUnmarshaler(t *testing.T) {
+	type box struct {
+		P *pair
+	}
+	var buf bytes.Buffer
+	enc := NewEncoder(NewPrototypeEncoding(), &buf)
+	enc.SetNilPolicy(NilAsSentinel)
+	if err := enc.Encode(box{}); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if expect := "{1\"P<4'void>}"; buf.String() != expect {
+		t.Fatalf("got %q, want %q", buf.String(), expect)
+	}
+	dec := NewDecoder(NewPrototypeEncoding(), &buf)
+	if err := dec.SetNilSentinel(DefaultNilSentinel()); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	out := box{P: &pair{A: "a"}}
+	if err := dec.Decode(&out); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if out.P != nil {
+		t.Errorf("got %#v, want nil", out.P)
+	}
+
+	// Values other than the sentinel still reach the Unmarshaler whole.
+	dec = NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("[<4'voidi1e><4'void><3'nil>]"))
+	if err := dec.SetNilSentinel(DefaultNilSentinel()); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	var labels []*labelOnly
+	if err := dec.Decode(&labels); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	void, null := labelOnly("void"), labelOnly("nil")
+	if expect := []*labelOnly{&void, nil, &null}; !reflect.DeepEqual(labels, expect) {
+		t.Errorf("got %v, want %v", labels, expect)
+	}
+}
+
+func TestDecodeByteArrayLength(t *testing.T) {
+	buf := bytes.NewBuffer([]byte("3:abc"))
+	dec := NewDecoder(NewPrototypeEncoding(), buf)
+	var b [4]byte
+	err := dec.Decode(&b)
+	var ite *InvalidTypeError
+	if !errors.As(err, &ite) {
+		t.Errorf("got %v, want *InvalidTypeError", err)
+	}
+}
+
+type namedByte byte
+
+func TestDecodeNamedByteArray(t *testing.T) {
+	buf := bytes.NewBuffer([]byte("4:abcd"))
+	dec := NewDecoder(NewPrototypeEncoding(), buf)
+	var b [4]namedByte
+	if err := dec.Decode(&b); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if want := [4]namedByte{'a', 'b', 'c', 'd'}; b != want {
+		t.Errorf("got %v, want %v", b, want)
+	}
+}
+
+func TestDecodeDictMismatch(t *testing.T) {
+	for _, v := range []interface{}{new(int), new([]int), new(map[int]int), new(labeledPoint)} {
+		dec := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("{1\"ai1e}"))
+		var ite *InvalidTypeError
+		if err := dec.Decode(v); !errors.As(err, &ite) {
+			t.Errorf("%T: got %v, want *InvalidTypeError", v, err)
+		}
+	}
+}
+
+func TestDecodeIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		decode   interface{}
+		value    string
+	}{
+		{"Uint8", "i256e", new(uint8), "256"},
+		{"Negative Uint", "i-1e", new(uint), "-1"},
+		{"Int64", "i9223372036854775808e", new(int64), "9223372036854775808"},
+		{"Uint64", "i18446744073709551616e", new(uint64), "18446744073709551616"},
+		{"Negative Uint64", "i-9223372036854775809e", new(uint64), "-9223372036854775809"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dec := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString(test.encoding))
+			err := dec.Decode(test.decode)
+			var oe *OverflowError
+			if !errors.As(err, &oe) {
+				t.Fatalf("got %v, want *OverflowError", err)
+			}
+			if oe.Value != test.value {
+				t.Errorf("got value %s, want %s", oe.Value, test.value)
+			}
+		})
+	}
+}
+
+func TestSharedEncodingConcurrentFloats(t *testing.T) {
+	enc := NewPrototypeEncoding()
+	in := []interface{}{float32(1.5), float64(-2.25), float32(3), float64(4.125)}
+	var buf bytes.Buffer
+	if err := NewEncoder(enc, &buf).Encode(in); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				var out interface{}
+				dec := NewDecoder(enc, bytes.NewReader(buf.Bytes()))
+				if err := dec.Decode(&out); err != nil {
+					t.Errorf("got error %v", err)
+					return
+				}
+				if !reflect.DeepEqual(out, in) {
+					t.Errorf("got %v, want %v", out, in)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+type Struct6 struct {
+	Name  Symbol
+	Home  *url.URL
+	Items []interface{}
+}
+
+func TestCustomEncoding(t *testing.T) {
+	d := PrototypeDelimiters()
+	d.ListOpen = '('
+	d.ListClose = ')'
+	d.Symbol = '/'
+	enc, err := NewEncoding(
+		WithDelimiters(d),
+		WithExtension(Extension{
+			Marker: '@',
+			Type:   reflect.TypeOf(&url.URL{}),
+			Marshal: func(v interface{}) ([]byte, error) {
+				return []byte(v.(*url.URL).String()), nil
+			},
+			Unmarshal: func(b []byte) (interface{}, error) {
+				return url.Parse(string(b))
+			},
+		}))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	home, _ := url.Parse("https://example.com/a")
+	in := Struct6{
+		Name:  "alice",
+		Home:  home,
+		Items: []interface{}{home, int64(1)},
+	}
+	expect := []byte("{4\"Name5/alice4\"Home21@https://example.com/a5\"Items(21@https://example.com/ai1e)}")
+	var buf bytes.Buffer
+	if err := NewEncoder(enc, &buf).Encode(in); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Fatalf("got %q, want %q", buf.Bytes(), expect)
+	}
+	var out Struct6
+	if err := NewDecoder(enc, &buf).Decode(&out); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("got %v, want %v", out, in)
+	}
+}
+
+func TestNewEncodingAmbiguous(t *testing.T) {
+	d := PrototypeDelimiters()
+	d.SetClose = d.ListClose
+	if _, err := NewEncoding(WithDelimiters(d)); err == nil {
+		t.Errorf("expected error for duplicate delimiters")
+	}
+	d = PrototypeDelimiters()
+	d.Bytes = '5'
+	if _, err := NewEncoding(WithDelimiters(d)); err == nil {
+		t.Errorf("expected error for digit delimiter")
+	}
+	x := Extension{
+		Marker:    PrototypeDelimiters().String,
+		Type:      reflect.TypeOf(url.URL{}),
+		Marshal:   func(v interface{}) ([]byte, error) { return nil, nil },
+		Unmarshal: func(b []byte) (interface{}, error) { return nil, nil },
+	}
+	if _, err := NewEncoding(WithExtension(x)); err == nil {
+		t.Errorf("expected error for extension marker reusing a delimiter")
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	tests := []struct {
+		name    string
+		printer Printer
+		value   interface{}
+		text    string
+	}{
+		{
+			name:  "Scalars",
+			value: []interface{}{true, false, int64(-5), float32(1.5), 2.0, "a\"b", []byte("c\x00"), Symbol("sym"), Symbol("two words"), Symbol("12")},
+			text:  `[#t #f -5 1.5f 2.0 "a\"b" #"c\x00" sym |two words| |12|]`,
+		},
+		{
+			name:  "Big integer",
+			value: big.NewInt(0).Mul(big.NewInt(9223372036854775807), big.NewInt(10)),
+			text:  `92233720368547758070`,
+		},
+		{
+			name:  "Non-finite floats",
+			value: []interface{}{float32(math.Inf(1)), math.Inf(-1)},
+			text:  `[#xf"7f800000" #xd"fff0000000000000"]`,
+		},
+		{
+			name:    "Hex bytes",
+			printer: Printer{HexBytes: true},
+			value:   []byte{0xde, 0xad},
+			text:    `#x"dead"`,
+		},
+		{
+			name:  "Compound",
+			value: Record{Label: Symbol("op:deliver"), Values: []interface{}{Set{int64(1)}, map[interface{}]interface{}{"b": int64(2), "a": int64(1)}}},
+			text:  `<|op:deliver| #{1} {"a": 1, "b": 2}>`,
+		},
+		{
+			name:  "Go struct",
+			value: Struct1{I: 3, Str: "x"},
+			text:  `{"Do": 0.0, "I": 3, "Str": "x"}`,
+		},
+		{
+			name:    "Indented",
+			printer: Printer{Indent: "  "},
+			value:   Record{Label: Symbol("r"), Values: []interface{}{[]interface{}{int64(1)}, map[interface{}]interface{}{"k": "v"}}},
+			text:    "<r\n  [\n    1\n  ]\n  {\n    \"k\": \"v\"\n  }\n>",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.printer.Sprint(test.value); got != test.text {
+				t.Errorf("got %s, want %s", got, test.text)
+			}
+		})
+	}
+}
+
+func TestFormatter(t *testing.T) {
+	r := Record{Label: Symbol("point"), Values: []interface{}{int64(1), Set{Symbol("a")}}}
+	if got := fmt.Sprintf("%v|%v", r, Symbol("x y")); got != "<point 1 #{a}>||x y|" {
+		t.Errorf("got %s", got)
+	}
+	if got := fmt.Sprintf("%s|%q|%-4s|", Symbol("x y"), Symbol("x y"), Symbol("a")); got != `x y|"x y"|a   |` {
+		t.Errorf("got %s", got)
+	}
+	if got := fmt.Sprintf("%#v", Set{Symbol("a")}); got != `syrup.Set{syrup.Symbol("a")}` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestDecodeSkipsUnknownFields(t *testing.T) {
+	in := bytes.NewBufferString("{1\"Ii1e7\"Unknown[i1e{1\"a#$}]3\"Str1\"x}")
+	var s Struct1
+	if err := NewDecoder(NewPrototypeEncoding(), in).Decode(&s); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expect := Struct1{I: 1, Str: "x"}
+	if !reflect.DeepEqual(s, expect) {
+		t.Errorf("got %v, want %v", s, expect)
+	}
+}
+
+func TestDecodeZeroLength(t *testing.T) {
+	var v interface{}
+	if err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("[0\"0:0']")).Decode(&v); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expected := []interface{}{"", []byte{}, Symbol("")}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("got %#v, want %#v", v, expected)
+	}
+}
+
+func TestDecodeEOF(t *testing.T) {
+	d := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("i1e i2e "))
+	for _, want := range []int64{1, 2} {
+		var got int64
+		if err := d.Decode(&got); err != nil || got != want {
+			t.Fatalf("got %d, %v, want %d", got, err, want)
+		}
+	}
+	var v interface{}
+	if err := d.Decode(&v); err != io.EOF {
+		t.Errorf("got %v, want %v", err, io.EOF)
+	}
+	if err := NewDecoder(NewPrototypeEncoding(), &bytes.Buffer{}).Decode(&v); err != io.EOF {
+		t.Errorf("empty stream: got %v, want %v", err, io.EOF)
+	}
+}
+
+func TestDecodeUnexpectedEOF(t *testing.T) {
+	for _, in := range []string{"[i1e", "5\"abc", "i12"} {
+		var v interface{}
+		err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString(in)).Decode(&v)
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("%q: got %v, want %v", in, err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func TestEncodeCanonical(t *testing.T) {
+	in := map[interface{}]interface{}{
+		"zz": Set{int64(10), int64(2), []interface{}{"b", "a"}},
+		"a":  map[string]int{"c": 1, "bb": 2},
+		Symbol("a"): Record{
+			Label:  Symbol("r"),
+			Values: []interface{}{map[string]bool{"y": true, "x": false}},
+		},
+	}
+	expect := []byte("{1\"a{1\"ci1e2\"bbi2e}1'a<1'r{1\"xf1\"yt}>2\"zz#[1\"b1\"a]i10ei2e$}")
+	for i := 0; i < 10; i++ {
+		var buf bytes.Buffer
+		enc := NewEncoder(NewPrototypeEncoding(), &buf)
+		enc.SetCanonical(true)
+		if err := enc.Encode(in); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		if !bytes.Equal(buf.Bytes(), expect) {
+			t.Fatalf("got %q, want %q", buf.Bytes(), expect)
+		}
+	}
+}
+
+func TestDecodeToken(t *testing.T) {
+	d := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("{1\"a[i1e3:abc]} <1'pi92233720368547758070e> #t$ 2\"hi"))
+	bi, _ := new(big.Int).SetString("92233720368547758070", 10)
+	expect := []Token{
+		DictStart, "a", ListStart, int64(1), []byte("abc"), ListEnd, DictEnd,
+		RecordStart, Symbol("p"), bi, RecordEnd,
+		SetStart, true, SetEnd,
+	}
+	for i, want := range expect {
+		got, err := d.Token()
+		if err != nil {
+			t.Fatalf("%d: got error %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: got %#v, want %#v", i, got, want)
+		}
+	}
+	var s string
+	if err := d.Decode(&s); err != nil || s != "hi" {
+		t.Errorf("got %q, %v", s, err)
+	}
+	if _, err := d.Token(); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+	d = NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("[3\"a"))
+	d.Token()
+	if _, err := d.Token(); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestDecoderMore(t *testing.T) {
+	d := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("[i1e[]2\"hi]"))
+	if tok, err := d.Token(); err != nil || tok != ListStart {
+		t.Fatalf("got %v, %v", tok, err)
+	}
+	var got []interface{}
+	for {
+		more, err := d.More()
+		if err != nil {
+			t.Fatalf("got error %v", err)
+		} else if !more {
+			break
+		}
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		got = append(got, v)
+	}
+	if expect := []interface{}{int64(1), []interface{}{}, "hi"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %#v, want %#v", got, expect)
+	}
+	if tok, err := d.Token(); err != nil || tok != ListEnd {
+		t.Errorf("got %v, %v, want ListEnd", tok, err)
+	}
+	if _, err := d.More(); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+}
+
+func TestEncodeToken(t *testing.T) {
+	tokens := []Token{DictStart, "b", ListStart, int64(1), ListEnd, "a", SetStart, Symbol("y"), Symbol("x"), SetEnd, DictEnd}
+	for _, canonical := range []bool{false, true} {
+		var buf bytes.Buffer
+		enc := NewEncoder(NewPrototypeEncoding(), &buf)
+		enc.SetCanonical(canonical)
+		for _, tok := range tokens {
+			if err := enc.EncodeToken(tok); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+		}
+		expect := "{1\"b[i1e]1\"a#1'y1'x$}"
+		if canonical {
+			expect = "{1\"a#1'x1'y$1\"b[i1e]}"
+		}
+		if buf.String() != expect {
+			t.Errorf("canonical %v: got %q, want %q", canonical, buf.String(), expect)
+		}
+	}
+	enc := NewEncoder(NewPrototypeEncoding(), &bytes.Buffer{})
+	enc.EncodeToken(ListStart)
+	if err := enc.EncodeToken(DictEnd); err == nil {
+		t.Errorf("expected error for mismatched delimiter")
+	}
+	if err := NewEncoder(NewPrototypeEncoding(), &bytes.Buffer{}).EncodeToken(ListEnd); err == nil {
+		t.Errorf("expected error for unopened delimiter")
+	}
+}
+
+func TestPrintStream(t *testing.T) {
+	in := bytes.NewBufferString("i1e 3'abc\n[0\"0:]")
+	var out bytes.Buffer
+	p := &Printer{}
+	if err := p.PrintStream(&out, NewDecoder(NewPrototypeEncoding(), in)); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expect := "1\nabc\n[\"\" #\"\"]\n"
+	if out.String() != expect {
+		t.Errorf("got %q, want %q", out.String(), expect)
+	}
+}
+
+func TestParseText(t *testing.T) {
+	bi, _ := new(big.Int).SetString("-92233720368547758070", 10)
+	tests := []struct {
+		name   string
+		text   string
+		expect interface{}
+	}{
+		{"Booleans", "[#t #f]", []interface{}{true, false}},
+		{"Integers", "[0 -5 +7 -92233720368547758070]", []interface{}{int64(0), int64(-5), int64(7), bi}},
+		{"Floats", "[1.5f 2.0 -1e3 #xf\"3fc00000\" #xd\"4000000000000000\"]", []interface{}{float32(1.5), 2.0, -1000.0, float32(1.5), 2.0}},
+		{"String", `"a\"b\né😀"`, "a\"b\né\U0001F600"},
+		{"Bytestrings", `[#"c\x00" #x"de ad" #[aGk=] #[aGk]]`, []interface{}{[]byte("c\x00"), []byte{0xde, 0xad}, []byte("hi"), []byte("hi")}},
+		{"Symbols", "[sym |two words| |12| a-b/c.d]", []interface{}{Symbol("sym"), Symbol("two words"), Symbol("12"), Symbol("a-b/c.d")}},
+		{"Record", `<|op:deliver| [] #{}>`, Record{Label: Symbol("op:deliver"), Values: []interface{}{[]interface{}{}, Set{}}}},
+		{"Dictionary", `{"a": 1, b: [2,3]}`, map[interface{}]interface{}{"a": int64(1), Symbol("b"): []interface{}{int64(2), int64(3)}}},
+		{"Comments and annotations", "; leading\n@\"note\" @<ann> [1 ; one\n 2]", []interface{}{int64(1), int64(2)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := ParseText(test.text)
+			if test.expect == nil {
+				if err == nil {
+					t.Fatalf("expected error, got %v", v)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if !reflect.DeepEqual(v, test.expect) {
+				t.Errorf("got %#v, want %#v", v, test.expect)
+			}
+		})
+	}
+}
+
+func TestParseTextErrors(t *testing.T) {
+	for _, text := range []string{
+		"", "[1", "<>", "{1 2}", "{a: 1 a: 2}", "{#\"k\": 1}", `"\x41"`,
+		"1.5.2", "1x", `#xf"00"`, "#!embedded", "#q", "1 2", ">", `#"é"`,
+	} {
+		if v, err := ParseText(text); err == nil {
+			t.Errorf("%q: expected error, got %v", text, v)
+		}
+	}
+}
+
+func TestTextRoundTrip(t *testing.T) {
+	values := []interface{}{
+		Record{
+			Label: Symbol("op:deliver"),
+			Values: []interface{}{
+				true, int64(-3), big.NewInt(0).Mul(big.NewInt(math.MaxInt64), big.NewInt(3)),
+				float32(0.1), 1e-300, math.NaN(), float32(math.Inf(-1)),
+				"tab\there \x7f", []byte{0, '"', 0xff}, Symbol(""), Symbol("-"), Symbol("+1"),
+				Set{int64(1), "x"},
+				map[interface{}]interface{}{Symbol("k"): []interface{}{}, int64(2): Record{Label: "s"}},
+			},
+		},
+	}
+	for _, p := range []Printer{{}, {Indent: "\t", HexBytes: true}} {
+		for _, v := range values {
+			text := p.Sprint(v)
+			parsed, err := ParseText(text)
+			if err != nil {
+				t.Fatalf("%s: got error %v", text, err)
+			}
+			var want, got bytes.Buffer
+			for _, e := range []struct {
+				buf *bytes.Buffer
+				v   interface{}
+			}{{&want, v}, {&got, parsed}} {
+				enc := NewEncoder(NewPrototypeEncoding(), e.buf)
+				enc.SetCanonical(true)
+				if err := enc.Encode(e.v); err != nil {
+					t.Fatalf("got error %v", err)
+				}
+			}
+			if p.Sprint(parsed) != text || !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Errorf("got %s, want %s", p.Sprint(parsed), text)
+			}
+		}
+	}
+}
+
+func TestTextDecoder(t *testing.T) {
+	d := NewTextDecoder(bytes.NewBufferString(`{"I": 3, "Str": "x"} ; a comment`))
+	var s Struct1
+	if err := d.Decode(&s); err != nil {
+		t.Fatalf("got error %v", err)
+	} else if s.I != 3 || s.Str != "x" {
+		t.Errorf("got %+v", s)
+	}
+	if err := d.Decode(&s); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+}
+
+func TestPreservesEncoding(t *testing.T) {
+	two64 := new(big.Int).Lsh(big.NewInt(1), 64)
+	tests := []struct {
+		name     string
+		value    interface{}
+		encoding []byte
+	}{
+		{"Zero", int64(0), []byte{0xb0, 0x00}},
+		{"Small ints", []interface{}{int64(1), int64(-1), int64(128), int64(-129)}, []byte{0xb5, 0xb0, 1, 0x01, 0xb0, 1, 0xff, 0xb0, 2, 0x00, 0x80, 0xb0, 2, 0xff, 0x7f, 0x84}},
+		{"Min Int64", int64(math.MinInt64), []byte{0xb0, 8, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+		{"Big int", two64, []byte{0xb0, 9, 1, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"Negative big int", new(big.Int).Neg(two64), []byte{0xb0, 9, 0xff, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"Booleans", []interface{}{true, false}, []byte{0xb5, 0x81, 0x80, 0x84}},
+		{"Floats", []interface{}{float32(1.5), 1.5}, []byte{0xb5, 0x87, 4, 0x3f, 0xc0, 0, 0, 0x87, 8, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0, 0x84}},
+		{"Atoms", []interface{}{"hi", []byte{0}, Symbol("a"), ""}, []byte{0xb5, 0xb1, 2, 'h', 'i', 0xb2, 1, 0, 0xb3, 1, 'a', 0xb1, 0, 0x84}},
+		{"Record", Record{Label: Symbol("p"), Values: []interface{}{int64(1)}}, []byte{0xb4, 0xb3, 1, 'p', 0xb0, 1, 1, 0x84}},
+		{"Set", Set{int64(1)}, []byte{0xb6, 0xb0, 1, 1, 0x84}},
+		{"Dictionary", map[interface{}]interface{}{"a": []interface{}{}}, []byte{0xb7, 0xb1, 1, 'a', 0xb5, 0x84, 0x84}},
+	}
+	enc := NewPreservesEncoding()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := NewEncoder(enc, &buf).Encode(test.value); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), test.encoding) {
+				t.Fatalf("got % x, want % x", buf.Bytes(), test.encoding)
+			}
+			var v interface{}
+			if err := NewDecoder(enc, &buf).Decode(&v); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if !reflect.DeepEqual(v, test.value) {
+				t.Errorf("got %#v, want %#v", v, test.value)
+			}
+		})
+	}
+}
+
+func TestPreservesStruct(t *testing.T) {
+	in := Struct2{S1: &Struct1{I: -5, Do: 3.14159, Str: "x"}}
+	enc := NewPreservesEncoding()
+	var buf bytes.Buffer
+	if err := NewEncoder(enc, &buf).Encode(in); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	var out Struct2
+	if err := NewDecoder(enc, &buf).Decode(&out); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+func TestPreservesDecodeErrors(t *testing.T) {
+	for _, in := range [][]byte{
+		{0x84},
+		{0x85, 0xb0, 0},
+		{0x86, 0xb0, 0},
+		{0x87, 3, 0, 0, 0},
+		{0xb5, 0xb0, 1},
+		{0x42},
+	} {
+		var v interface{}
+		if err := NewDecoder(NewPreservesEncoding(), bytes.NewBuffer(in)).Decode(&v); err == nil {
+			t.Errorf("% x: expected error, got %#v", in, v)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	bi, _ := new(big.Int).SetString("92233720368547758070", 10)
+	v := NewRecord(NewSymbol("op"),
+		NewBool(true),
+		NewFloat32(1.5),
+		NewFloat64(2),
+		NewInt(-3),
+		NewBigInt(bi),
+		NewString("s"),
+		NewBytes([]byte{1}),
+		NewList(),
+		NewSet(NewInt(2), NewInt(1)),
+		NewDict(
+			DictEntry{Key: NewBytes([]byte("k")), Value: NewInt(1)},
+			DictEntry{Key: NewList(NewInt(1)), Value: NewString("list key")},
+			DictEntry{Key: NewString("a"), Value: NewSymbol("z")},
+		),
+	)
+	if got, want := v.String(), `<op #t 1.5f 2.0 -3 92233720368547758070 "s" #"\x01" [] #{2 1} {#"k": 1, [1]: "list key", "a": z}>`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if v.Kind() != RecordKind || v.Label().Symbol() != "op" || v.Len() != 10 {
+		t.Errorf("got %v %v %d", v.Kind(), v.Label(), v.Len())
+	}
+	if i, ok := v.Index(4).Int64(); ok || v.Index(4).BigInt().Cmp(bi) != 0 {
+		t.Errorf("got %d, %v", i, ok)
+	}
+	if x, ok := v.Index(9).Get(NewList(NewInt(1))); !ok || x.String() != "list key" {
+		t.Errorf("got %v, %v", x, ok)
+	}
+	for _, enc := range []*Encoding{NewPrototypeEncoding(), NewPreservesEncoding()} {
+		var buf bytes.Buffer
+		if err := NewEncoder(enc, &buf).Encode(v); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		var out Value
+		if err := NewDecoder(enc, &buf).Decode(&out); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		if !reflect.DeepEqual(out, v) {
+			t.Errorf("got %v, want %v", out, v)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic calling Bool on a record")
+		}
+	}()
+	v.Bool()
+}
+
+func TestDecodeValue(t *testing.T) {
+	in := "{3:keyi1e[i1e]1\"v}"
+	var v interface{}
+	if err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString(in)).Decode(&v); err == nil {
+		t.Errorf("expected error decoding unhashable keys into interface{}")
+	}
+	var s struct {
+		D Value
+		L []Value
+	}
+	if err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("{1\"D"+in+"1\"L[t#$]}")).Decode(&s); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if s.D.Kind() != DictKind || s.D.Len() != 2 || len(s.L) != 2 || s.L[1].Kind() != SetKind {
+		t.Errorf("got %v %v", s.D, s.L)
+	}
+	var x Value
+	if err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("<>")).Decode(&x); err == nil {
+		t.Errorf("expected error for a record without a label")
+	}
+	if err := NewEncoder(NewPrototypeEncoding(), &bytes.Buffer{}).Encode(Value{}); !errors.Is(err, ErrUnsupportedValue) {
+		t.Errorf("got %v, want ErrUnsupportedValue", err)
+	}
+	vo, err := ValueOf(Struct1{I: 1})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	} else if x, ok := vo.Get(NewString("I")); !ok || x.Kind() != IntKind {
+		t.Errorf("got %v", vo)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	bi, _ := new(big.Int).SetString("92233720368547758070", 10)
+	tests := []struct {
+		name   string
+		a, b   interface{}
+		expect int
+	}{
+		{"Bool before float", true, float32(0), -1},
+		{"Float before double", float32(10), 0.5, -1},
+		{"Double before int", math.Inf(1), int64(-10), -1},
+		{"Int before string", bi, "", -1},
+		{"String before bytes", "z", []byte("a"), -1},
+		{"Bytes before symbol", []byte("z"), Symbol("a"), -1},
+		{"Symbol before record", Symbol("z"), Record{Label: Symbol("a")}, -1},
+		{"Record before list", Record{Label: Symbol("z")}, []interface{}{}, -1},
+		{"List before set", []interface{}{int64(1)}, Set{}, -1},
+		{"Set before dict", Set{int64(1)}, map[interface{}]interface{}{}, -1},
+		{"False before true", false, true, -1},
+		{"Int and big int", int64(5), big.NewInt(5), 0},
+		{"Negative int", int64(-5), int64(3), -1},
+		{"Big ints", new(big.Int).Neg(bi), bi, -1},
+		{"Negative zero", math.Copysign(0, -1), 0.0, -1},
+		{"NaN after infinity", math.NaN(), math.Inf(1), 1},
+		{"Negative NaN first", math.Float64frombits(0xfff8000000000000), math.Inf(-1), -1},
+		{"Float32", float32(-2), float32(-1), -1},
+		{"Strings", "ab", "b", -1},
+		{"UTF-8 strings", "￿", "\U00010000", -1},
+		{"Records by label", Record{Label: Symbol("a"), Values: []interface{}{int64(9)}}, Record{Label: Symbol("b")}, -1},
+		{"Records by values", Record{Label: Symbol("a"), Values: []interface{}{int64(1)}}, Record{Label: Symbol("a"), Values: []interface{}{int64(1), int64(0)}}, -1},
+		{"List prefix", []interface{}{int64(1)}, []interface{}{int64(1), int64(2)}, -1},
+		{"Lists", []interface{}{int64(2)}, []interface{}{int64(1), int64(2)}, 1},
+		{"Set order", Set{int64(2), int64(1)}, Set{int64(1), int64(2)}, 0},
+		{"Sets", Set{int64(3), int64(1)}, Set{int64(2), int64(1)}, 1},
+		{"Dict keys", map[interface{}]interface{}{"a": int64(9)}, map[interface{}]interface{}{"b": int64(1)}, -1},
+		{"Dict values", map[interface{}]interface{}{"a": int64(1), "b": int64(2)}, map[interface{}]interface{}{"b": int64(1), "a": int64(1)}, 1},
+		{"Struct and map", Struct1{I: 1}, map[string]interface{}{"I": 1, "Do": 0.0, "Str": ""}, 0},
+		{"Values", NewInt(2), int64(1), 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Compare(test.a, test.b); got != test.expect {
+				t.Errorf("got %d, want %d", got, test.expect)
+			}
+			if got := Compare(test.b, test.a); got != -test.expect {
+				t.Errorf("reversed: got %d, want %d", got, -test.expect)
+			}
+		})
+	}
+}
+
+func TestLess(t *testing.T) {
+	s := Set{"b", int64(2), Symbol("a"), true, big.NewInt(1), []byte("c")}
+	sort.Slice(s, func(i, j int) bool { return Less(s[i], s[j]) })
+	expect := Set{true, big.NewInt(1), int64(2), "b", []byte("c"), Symbol("a")}
+	if !reflect.DeepEqual(s, expect) {
+		t.Errorf("got %v, want %v", s, expect)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   interface{}
+		expect bool
+	}{
+		{"Int and big int", int64(5), big.NewInt(5), true},
+		{"Int types", int8(-3), uint64(3), false},
+		{"Set order", Set{int64(1), "a", Set{int64(2), int64(3)}}, Set{Set{int64(3), int64(2)}, "a", int64(1)}, true},
+		{"Set contents", Set{int64(1)}, Set{int64(1), int64(2)}, false},
+		{"Map key types", map[string]int{"a": 1, "b": 2}, map[interface{}]interface{}{"b": big.NewInt(2), "a": int64(1)}, true},
+		{"Struct and map", Struct1{I: 1, Str: "s"}, map[interface{}]interface{}{"I": int64(1), "Do": 0.0, "Str": "s"}, true},
+		{"Slice and list", []int{1, 2}, []interface{}{int64(1), big.NewInt(2)}, true},
+		{"Byte array and slice", [2]byte{1, 2}, []byte{1, 2}, true},
+		{"String and symbol", "a", Symbol("a"), false},
+		{"Float sizes", float32(1.5), 1.5, false},
+		{"NaN", math.NaN(), math.NaN(), true},
+		{"Zeros", math.Copysign(0, -1), 0.0, false},
+		{"Value", NewSet(NewInt(1), NewInt(2)), Set{int64(2), int64(1)}, true},
+		{"Unencodable", make(chan int), make(chan int), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Equal(test.a, test.b); got != test.expect {
+				t.Errorf("got %v, want %v", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	a := map[interface{}]interface{}{"set": Set{int64(2), int64(1)}, "n": int64(5)}
+	b := map[string]interface{}{"n": big.NewInt(5), "set": Set{int64(1), int64(2)}}
+	da, err := Digest(sha256.New, a)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	db, err := Digest(sha256.New, b)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expect := sha256.Sum256([]byte("{1\"ni5e3\"set#i1ei2e$}"))
+	if !bytes.Equal(da, db) || !bytes.Equal(da, expect[:]) {
+		t.Errorf("got %x and %x, want %x", da, db, expect)
+	}
+	if _, err := Digest(sha256.New, make(chan int)); err == nil {
+		t.Errorf("expected error")
+	}
+
+	var buf bytes.Buffer
+	e := NewHashingEncoder(NewPrototypeEncoding(), &buf, sha256.New())
+	for _, v := range []interface{}{a, int64(1)} {
+		if err := e.Encode(v); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	if sum := sha256.Sum256(buf.Bytes()); !bytes.Equal(e.Sum(nil), sum[:]) {
+		t.Errorf("got %x, want %x", e.Sum(nil), sum)
+	}
+}
+
+func TestPointerText(t *testing.T) {
+	tests := []struct {
+		text string
+		p    Pointer
+	}{
+		{"", Pointer{}},
+		{`/"manifest"/3/<label>`, Pointer{"manifest", 3, RecordLabel{}}},
+		{`/label/|<label>|`, Pointer{Symbol("label"), Symbol("<label>")}},
+		{`/"a/b"/|c/d|/-1/|two words|`, Pointer{"a/b", Symbol("c/d"), -1, Symbol("two words")}},
+		{`/"q\"uote"/|12|`, Pointer{`q"uote`, Symbol("12")}},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			p, err := ParsePointer(test.text)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if !reflect.DeepEqual(p, test.p) {
+				t.Errorf("got %#v, want %#v", p, test.p)
+			}
+			if s := test.p.String(); s != test.text {
+				t.Errorf("got %s, want %s", s, test.text)
+			}
+		})
+	}
+	for _, text := range []string{"a", "/", "//a", `/"open`, "/1.5"} {
+		if p, err := ParsePointer(text); err == nil {
+			t.Errorf("%q: expected error, got %v", text, p)
+		}
+	}
+}
+
+func TestPointerGetSet(t *testing.T) {
+	var tree interface{}
+	in := "{8\"manifest[i0ei1ei2e<5'entry2\"id>]3'sym{i7et}}"
+	if err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString(in)).Decode(&tree); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	var val Value
+	if err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString(in)).Decode(&val); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	for _, root := range []interface{}{tree, val} {
+		for _, test := range []struct {
+			p      Pointer
+			expect interface{}
+		}{
+			{Pointer{"manifest", 3, RecordLabel{}}, Symbol("entry")},
+			{Pointer{"manifest", 3, 0}, "id"},
+			{Pointer{Symbol("sym"), 7}, true},
+		} {
+			got, err := test.p.Get(root)
+			if err != nil {
+				t.Fatalf("%s: got error %v", test.p, err)
+			} else if !Equal(got, test.expect) {
+				t.Errorf("%s: got %v, want %v", test.p, got, test.expect)
+			}
+		}
+		for _, p := range []Pointer{{"missing"}, {"manifest", 4}, {"manifest", 3, Symbol("label")}, {"manifest", 0, 0}} {
+			if _, err := p.Get(root); err == nil {
+				t.Errorf("%s: expected error", p)
+			}
+		}
+	}
+
+	for _, root := range []interface{}{&tree, &val} {
+		if err := (Pointer{"manifest", 3, RecordLabel{}}).Set(root, Symbol("renamed")); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		if err := (Pointer{"manifest", 1}).Set(root, "one"); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		if err := (Pointer{"added"}).Set(root, 5); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		if err := (Pointer{"missing", "deeper"}).Set(root, 5); err == nil {
+			t.Errorf("expected error")
+		}
+		expect := map[interface{}]interface{}{
+			"manifest":    []interface{}{int64(0), "one", int64(2), Record{Label: Symbol("renamed"), Values: []interface{}{"id"}}},
+			Symbol("sym"): map[interface{}]interface{}{int64(7): true},
+			"added":       int64(5),
+		}
+		if !Equal(reflect.ValueOf(root).Elem().Interface(), expect) {
+			t.Errorf("got %v, want %v", reflect.ValueOf(root).Elem().Interface(), expect)
+		}
+	}
+
+	s := Struct5{S1: &Struct1{I: 1}, M: map[string]int{"a": 1}, L: []string{"x"}}
+	if got, err := (Pointer{"S1", "I"}).Get(s); err != nil || got != 1 {
+		t.Errorf("got %v, %v", got, err)
+	}
+	for _, test := range []struct {
+		p Pointer
+		v interface{}
+	}{
+		{Pointer{"S1", "Str"}, "set"},
+		{Pointer{"M", "b"}, int64(2)},
+		{Pointer{"L", 0}, "y"},
+		{Pointer{"Rest"}, Set{int64(1)}},
+	} {
+		if err := test.p.Set(&s, test.v); err != nil {
+			t.Fatalf("%s: got error %v", test.p, err)
+		}
+	}
+	if s.S1.Str != "set" || s.M["b"] != 2 || s.L[0] != "y" || !Equal(s.Rest, Set{int64(1)}) {
+		t.Errorf("got %+v", s)
+	}
+	if err := (Pointer{"S1", "I"}).Set(&s, "not an int"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+type taggedStruct struct {
+	Name   string `syrup:"name,symbol"`
+	Port   *int   `syrup:"port,optional"`
+	Hidden string `syrup:"-"`
+	Plain  bool
+}
+
+type labeledPoint struct {
+	X, Y int
+}
+
+func (labeledPoint) SyrupLabel() Symbol { return "point" }
+
+// upper encodes as an uppercase string and decodes any string into lowercase.
+type upper string
+
+func (u upper) MarshalSyrup(e *Encoder) error {
+	return e.Encode(strings.ToUpper(string(u)))
+}
+
+func (u *upper) UnmarshalSyrup(d *Decoder) error {
+	var s string
+	if err := d.Decode(&s); err != nil {
+		return err
+	}
+	*u = upper(strings.ToLower(s))
+	return nil
+}
+
+// pair encodes itself token by token.
+type pair struct {
+	A, B upper
+}
+
+func (p pair) MarshalSyrup(e *Encoder) error {
+	if err := e.EncodeToken(ListStart); err != nil {
+		return err
+	} else if err := e.Encode(p.A); err != nil {
+		return err
+	} else if err := e.Encode(p.B); err != nil {
+		return err
+	}
+	return e.EncodeToken(ListEnd)
+}
+
+func (p *pair) UnmarshalSyrup(d *Decoder) error {
+	if t, err := d.Token(); err != nil {
+		return err
+	} else if t != ListStart {
+		return fmt.Errorf("got %v, want a list", t)
+	}
+	if err := d.Decode(&p.A); err != nil {
+		return err
+	} else if err := d.Decode(&p.B); err != nil {
+		return err
+	}
+	_, err := d.Token()
+	return err
+}
+
+func TestStructTags(t *testing.T) {
+	port := 80
+	tests := []struct {
+		name   string
+		in     taggedStruct
+		expect string
+	}{
+		{"Omitted", taggedStruct{Name: "a", Hidden: "h"}, "{4'name1\"a5\"Plainf}"},
+		{"Present", taggedStruct{Name: "a", Port: &port, Plain: true}, "{4'name1\"a4\"porti80e5\"Plaint}"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := NewEncoder(NewPrototypeEncoding(), &b).Encode(test.in); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if b.String() != test.expect {
+				t.Errorf("got %q, want %q", b.String(), test.expect)
+			}
+			var out taggedStruct
+			if err := NewDecoder(NewPrototypeEncoding(), &b).Decode(&out); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			test.in.Hidden = ""
+			if !reflect.DeepEqual(out, test.in) {
+				t.Errorf("got %+v, want %+v", out, test.in)
+			}
+		})
+	}
+	// Keys of either kind, or of no field, are accepted.
+	var out taggedStruct
+	in := "{4\"namei1e4'porti8e5'Plaint5\"Otherf}"
+	if err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString(in)).Decode(&out); err == nil {
+		t.Errorf("expected error decoding an int into a string field")
+	}
+	out = taggedStruct{}
+	in = "{4\"name1\"b4'porti8ei2ef5'Plaint}"
+	if err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString(in)).Decode(&out); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if out.Name != "b" || out.Port == nil || *out.Port != 8 || !out.Plain {
+		t.Errorf("got %+v", out)
+	}
+	// Fields keyed by symbols are reached by symbol pointer steps.
+	if got, err := (Pointer{Symbol("name")}).Get(out); err != nil || got != "b" {
+		t.Errorf("got %v, %v", got, err)
+	}
+	wantFields := []StructField{
+		{Name: "name", Index: 0, Type: typeOfString, Symbol: true},
+		{Name: "port", Index: 1, Type: reflect.TypeOf(&port), Optional: true},
+		{Name: "Plain", Index: 3, Type: typeOfBool},
+	}
+	if fields := StructFields(reflect.TypeOf(out)); !reflect.DeepEqual(fields, wantFields) {
+		t.Errorf("StructFields: got %+v, want %+v", fields, wantFields)
+	}
+}
+
+func TestLabeler(t *testing.T) {
+	var b bytes.Buffer
+	in := []labeledPoint{{1, 2}, {-3, 4}}
+	if err := NewEncoder(NewPrototypeEncoding(), &b).Encode(in); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expect := "[<5'pointi1ei2e><5'pointi-3ei4e>]"
+	if b.String() != expect {
+		t.Errorf("got %q, want %q", b.String(), expect)
+	}
+	var out []labeledPoint
+	if err := NewDecoder(NewPrototypeEncoding(), &b).Decode(&out); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("got %v, want %v", out, in)
+	}
+	for _, bad := range []string{"<5'otheri1ei2e>", "<5'pointi1e>", "<5'pointi1ei2ei3e>", "{1\"Xi1e}"} {
+		var p labeledPoint
+		err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString(bad)).Decode(&p)
+		var terr *InvalidTypeError
+		if !errors.As(err, &terr) {
+			t.Errorf("%q: got %v, want an *InvalidTypeError", bad, err)
+		}
+	}
+}
+
+func TestGenericRecords(t *testing.T) {
+	var b bytes.Buffer
+	in := []interface{}{
+		Record1[int]{Label: "one", A: 1},
+		Record2[string, []Symbol]{Label: "two", A: "a", B: []Symbol{"b"}},
+		Record3[float64, *int, labeledPoint]{Label: "three", A: 1.5, C: labeledPoint{1, 2}},
+	}
+	e := NewEncoder(NewPrototypeEncoding(), &b)
+	e.SetNilPolicy(NilAsSentinel)
+	for _, v := range in {
+		if err := e.Encode(v); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	expect := "<3'onei1e><3'two1\"a[1'b]><5'threeD?\xf8\x00\x00\x00\x00\x00\x00<4'void><5'pointi1ei2e>>"
+	if b.String() != expect {
+		t.Errorf("got %q, want %q", b.String(), expect)
+	}
+	d := NewDecoder(NewPrototypeEncoding(), &b)
+	d.SetNilSentinel(DefaultNilSentinel())
+	out := []interface{}{
+		new(Record1[int]),
+		new(Record2[string, []Symbol]),
+		&Record3[float64, *int, labeledPoint]{B: new(int)},
+	}
+	for i, v := range out {
+		if err := d.Decode(v); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		if got := reflect.ValueOf(v).Elem().Interface(); !reflect.DeepEqual(got, in[i]) {
+			t.Errorf("got %+v, want %+v", got, in[i])
+		}
+	}
+	for _, bad := range []string{"<3'two1\"a>", "<3'two1\"a[]i1e>", "<3'twoi1e[]>", "[1\"a[]]", "i1e"} {
+		var r Record2[string, []Symbol]
+		err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString(bad)).Decode(&r)
+		var terr *InvalidTypeError
+		if !errors.As(err, &terr) {
+			t.Errorf("%q: got %v, want an *InvalidTypeError", bad, err)
+		}
+	}
+}
+
+func TestMarshaler(t *testing.T) {
+	var b bytes.Buffer
+	in := map[string]interface{}{"p": pair{"ab", "cd"}, "u": []upper{"x"}}
+	e := NewEncoder(NewPrototypeEncoding(), &b)
+	e.SetCanonical(true)
+	if err := e.Encode(in); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expect := "{1\"p[2\"AB2\"CD]1\"u[1\"X]}"
+	if b.String() != expect {
+		t.Errorf("got %q, want %q", b.String(), expect)
+	}
+	var out struct {
+		P *pair   `syrup:"p"`
+		U []upper `syrup:"u"`
+	}
+	if err := NewDecoder(NewPrototypeEncoding(), &b).Decode(&out); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if out.P == nil || *out.P != (pair{"ab", "cd"}) || len(out.U) != 1 || out.U[0] != "x" {
+		t.Errorf("got %+v", out)
+	}
+	// Errors within a Marshaler keep the path to it.
+	err := NewEncoder(NewPrototypeEncoding(), &bytes.Buffer{}).Encode(map[string]interface{}{"k": []interface{}{marshalFunc(func(e *Encoder) error {
+		return e.Encode([]interface{}{make(chan int)})
+	})}})
+	var terr *UnsupportedTypeError
+	if !errors.As(err, &terr) || terr.Path.String() != `/"k"/0/0` {
+		t.Errorf("got %v", err)
+	}
+	// Truncated values are unexpected, even when ending between the
+	// values an Unmarshaler reads.
+	var p pair
+	if err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("[1\"a")).Decode(&p); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+type marshalFunc func(e *Encoder) error
+
+func (f marshalFunc) MarshalSyrup(e *Encoder) error { return f(e) }
+
+func TestTypedEncode(t *testing.T) {
+	for _, enc := range []*Encoding{NewPrototypeEncoding(), NewPreservesEncoding()} {
+		var got, want bytes.Buffer
+		e := NewEncoder(enc, &got)
+		for _, err := range []error{
+			e.EncodeBool(true),
+			e.EncodeInt(-7),
+			e.EncodeUint(math.MaxUint64),
+			e.EncodeFloat32(1.5),
+			e.EncodeFloat64(-2.5),
+			e.EncodeString("s"),
+			e.EncodeBytes([]byte{1}),
+			e.EncodeSymbol("sym"),
+		} {
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+		}
+		w := NewEncoder(enc, &want)
+		for _, v := range []interface{}{true, -7, uint64(math.MaxUint64), float32(1.5), -2.5, "s", []byte{1}, Symbol("sym")} {
+			if err := w.Encode(v); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("got %q, want %q", got.Bytes(), want.Bytes())
+		}
+	}
+	e := NewEncoder(NewPrototypeEncoding(), &bytes.Buffer{})
+	if err := e.EncodeBytes(nil); !errors.Is(err, ErrUnsupportedValue) {
+		t.Errorf("got %v, want ErrUnsupportedValue", err)
+	}
+	var p *int
+	if e.OmitField(&p, false) || !e.OmitField(&p, true) {
+		t.Errorf("expected only an optional nil field to be omitted")
+	}
+	e.SetNilPolicy(NilOmitted)
+	if e.NilPolicy() != NilOmitted || !e.OmitField(&p, false) {
+		t.Errorf("expected a nil field to be omitted")
+	}
+}
+
+func TestTypedDecode(t *testing.T) {
+	d := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("ti-128ei255eF?\xc0\x00\x00D@\x04\x00\x00\x00\x00\x00\x001:b1\"s3'sym"))
+	if b, err := d.DecodeBool(); err != nil || !b {
+		t.Errorf("got %v, %v", b, err)
+	}
+	if i, err := d.DecodeInt(8); err != nil || i != -128 {
+		t.Errorf("got %v, %v", i, err)
+	}
+	if u, err := d.DecodeUint(8); err != nil || u != 255 {
+		t.Errorf("got %v, %v", u, err)
+	}
+	if f, err := d.DecodeFloat(64); err != nil || f != 1.5 {
+		t.Errorf("got %v, %v", f, err)
+	}
+	if f, err := d.DecodeFloat(32); err != nil || f != 2.5 {
+		t.Errorf("got %v, %v", f, err)
+	}
+	if s, err := d.DecodeString(); err != nil || s != "b" {
+		t.Errorf("got %v, %v", s, err)
+	}
+	if b, err := d.DecodeBytes(); err != nil || string(b) != "s" {
+		t.Errorf("got %v, %v", b, err)
+	}
+	if s, err := d.DecodeSymbol(); err != nil || s != "sym" {
+		t.Errorf("got %v, %v", s, err)
+	}
+	if _, err := d.DecodeBool(); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+
+	for _, test := range []struct {
+		in     string
+		decode func(d *Decoder) error
+	}{
+		{"i128e", func(d *Decoder) error { _, err := d.DecodeInt(8); return err }},
+		{"i-1e", func(d *Decoder) error { _, err := d.DecodeUint(64); return err }},
+		{"i18446744073709551616e", func(d *Decoder) error { _, err := d.DecodeUint(64); return err }},
+		{"D\x7f\xef\xff\xff\xff\xff\xff\xff", func(d *Decoder) error { _, err := d.DecodeFloat(32); return err }},
+	} {
+		var oerr *OverflowError
+		var terr *InvalidTypeError
+		if err := test.decode(NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString(test.in))); !errors.As(err, &oerr) && !errors.As(err, &terr) {
+			t.Errorf("%q: got %v, want an overflow", test.in, err)
+		}
+	}
+	// A value of the wrong type is read in full before the error, when it
+	// is a scalar.
+	d = NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("1'a1'b"))
+	var terr *InvalidTypeError
+	if _, err := d.DecodeString(); !errors.As(err, &terr) {
+		t.Errorf("got %v, want an *InvalidTypeError", err)
+	} else if s, err := d.DecodeSymbol(); err != nil || s != "b" {
+		t.Errorf("got %v, %v", s, err)
+	}
+
+	d = NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("{1\"ai1e[{i1e[]}]i2e1'bi3e}i4e"))
+	if tok, err := d.Token(); err != nil || tok != DictStart {
+		t.Fatalf("got %v, %v", tok, err)
+	}
+	var keys []string
+	for {
+		if more, err := d.More(); err != nil {
+			t.Fatalf("got error %v", err)
+		} else if !more {
+			break
+		}
+		key, err := d.DecodeKey()
+		if err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		keys = append(keys, key)
+		if err := d.Skip(); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+	}
+	if expect := []string{"a", "", "b"}; !reflect.DeepEqual(keys, expect) {
+		t.Errorf("got %q, want %q", keys, expect)
+	}
+	if tok, err := d.Token(); err != nil || tok != DictEnd {
+		t.Errorf("got %v, %v", tok, err)
+	}
+	if i, err := d.DecodeInt(0); err != nil || i != 4 {
+		t.Errorf("got %v, %v", i, err)
+	}
+	if err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("[i1e")).Skip(); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+type recursiveNode struct {
+	Name     string
+	Children []recursiveNode
+	Next     *recursiveNode `syrup:",optional"`
+}
+
+func TestRecursiveType(t *testing.T) {
+	in := recursiveNode{
+		Name:     "a",
+		Children: []recursiveNode{{Name: "b", Children: []recursiveNode{}}},
+		Next:     &recursiveNode{Name: "c", Children: []recursiveNode{}},
+	}
+	var b bytes.Buffer
+	if err := NewEncoder(NewPrototypeEncoding(), &b).Encode(in); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	var out recursiveNode
+	if err := NewDecoder(NewPrototypeEncoding(), &b).Decode(&out); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+type benchMessage struct {
+	ID     int64                  `syrup:"id"`
+	From   string                 `syrup:"from,symbol"`
+	To     []string               `syrup:"to"`
+	Body   []byte                 `syrup:"body"`
+	Scores map[string]float64     `syrup:"scores"`
+	Point  labeledPoint           `syrup:"point"`
+	Extra  map[string]interface{} `syrup:"extra,optional"`
+}
+
+func benchValue() benchMessage {
+	return benchMessage{
+		ID:     42,
+		From:   "alice",
+		To:     []string{"bob", "carol"},
+		Body:   []byte("hello"),
+		Scores: map[string]float64{"a": 1, "b": 2},
+		Point:  labeledPoint{X: 1, Y: 2},
+	}
+}
+
+func BenchmarkEncodeStruct(b *testing.B) {
+	v := benchValue()
+	e := NewEncoder(NewPrototypeEncoding(), io.Discard)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := e.Encode(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeStruct(b *testing.B) {
+	var buf bytes.Buffer
+	if err := NewEncoder(NewPrototypeEncoding(), &buf).Encode(benchValue()); err != nil {
+		b.Fatal(err)
+	}
+	in := buf.Bytes()
+	r := bytes.NewReader(in)
+	d := NewDecoder(NewPrototypeEncoding(), r)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(in)
+		var v benchMessage
+		if err := d.Decode(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type operation interface {
+	isOperation()
+}
+
+type deliverOp struct {
+	To   string
+	Body interface{}
+}
+
+func (deliverOp) SyrupLabel() Symbol { return "op:deliver" }
+func (deliverOp) isOperation()       {}
+
+type abortOp struct {
+	Reason string
+}
+
+func (abortOp) SyrupLabel() Symbol { return "op:abort" }
+func (*abortOp) isOperation()      {}
+
+type cancelOp struct {
+	Record1[int64]
+}
+
+func (cancelOp) SyrupLabel() Symbol { return "op:cancel" }
+func (cancelOp) isOperation()       {}
+
+type opStatus Symbol
+
+func (opStatus) isOperation() {}
+func (s opStatus) MarshalSyrup(e *Encoder) error {
+	return e.Encode(Symbol(s))
+}
+
+type envelope struct {
+	Op  operation
+	Ops []operation
+}
+
+func TestUnion(t *testing.T) {
+	RegisterUnion((*operation)(nil), deliverOp{}, &abortOp{}, cancelOp{}, opStatus("done"), opStatus("failed"))
+	in := envelope{
+		Op:  deliverOp{To: "alice", Body: int64(1)},
+		Ops: []operation{&abortOp{Reason: "no"}, nil, deliverOp{To: "bob", Body: Symbol("hi")}, cancelOp{Record1[int64]{Label: "op:cancel", A: 7}}, opStatus("failed")},
+	}
+	var b bytes.Buffer
+	e := NewEncoder(NewPrototypeEncoding(), &b)
+	e.SetNilPolicy(NilAsSentinel)
+	if err := e.Encode(in); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expect := "{2\"Op<10'op:deliver5\"alicei1e>3\"Ops[<8'op:abort2\"no><4'void><10'op:deliver3\"bob2'hi><9'op:canceli7e>6'failed]}"
+	if b.String() != expect {
+		t.Errorf("got %q, want %q", b.String(), expect)
+	}
+	d := NewDecoder(NewPrototypeEncoding(), &b)
+	d.SetNilSentinel(DefaultNilSentinel())
+	var out envelope
+	if err := d.Decode(&out); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+	if got := UnionTypes(reflect.TypeOf((*operation)(nil)).Elem()); !reflect.DeepEqual(got, []reflect.Type{reflect.TypeOf(deliverOp{}), reflect.TypeOf(&abortOp{}), reflect.TypeOf(cancelOp{}), reflect.TypeOf(opStatus(""))}) {
+		t.Errorf("UnionTypes: got %v", got)
+	}
+	if got := UnionLiterals(reflect.TypeOf((*operation)(nil)).Elem()); !reflect.DeepEqual(got, []interface{}{opStatus("done"), opStatus("failed")}) {
+		t.Errorf("UnionLiterals: got %v", got)
+	}
+	for _, bad := range []string{"<8'op:other>", "<8'op:aborti1e>", "2\"Op", "<2\"op>", "4'late", "<>"} {
+		var op operation
+		err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString(bad)).Decode(&op)
+		var terr *InvalidTypeError
+		if !errors.As(err, &terr) {
+			t.Errorf("%q: got %v, want an *InvalidTypeError", bad, err)
+		}
+	}
+	// Errors within a record report offsets in the stream, as when
+	// decoding the implementation directly.
+	bad := "[<8'op:abort2\"no><8'op:aborti1e>]"
+	var ops []operation
+	err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString(bad)).Decode(&ops)
+	var got *InvalidTypeError
+	if !errors.As(err, &got) {
+		t.Fatalf("got %v, want an *InvalidTypeError", err)
+	}
+	var aborts []abortOp
+	err = NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString(bad)).Decode(&aborts)
+	var want *InvalidTypeError
+	if !errors.As(err, &want) {
+		t.Fatalf("got %v, want an *InvalidTypeError", err)
+	}
+	if got.Offset != want.Offset {
+		t.Errorf("got offset %d, want %d", got.Offset, want.Offset)
+	}
+}
+
+func TestRegisterUnionPanics(t *testing.T) {
+	type other struct{ deliverOp }
+	for name, register := range map[string]func(){
+		"not a pointer":   func() { RegisterUnion(operation(nil), deliverOp{}) },
+		"not interface":   func() { RegisterUnion(new(int), deliverOp{}) },
+		"not implemented": func() { RegisterUnion((*operation)(nil), abortOp{}) },
+		"same label":      func() { RegisterUnion((*operation)(nil), deliverOp{}, other{}) },
+		"nil":             func() { RegisterUnion((*operation)(nil), nil) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: RegisterUnion did not panic", name)
+				}
+			}()
+			register()
+		}()
+	}
+}
+
+type promiseStatus uint8
+
+const (
+	promisePending promiseStatus = iota
+	promiseFulfilled
+	promiseBroken
+)
+
+type promise struct {
+	Status promiseStatus
+	Prev   *promiseStatus
+}
+
+var registerEnums sync.Once
+
+// registerTestEnums registers the enumerated types of the tests once, however
+// many times they run.
+func registerTestEnums() {
+	registerEnums.Do(func() {
+		RegisterEnum(map[promiseStatus]Symbol{
+			promisePending:   "pending",
+			promiseFulfilled: "fulfilled",
+			promiseBroken:    "broken",
+		})
+		RegisterEnum(map[twiceStatus]Symbol{0: "a"})
+	})
+}
+
+func TestEnum(t *testing.T) {
+	registerTestEnums()
+	if got, want := EnumSymbols(reflect.TypeOf(promisePending)), []Symbol{"pending", "fulfilled", "broken"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EnumSymbols: got %v, want %v", got, want)
+	}
+	prev := promisePending
+	in := []promise{{Status: promiseBroken, Prev: &prev}, {Status: promiseFulfilled}}
+	var b bytes.Buffer
+	e := NewEncoder(NewPrototypeEncoding(), &b)
+	e.SetNilPolicy(NilAsSentinel)
+	if err := e.Encode(in); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expect := "[{6\"Status6'broken4\"Prev7'pending}{6\"Status9'fulfilled4\"Prev<4'void>}]"
+	if b.String() != expect {
+		t.Errorf("got %q, want %q", b.String(), expect)
+	}
+	d := NewDecoder(NewPrototypeEncoding(), &b)
+	d.SetNilSentinel(DefaultNilSentinel())
+	var out []promise
+	if err := d.Decode(&out); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+
+	// Arrays of enums of kind uint8 are lists of symbols, not bytestrings.
+	arr := [2]promiseStatus{promiseFulfilled, promiseBroken}
+	b.Reset()
+	if err := NewEncoder(NewPrototypeEncoding(), &b).Encode(arr); err != nil {
+		t.Fatalf("got error %v", err)
+	} else if expect := "[9'fulfilled6'broken]"; b.String() != expect {
+		t.Errorf("got %q, want %q", b.String(), expect)
+	}
+	var arrOut [2]promiseStatus
+	if err := NewDecoder(NewPrototypeEncoding(), &b).Decode(&arrOut); err != nil {
+		t.Fatalf("got error %v", err)
+	} else if arrOut != arr {
+		t.Errorf("got %v, want %v", arrOut, arr)
+	}
+
+	if err := NewEncoder(NewPrototypeEncoding(), io.Discard).Encode(promiseStatus(7)); !errors.Is(err, ErrUnsupportedValue) {
+		t.Errorf("got %v, want an *UnsupportedValueError", err)
+	}
+	var s promiseStatus
+	err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("4'lost")).Decode(&s)
+	var eerr *EnumError
+	if !errors.As(err, &eerr) {
+		t.Errorf("got %v, want an *EnumError", err)
+	} else if want := "syrup: cannot decode symbol lost into Go value of type syrup.promiseStatus, whose symbols are pending, fulfilled, broken, at byte offset 6"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	var terr *InvalidTypeError
+	if err := NewDecoder(NewPrototypeEncoding(), bytes.NewBufferString("i1e")).Decode(&s); !errors.As(err, &terr) {
+		t.Errorf("got %v, want an *InvalidTypeError", err)
+	}
+}
+
+type lateStatus int
+
+type twiceStatus int
+
+type selfStatus int
+
+func (selfStatus) MarshalSyrup(e *Encoder) error { return e.EncodeInt(0) }
+
+func TestRegisterEnumPanics(t *testing.T) {
+	registerTestEnums()
+	if err := NewEncoder(NewPrototypeEncoding(), io.Discard).Encode(lateStatus(0)); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	for name, register := range map[string]func(){
+		"late":          func() { RegisterEnum(map[lateStatus]Symbol{0: "a"}) },
+		"marshaler":     func() { RegisterEnum(map[selfStatus]Symbol{0: "a"}) },
+		"twice":         func() { RegisterEnum(map[twiceStatus]Symbol{0: "a"}) },
+		"shared symbol": func() { RegisterEnum(map[int8]Symbol{0: "a", 1: "a"}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: RegisterEnum did not panic", name)
+				}
+			}()
+			register()
+		}()
+	}
+}
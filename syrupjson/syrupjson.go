@@ -0,0 +1,493 @@
+// Package syrupjson losslessly transcodes between Syrup and JSON.
+//
+// Values are streamed token by token in both directions, so neither side is
+// ever held in memory as a whole. Dictionary entries and set elements are
+// written in the order they are read, so converting Syrup to JSON and back
+// reproduces the original bytes whenever the original was itself written in
+// the form the Encoder produces.
+//
+// Booleans, integers, strings, and lists are written as their JSON
+// counterparts, and double precision floats as JSON numbers that always
+// contain a decimal point or exponent. All other values are written as an
+// object with a single tagged key:
+//
+//	{"@f32": 1.5}                  single precision float
+//	{"@f64": "7ff8000000000000"}   non-finite float, as its hex bits
+//	{"@bytes": "aGk="}             bytestring, in standard base64
+//	{"@symbol": "name"}            symbol
+//	{"@set": [...]}                set
+//	{"@record": [label, ...]}      record, the label followed by its values
+//
+// Dictionaries are written as JSON objects. String keys are written as-is,
+// except that keys beginning with '@' gain an extra leading '@'. Any other key
+// is written as '@' followed by its own compact JSON form, so the dictionary
+// {1: "one"} becomes {"@1": "one"}. JSON null has no Syrup counterpart.
+//
+// JSON strings hold only Unicode text, so converting a string or symbol that
+// is not valid UTF-8 to JSON is an error rather than a lossy replacement.
+package syrupjson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cjslep/syrup"
+)
+
+// ToJSON reads the next Syrup value from d and writes it to w as a single
+// line of JSON. It returns io.EOF when there are no more values.
+func ToJSON(w io.Writer, d *syrup.Decoder) error {
+	bw := bufio.NewWriter(w)
+	t, err := d.Token()
+	if err != nil {
+		return err
+	}
+	if err := writeValue(bw, d, t); err != nil {
+		return err
+	}
+	if err := bw.WriteByte('\n'); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// FromJSON reads the next JSON value from d and writes it to e. The
+// json.Decoder must be set to UseNumber, so that integers and floats are not
+// confused. It returns io.EOF when there are no more values.
+func FromJSON(e *syrup.Encoder, d *json.Decoder) error {
+	t, err := d.Token()
+	if err != nil {
+		return err
+	}
+	return readValue(e, d, t)
+}
+
+// SyrupToJSON converts every Syrup value read from r, using the prototype
+// encoding, into a line of JSON written to w.
+func SyrupToJSON(w io.Writer, r io.Reader) error {
+	d := syrup.NewDecoder(syrup.NewPrototypeEncoding(), bufio.NewReader(r))
+	for {
+		if err := ToJSON(w, d); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// JSONToSyrup converts every JSON value read from r into a Syrup value
+// written to w using the prototype encoding. When canonical is set, each value
+// is written in canonical form.
+func JSONToSyrup(w io.Writer, r io.Reader, canonical bool) error {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	bw := bufio.NewWriter(w)
+	e := syrup.NewEncoder(syrup.NewPrototypeEncoding(), bw)
+	e.SetCanonical(canonical)
+	for {
+		if err := FromJSON(e, d); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// writeValue writes the value beginning with token t as JSON.
+func writeValue(w *bufio.Writer, d *syrup.Decoder, t syrup.Token) error {
+	switch x := t.(type) {
+	case syrup.Delim:
+		switch x {
+		case syrup.ListStart:
+			return writeItems(w, d, syrup.ListEnd)
+		case syrup.SetStart:
+			w.WriteString(`{"@set":`)
+			if err := writeItems(w, d, syrup.SetEnd); err != nil {
+				return err
+			}
+			return w.WriteByte('}')
+		case syrup.RecordStart:
+			w.WriteString(`{"@record":`)
+			if err := writeItems(w, d, syrup.RecordEnd); err != nil {
+				return err
+			}
+			return w.WriteByte('}')
+		case syrup.DictStart:
+			return writeDict(w, d)
+		}
+		return fmt.Errorf("syrupjson: unexpected %v", x)
+	case bool:
+		_, err := w.WriteString(strconv.FormatBool(x))
+		return err
+	case int64:
+		_, err := w.WriteString(strconv.FormatInt(x, 10))
+		return err
+	case *big.Int:
+		_, err := w.WriteString(x.String())
+		return err
+	case float64:
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			b := make([]byte, 8)
+			binary.BigEndian.PutUint64(b, math.Float64bits(x))
+			return writeTagged(w, "@f64", hex.EncodeToString(b))
+		}
+		_, err := w.WriteString(formatFloat(x, 64))
+		return err
+	case float32:
+		if math.IsInf(float64(x), 0) || math.IsNaN(float64(x)) {
+			b := make([]byte, 4)
+			binary.BigEndian.PutUint32(b, math.Float32bits(x))
+			return writeTagged(w, "@f32", hex.EncodeToString(b))
+		}
+		w.WriteString(`{"@f32":`)
+		w.WriteString(formatFloat(float64(x), 32))
+		return w.WriteByte('}')
+	case string:
+		return writeString(w, x)
+	case []byte:
+		return writeTagged(w, "@bytes", base64.StdEncoding.EncodeToString(x))
+	case syrup.Symbol:
+		return writeTagged(w, "@symbol", string(x))
+	default:
+		return fmt.Errorf("syrupjson: cannot convert %T to JSON", t)
+	}
+}
+
+// next returns the next token inside a compound value, where the stream
+// ending is unexpected.
+func next(d *syrup.Decoder) (syrup.Token, error) {
+	t, err := d.Token()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return t, err
+}
+
+// writeItems writes the items of a list, set, or record as a JSON array.
+func writeItems(w *bufio.Writer, d *syrup.Decoder, end syrup.Delim) error {
+	w.WriteByte('[')
+	for first := true; ; first = false {
+		t, err := next(d)
+		if err != nil {
+			return err
+		} else if t == end {
+			break
+		}
+		if !first {
+			w.WriteByte(',')
+		}
+		if err := writeValue(w, d, t); err != nil {
+			return err
+		}
+	}
+	return w.WriteByte(']')
+}
+
+func writeDict(w *bufio.Writer, d *syrup.Decoder) error {
+	w.WriteByte('{')
+	for first := true; ; first = false {
+		t, err := next(d)
+		if err != nil {
+			return err
+		} else if t == syrup.DictEnd {
+			break
+		}
+		if !first {
+			w.WriteByte(',')
+		}
+		var key string
+		if s, ok := t.(string); ok {
+			key = s
+			if strings.HasPrefix(s, "@") {
+				key = "@" + s
+			}
+		} else {
+			// Other keys are written into their own buffer, so they
+			// may be quoted as a JSON string.
+			var buf bytes.Buffer
+			kw := bufio.NewWriter(&buf)
+			if err := writeValue(kw, d, t); err != nil {
+				return err
+			}
+			if err := kw.Flush(); err != nil {
+				return err
+			}
+			key = "@" + buf.String()
+		}
+		if err := writeString(w, key); err != nil {
+			return err
+		}
+		w.WriteByte(':')
+		if t, err = next(d); err != nil {
+			return err
+		} else if t == syrup.DictEnd {
+			return fmt.Errorf("syrupjson: dictionary key %s has no value", key)
+		}
+		if err := writeValue(w, d, t); err != nil {
+			return err
+		}
+	}
+	return w.WriteByte('}')
+}
+
+func writeTagged(w *bufio.Writer, tag, s string) error {
+	w.WriteString(`{"` + tag + `":`)
+	if err := writeString(w, s); err != nil {
+		return err
+	}
+	return w.WriteByte('}')
+}
+
+func writeString(w *bufio.Writer, s string) error {
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("syrupjson: cannot convert %q to JSON, as it is not valid UTF-8", s)
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// formatFloat formats a float so that it is always read back as a float rather
+// than an integer.
+func formatFloat(f float64, bitSize int) string {
+	s := strconv.FormatFloat(f, 'g', -1, bitSize)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+var tags = map[string]bool{
+	"@f32":    true,
+	"@f64":    true,
+	"@bytes":  true,
+	"@symbol": true,
+	"@set":    true,
+	"@record": true,
+}
+
+// readValue writes the JSON value beginning with token t as Syrup.
+func readValue(e *syrup.Encoder, d *json.Decoder, t json.Token) error {
+	switch x := t.(type) {
+	case json.Delim:
+		switch x {
+		case '[':
+			return readItems(e, d, syrup.ListStart, syrup.ListEnd)
+		case '{':
+			return readObject(e, d)
+		}
+		return fmt.Errorf("syrupjson: unexpected %v", x)
+	case bool, string:
+		return e.Encode(x)
+	case json.Number:
+		v, err := parseNumber(string(x))
+		if err != nil {
+			return err
+		}
+		return e.Encode(v)
+	case nil:
+		return fmt.Errorf("syrupjson: JSON null has no Syrup equivalent")
+	default:
+		return fmt.Errorf("syrupjson: unexpected JSON token %T", t)
+	}
+}
+
+// nextJSON returns the next token inside a JSON array or object, where the
+// stream ending is unexpected.
+func nextJSON(d *json.Decoder) (json.Token, error) {
+	t, err := d.Token()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return t, err
+}
+
+// readItems writes the remaining items of a JSON array as a compound value.
+func readItems(e *syrup.Encoder, d *json.Decoder, start, end syrup.Delim) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for d.More() {
+		t, err := nextJSON(d)
+		if err != nil {
+			return err
+		}
+		if err := readValue(e, d, t); err != nil {
+			return err
+		}
+	}
+	if _, err := nextJSON(d); err != nil {
+		return err
+	}
+	return e.EncodeToken(end)
+}
+
+// readObject writes the remainder of a JSON object, which is either a tagged
+// value or a dictionary.
+func readObject(e *syrup.Encoder, d *json.Decoder) error {
+	if !d.More() {
+		if _, err := nextJSON(d); err != nil {
+			return err
+		}
+		if err := e.EncodeToken(syrup.DictStart); err != nil {
+			return err
+		}
+		return e.EncodeToken(syrup.DictEnd)
+	}
+	t, err := nextJSON(d)
+	if err != nil {
+		return err
+	}
+	key := t.(string)
+	if tags[key] {
+		if err := readTagged(e, d, key); err != nil {
+			return err
+		}
+		if d.More() {
+			return fmt.Errorf("syrupjson: %s value has more than one key", key)
+		}
+		_, err := nextJSON(d)
+		return err
+	}
+	if err := e.EncodeToken(syrup.DictStart); err != nil {
+		return err
+	}
+	for {
+		if err := readKey(e, key); err != nil {
+			return err
+		}
+		if t, err = nextJSON(d); err != nil {
+			return err
+		}
+		if err := readValue(e, d, t); err != nil {
+			return err
+		}
+		if !d.More() {
+			break
+		}
+		if t, err = nextJSON(d); err != nil {
+			return err
+		}
+		key = t.(string)
+	}
+	if _, err := nextJSON(d); err != nil {
+		return err
+	}
+	return e.EncodeToken(syrup.DictEnd)
+}
+
+func readTagged(e *syrup.Encoder, d *json.Decoder, tag string) error {
+	t, err := nextJSON(d)
+	if err != nil {
+		return err
+	}
+	malformed := fmt.Errorf("syrupjson: malformed %s value", tag)
+	switch tag {
+	case "@f32", "@f64":
+		bitSize := 64
+		if tag == "@f32" {
+			bitSize = 32
+		}
+		var f float64
+		switch x := t.(type) {
+		case json.Number:
+			if f, err = strconv.ParseFloat(string(x), bitSize); err != nil {
+				return err
+			}
+		case string:
+			b, err := hex.DecodeString(x)
+			if err != nil {
+				return err
+			} else if len(b) != bitSize/8 {
+				return fmt.Errorf("syrupjson: %s expected %d bytes, got %d", tag, bitSize/8, len(b))
+			}
+			if bitSize == 32 {
+				return e.Encode(math.Float32frombits(binary.BigEndian.Uint32(b)))
+			}
+			return e.Encode(math.Float64frombits(binary.BigEndian.Uint64(b)))
+		default:
+			return malformed
+		}
+		if bitSize == 32 {
+			return e.Encode(float32(f))
+		}
+		return e.Encode(f)
+	case "@bytes":
+		s, ok := t.(string)
+		if !ok {
+			return malformed
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return err
+		}
+		return e.Encode(b)
+	case "@symbol":
+		s, ok := t.(string)
+		if !ok {
+			return malformed
+		}
+		return e.Encode(syrup.Symbol(s))
+	case "@set":
+		if t != json.Delim('[') {
+			return malformed
+		}
+		return readItems(e, d, syrup.SetStart, syrup.SetEnd)
+	case "@record":
+		if t != json.Delim('[') || !d.More() {
+			return malformed
+		}
+		return readItems(e, d, syrup.RecordStart, syrup.RecordEnd)
+	}
+	return malformed
+}
+
+// readKey writes a dictionary key from its JSON object key.
+func readKey(e *syrup.Encoder, k string) error {
+	if !strings.HasPrefix(k, "@") {
+		return e.Encode(k)
+	} else if strings.HasPrefix(k, "@@") {
+		return e.Encode(k[1:])
+	}
+	d := json.NewDecoder(strings.NewReader(k[1:]))
+	d.UseNumber()
+	if err := FromJSON(e, d); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("syrupjson: malformed dictionary key %q: %w", k, err)
+	} else if d.More() {
+		return fmt.Errorf("syrupjson: malformed dictionary key %q", k)
+	}
+	return nil
+}
+
+// parseNumber converts a number into an integer when it has no fraction or
+// exponent, and otherwise into a float.
+func parseNumber(s string) (interface{}, error) {
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		if bi, ok := new(big.Int).SetString(s, 10); ok {
+			return bi, nil
+		}
+		return nil, fmt.Errorf("syrupjson: malformed integer %s", s)
+	}
+	return strconv.ParseFloat(s, 64)
+}
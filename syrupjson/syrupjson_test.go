@@ -0,0 +1,94 @@
+package syrupjson
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		json string
+	}{
+		{"Bool", "t", "true"},
+		{"Int", "i-42e", "-42"},
+		{"BigInt", "i92233720368547758070e", "92233720368547758070"},
+		{"Float64", "D\x3f\xf8\x00\x00\x00\x00\x00\x00", "1.5"},
+		{"Whole Float64", "D\x40\x00\x00\x00\x00\x00\x00\x00", "2.0"},
+		{"Float32", "F\x3f\xc0\x00\x00", `{"@f32":1.5}`},
+		{"NaN", "D\x7f\xf8\x00\x00\x00\x00\x00\x01", `{"@f64":"7ff8000000000001"}`},
+		{"String", "2\"hi", `"hi"`},
+		{"Bytes", "3:abc", `{"@bytes":"YWJj"}`},
+		{"Symbol", "3'sym", `{"@symbol":"sym"}`},
+		{"List", "[i1e[]0\"]", `[1,[],""]`},
+		{"Set", "#i2ei1e$", `{"@set":[2,1]}`},
+		{"Record", "<2'opi1e>", `{"@record":[{"@symbol":"op"},1]}`},
+		{"Empty dictionary", "{}", "{}"},
+		{"Unsorted dictionary", "{1\"bi2e1\"ai1e}", `{"b":2,"a":1}`},
+		{"Tag-like keys", "{4\"@set[]1\"@t}", `{"@@set":[],"@@":true}`},
+		{"Compound keys", "{[i1e]1\"a<1'pi1e>f}", `{"@[1]":"a","@{\"@record\":[{\"@symbol\":\"p\"},1]}":false}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var js bytes.Buffer
+			if err := SyrupToJSON(&js, strings.NewReader(test.in)); err != nil {
+				t.Fatalf("to JSON: got error %v", err)
+			}
+			if got := strings.TrimSuffix(js.String(), "\n"); got != test.json {
+				t.Errorf("to JSON: got %s, want %s", got, test.json)
+			}
+			var out bytes.Buffer
+			if err := JSONToSyrup(&out, &js, false); err != nil {
+				t.Fatalf("from JSON: got error %v", err)
+			}
+			if out.String() != test.in {
+				t.Errorf("from JSON: got %q, want %q", out.String(), test.in)
+			}
+		})
+	}
+}
+
+func TestJSONToSyrupCanonical(t *testing.T) {
+	var out bytes.Buffer
+	if err := JSONToSyrup(&out, strings.NewReader(`{"b":{"@set":[2,1]},"a":1}`), true); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	expect := "{1\"ai1e1\"b#i1ei2e$}"
+	if out.String() != expect {
+		t.Errorf("got %q, want %q", out.String(), expect)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	t.Run("Syrup", func(t *testing.T) {
+		for _, in := range []string{
+			"[i1e",
+			"{1\"a}",
+			"i1x",
+			"2\"\xff\xfe",
+			"2'\xff\xfe",
+			"{2\"\xff\xfei1e}",
+		} {
+			if err := SyrupToJSON(&bytes.Buffer{}, strings.NewReader(in)); err == nil {
+				t.Errorf("%q: expected error", in)
+			}
+		}
+	})
+	t.Run("JSON", func(t *testing.T) {
+		for _, in := range []string{
+			"null",
+			"[1",
+			`{"@record":[]}`,
+			`{"@symbol":1}`,
+			`{"@f32":"00"}`,
+			`{"@set":[],"a":1}`,
+			`{"@x":1}`,
+		} {
+			if err := JSONToSyrup(&bytes.Buffer{}, strings.NewReader(in), false); err == nil {
+				t.Errorf("%s: expected error", in)
+			}
+		}
+	})
+}
@@ -0,0 +1,532 @@
+package syrup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// TextDecoder reads values written in the Preserves text syntax, the form
+// written by Printer. Values are read into the same representation the Decoder
+// uses, so text may be converted to Syrup without loss.
+//
+// Commas are treated as whitespace, comments run from ';' to the end of the
+// line, and annotations written as '@' followed by a value are discarded.
+// Embedded values are not supported.
+type TextDecoder struct {
+	r *bufio.Reader
+	n uint64
+}
+
+// NewTextDecoder creates a decoder reading Preserves text from 'r'.
+func NewTextDecoder(r io.Reader) *TextDecoder {
+	return &TextDecoder{r: bufio.NewReader(r)}
+}
+
+// ParseText parses the single value in s, written in the Preserves text
+// syntax.
+func ParseText(s string) (interface{}, error) {
+	d := NewTextDecoder(strings.NewReader(s))
+	var v interface{}
+	if err := d.Decode(&v); err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+	if err := d.skipSpace(); err == nil {
+		return nil, d.syntaxError("unexpected text after value")
+	} else if err != io.EOF {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Decode reads the next value and stores it in the value pointed to by v, as
+// if the value were encoded and then decoded by a Decoder. It returns io.EOF
+// once the text ends before any further value begins.
+func (d *TextDecoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &InvalidDecodeError{reflect.TypeOf(v)}
+	}
+	if err := d.skipSpace(); err != nil {
+		return err
+	}
+	x, err := d.value()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+	if iv, ok := v.(*interface{}); ok {
+		*iv = x
+		return nil
+	}
+	enc := NewPrototypeEncoding()
+	var buf bytes.Buffer
+	if err := NewEncoder(enc, &buf).Encode(x); err != nil {
+		return err
+	}
+	return NewDecoder(enc, &buf).Decode(v)
+}
+
+// TextSyntaxError describes malformed Preserves text.
+type TextSyntaxError struct {
+	Msg string
+	// Offset is the number of bytes read before the error was detected.
+	Offset uint64
+}
+
+func (e *TextSyntaxError) Error() string {
+	return fmt.Sprintf("syrup text syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+func (d *TextDecoder) syntaxError(format string, args ...interface{}) error {
+	return &TextSyntaxError{Msg: fmt.Sprintf(format, args...), Offset: d.n}
+}
+
+func (d *TextDecoder) readByte() (byte, error) {
+	c, err := d.r.ReadByte()
+	if err == nil {
+		d.n++
+	}
+	return c, err
+}
+
+func (d *TextDecoder) unreadByte() {
+	// Only ever called directly after a successful readByte.
+	_ = d.r.UnreadByte()
+	d.n--
+}
+
+func (d *TextDecoder) peekByte() (byte, error) {
+	c, err := d.readByte()
+	if err == nil {
+		d.unreadByte()
+	}
+	return c, err
+}
+
+func (d *TextDecoder) expect(want byte) error {
+	c, err := d.readByte()
+	if err != nil {
+		return err
+	} else if c != want {
+		return d.syntaxError("expected %q, got %q", want, c)
+	}
+	return nil
+}
+
+func isTextSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == ','
+}
+
+// skipSpace skips whitespace, comments, and annotations, leaving the reader at
+// the start of the next value or delimiter.
+func (d *TextDecoder) skipSpace() error {
+	for {
+		c, err := d.readByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case isTextSpace(c):
+		case c == ';':
+			if _, err := d.r.ReadString('\n'); err != nil && err != io.EOF {
+				return err
+			}
+		case c == '@':
+			if err := d.skipSpace(); err == io.EOF {
+				return io.ErrUnexpectedEOF
+			} else if err != nil {
+				return err
+			}
+			if _, err := d.value(); err != nil {
+				return err
+			}
+		default:
+			d.unreadByte()
+			return nil
+		}
+	}
+}
+
+// value reads the value starting at the next byte.
+func (d *TextDecoder) value() (interface{}, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	switch c {
+	case '"':
+		return d.quoted('"')
+	case '|':
+		s, err := d.quoted('|')
+		return Symbol(s), err
+	case '<':
+		vs, err := d.sequence('>')
+		if err != nil {
+			return nil, err
+		} else if len(vs) == 0 {
+			return nil, d.syntaxError("record has no label")
+		}
+		return Record{Label: vs[0], Values: vs[1:]}, nil
+	case '[':
+		vs, err := d.sequence(']')
+		if err != nil {
+			return nil, err
+		} else if vs == nil {
+			vs = []interface{}{}
+		}
+		return vs, nil
+	case '{':
+		return d.dict()
+	case '#':
+		return d.hashed()
+	case '>', ']', '}', ':':
+		return nil, d.syntaxError("unexpected %q", c)
+	}
+	d.unreadByte()
+	return d.atom()
+}
+
+// sequence reads values until the closing delimiter.
+func (d *TextDecoder) sequence(end byte) ([]interface{}, error) {
+	var vs []interface{}
+	for {
+		if err := d.skipSpace(); err != nil {
+			return nil, err
+		}
+		if c, err := d.peekByte(); err != nil {
+			return nil, err
+		} else if c == end {
+			d.readByte()
+			return vs, nil
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+}
+
+func (d *TextDecoder) dict() (interface{}, error) {
+	m := make(map[interface{}]interface{})
+	for {
+		if err := d.skipSpace(); err != nil {
+			return nil, err
+		}
+		if c, err := d.peekByte(); err != nil {
+			return nil, err
+		} else if c == '}' {
+			d.readByte()
+			return m, nil
+		}
+		k, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		if err := d.skipSpace(); err != nil {
+			return nil, err
+		}
+		if err := d.expect(':'); err != nil {
+			return nil, err
+		}
+		if err := d.skipSpace(); err != nil {
+			return nil, err
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.TypeOf(k).Comparable() {
+			return nil, d.syntaxError("unsupported dictionary key %T", k)
+		} else if _, ok := m[k]; ok {
+			return nil, d.syntaxError("duplicate dictionary key %v", k)
+		}
+		m[k] = v
+	}
+}
+
+// hashed reads the value following a '#'.
+func (d *TextDecoder) hashed() (interface{}, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	switch c {
+	case 't':
+		return true, nil
+	case 'f':
+		return false, nil
+	case '{':
+		vs, err := d.sequence('}')
+		if err != nil {
+			return nil, err
+		} else if vs == nil {
+			vs = Set{}
+		}
+		return Set(vs), nil
+	case '"':
+		return d.quotedBytes()
+	case '[':
+		s, err := d.delimited(']')
+		if err != nil {
+			return nil, err
+		}
+		s = strings.TrimRight(s, "=")
+		s = strings.NewReplacer("-", "+", "_", "/").Replace(s)
+		b, err := base64.RawStdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, d.syntaxError("malformed base64 bytestring: %v", err)
+		}
+		return b, nil
+	case 'x':
+		return d.hexed()
+	case '!':
+		return nil, d.syntaxError("embedded values are not supported")
+	}
+	return nil, d.syntaxError("unexpected %q after '#'", c)
+}
+
+// hexed reads the hexadecimal forms of bytestrings and floats following '#x'.
+func (d *TextDecoder) hexed() (interface{}, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	width := 0
+	switch c {
+	case 'f':
+		width = 4
+	case 'd':
+		width = 8
+	case '"':
+		d.unreadByte()
+	default:
+		return nil, d.syntaxError("unexpected %q after '#x'", c)
+	}
+	if err := d.expect('"'); err != nil {
+		return nil, err
+	}
+	s, err := d.delimited('"')
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, d.syntaxError("malformed hexadecimal: %v", err)
+	}
+	switch {
+	case width == 0:
+		return b, nil
+	case len(b) != width:
+		return nil, d.syntaxError("expected %d bytes of float, got %d", width, len(b))
+	case width == 4:
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	default:
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	}
+}
+
+// delimited reads the text up to the closing delimiter, dropping whitespace.
+func (d *TextDecoder) delimited(end byte) (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := d.readByte()
+		if err != nil {
+			return "", err
+		} else if c == end {
+			return sb.String(), nil
+		} else if c == ',' || !isTextSpace(c) {
+			// Commas are not whitespace here, and are rejected
+			// as malformed.
+			sb.WriteByte(c)
+		}
+	}
+}
+
+// quoted reads the remainder of a string or quoted symbol.
+func (d *TextDecoder) quoted(end byte) (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := d.readByte()
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case end:
+			if !utf8.ValidString(sb.String()) {
+				return "", d.syntaxError("invalid UTF-8")
+			}
+			return sb.String(), nil
+		case '\\':
+			if err := d.escape(&sb, end, false); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
+
+func (d *TextDecoder) quotedBytes() ([]byte, error) {
+	var sb strings.Builder
+	for {
+		c, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case c == '"':
+			return []byte(sb.String()), nil
+		case c == '\\':
+			if err := d.escape(&sb, '"', true); err != nil {
+				return nil, err
+			}
+		case c < 0x20 || c >= 0x7f:
+			return nil, d.syntaxError("bytestring contains byte %#x, which must be escaped", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
+
+// escape reads the escape sequence after a '\'. Bytestrings take \xHH
+// escapes, while strings and symbols take \uHHHH escapes.
+func (d *TextDecoder) escape(sb *strings.Builder, end byte, bytestring bool) error {
+	c, err := d.readByte()
+	if err != nil {
+		return err
+	}
+	switch c {
+	case end, '\\', '/':
+		sb.WriteByte(c)
+	case 'b':
+		sb.WriteByte('\b')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'r':
+		sb.WriteByte('\r')
+	case 't':
+		sb.WriteByte('\t')
+	case 'x':
+		if !bytestring {
+			return d.syntaxError(`\x escape outside of a bytestring`)
+		}
+		h, err := d.hexDigits(2)
+		if err != nil {
+			return err
+		}
+		sb.WriteByte(byte(h))
+	case 'u':
+		if bytestring {
+			return d.syntaxError(`\u escape inside a bytestring`)
+		}
+		r, err := d.hexDigits(4)
+		if err != nil {
+			return err
+		}
+		if utf16.IsSurrogate(rune(r)) {
+			// The low half of a surrogate pair must follow.
+			if err := d.expect('\\'); err != nil {
+				return err
+			}
+			if err := d.expect('u'); err != nil {
+				return err
+			}
+			r2, err := d.hexDigits(4)
+			if err != nil {
+				return err
+			}
+			r = uint64(utf16.DecodeRune(rune(r), rune(r2)))
+			if r == utf8.RuneError {
+				return d.syntaxError("invalid surrogate pair")
+			}
+		}
+		sb.WriteRune(rune(r))
+	default:
+		return d.syntaxError("unknown escape %q", c)
+	}
+	return nil
+}
+
+func (d *TextDecoder) hexDigits(n int) (uint64, error) {
+	b := make([]byte, n)
+	for i := range b {
+		c, err := d.readByte()
+		if err != nil {
+			return 0, err
+		}
+		b[i] = c
+	}
+	h, err := strconv.ParseUint(string(b), 16, 64)
+	if err != nil {
+		return 0, d.syntaxError("malformed escape %q", b)
+	}
+	return h, nil
+}
+
+var textNumber = regexp.MustCompile(`^[-+]?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?[fF]?$`)
+
+// atom reads a bare symbol or number.
+func (d *TextDecoder) atom() (interface{}, error) {
+	var sb strings.Builder
+	for {
+		r, _, err := d.r.ReadRune()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if !isSymbolRune(r) {
+			d.r.UnreadRune()
+			break
+		}
+		d.n += uint64(utf8.RuneLen(r))
+		sb.WriteRune(r)
+	}
+	s := sb.String()
+	if len(s) == 0 {
+		r, _, _ := d.r.ReadRune()
+		return nil, d.syntaxError("unexpected %q", r)
+	} else if !looksNumeric(s) {
+		return Symbol(s), nil
+	} else if !textNumber.MatchString(s) {
+		return nil, d.syntaxError("malformed number %s", s)
+	}
+	switch last := s[len(s)-1]; {
+	case last == 'f' || last == 'F':
+		f, err := strconv.ParseFloat(s[:len(s)-1], 32)
+		if err != nil {
+			return nil, d.syntaxError("malformed float %s", s)
+		}
+		return float32(f), nil
+	case strings.ContainsAny(s, ".eE"):
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, d.syntaxError("malformed double %s", s)
+		}
+		return f, nil
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	bi, _ := new(big.Int).SetString(s, 10)
+	return bi, nil
+}
@@ -0,0 +1,187 @@
+package syrup
+
+import (
+	"fmt"
+	"io"
+)
+
+// Token holds a value returned by Decoder.Token or given to
+// Encoder.EncodeToken. It is either a Delim marking the start or end of a
+// compound value, or a scalar value: a bool, int64, *big.Int, float32,
+// float64, []byte, string, Symbol, or a value of an Encoding's Extension.
+type Token interface{}
+
+// Delim is a Token marking the start or end of a list, dictionary, set, or
+// record.
+type Delim uint8
+
+const (
+	ListStart Delim = iota + 1
+	ListEnd
+	DictStart
+	DictEnd
+	SetStart
+	SetEnd
+	RecordStart
+	RecordEnd
+)
+
+func (d Delim) String() string {
+	switch d {
+	case ListStart:
+		return "ListStart"
+	case ListEnd:
+		return "ListEnd"
+	case DictStart:
+		return "DictStart"
+	case DictEnd:
+		return "DictEnd"
+	case SetStart:
+		return "SetStart"
+	case SetEnd:
+		return "SetEnd"
+	case RecordStart:
+		return "RecordStart"
+	case RecordEnd:
+		return "RecordEnd"
+	default:
+		return fmt.Sprintf("Delim(%d)", uint8(d))
+	}
+}
+
+var delimOps = map[op]Delim{
+	openListOp:    ListStart,
+	closeListOp:   ListEnd,
+	openDictOp:    DictStart,
+	closeDictOp:   DictEnd,
+	openSetOp:     SetStart,
+	closeSetOp:    SetEnd,
+	openRecordOp:  RecordStart,
+	closeRecordOp: RecordEnd,
+}
+
+var opDelims = map[Delim]op{
+	ListStart:   openListOp,
+	ListEnd:     closeListOp,
+	DictStart:   openDictOp,
+	DictEnd:     closeDictOp,
+	SetStart:    openSetOp,
+	SetEnd:      closeSetOp,
+	RecordStart: openRecordOp,
+	RecordEnd:   closeRecordOp,
+}
+
+// Token returns the next Token in the stream, which allows processing a
+// stream without decoding whole values into memory. It may be freely mixed
+// with calls to Decode, which decodes the next whole value.
+//
+// Token returns io.EOF when the stream ends between tokens, and
+// io.ErrUnexpectedEOF when it ends partway through one. It does not check
+// that Delims are balanced.
+func (d *Decoder) Token() (Token, error) {
+	oper, err := d.nextOp()
+	if err != nil {
+		return nil, err
+	}
+	return d.token(oper)
+}
+
+// More reports whether another element or entry follows within the compound
+// value being read, rather than the Delim ending it. Neither is consumed, so
+// it is read by the next call to Token or Decode.
+func (d *Decoder) More() (bool, error) {
+	if d.pending == noop {
+		oper, err := d.nextOp()
+		if err != nil {
+			return false, err
+		}
+		d.pending = oper
+	}
+	return !isCloseOp(d.pending), nil
+}
+
+// nextOp reads from the stream until the scanner has a complete op.
+func (d *Decoder) nextOp() (op, error) {
+	if d.pending != noop {
+		oper := d.pending
+		d.pending = noop
+		return oper, nil
+	}
+	for {
+		n, err := d.r.Read(d.buf[:])
+		if n == 1 {
+			oper, err := d.s.Process(d.buf[0])
+			if err != nil {
+				return noop, err
+			}
+			if oper != noop {
+				return oper, nil
+			}
+			d.n++
+			continue
+		}
+		if err == io.EOF && d.s.s != scanFindToken {
+			return noop, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return noop, err
+		}
+	}
+}
+
+func (d *Decoder) token(oper op) (Token, error) {
+	if delim, ok := delimOps[oper]; ok {
+		return delim, nil
+	}
+	switch oper {
+	case valBoolop:
+		return d.s.Bool()
+	case valByteArrOp:
+		return d.s.Bytes()
+	case valSymbolOp:
+		return d.s.Symbol()
+	case valStringOp:
+		return d.s.String()
+	case valIntOp:
+		i, bi, err := d.s.Int64()
+		if err != nil {
+			return nil, err
+		} else if bi != nil {
+			return bi, nil
+		}
+		return i, nil
+	case valFloat32Op:
+		return d.s.Float32()
+	case valFloat64Op:
+		return d.s.Float64()
+	case valExtensionOp:
+		return d.s.Extension()
+	default:
+		return nil, fmt.Errorf("syrup unknown op: %v", oper)
+	}
+}
+
+// EncodeToken writes the Token to the Encoder's writer. Scalar tokens are
+// encoded as if given to Encode, and may be freely mixed with calls to Encode
+// for whole values. It is an error to end a compound value that was not the
+// most recently started one.
+//
+// When encoding canonically, the entries of a dictionary or set are buffered
+// until the Delim ending it, when they are sorted and written.
+func (e *Encoder) EncodeToken(t Token) error {
+	delim, ok := t.(Delim)
+	if !ok {
+		return e.Encode(t)
+	}
+	oper, ok := opDelims[delim]
+	if !ok {
+		return fmt.Errorf("syrup: unknown delimiter %v", delim)
+	}
+	switch delim {
+	case ListStart, DictStart, SetStart, RecordStart:
+		return e.open(oper)
+	}
+	if len(e.frames) == 0 || delimOps[e.frames[len(e.frames)-1].oper]+1 != delim {
+		return fmt.Errorf("syrup: %v does not end the most recently started value", delim)
+	}
+	return e.close(oper)
+}
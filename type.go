@@ -2,34 +2,70 @@ package syrup
 
 import (
 	"reflect"
+	"strings"
 	"sync"
 )
 
 type structMetadata struct {
 	fields          []field
 	fieldNamesIndex map[string]int
+	// record is set for structs implementing Labeler, which are encoded
+	// as records of their fields rather than dictionaries.
+	record bool
 }
 
 type field struct {
 	name     string
 	fieldIdx int
 	t        reflect.Type
+	// optional fields are omitted from dictionaries when they hold their
+	// zero value.
+	optional bool
+	// symbol fields are keyed by a symbol rather than a string.
+	symbol bool
 }
 
+// buildMetadata determines the fields of a struct type. The name of a field is
+// taken from its `syrup` struct tag when present, which may be followed by
+// comma separated options:
+//
+//   - optional omits the field from a dictionary when it holds its zero value
+//   - symbol keys the field by a symbol rather than a string
+//
+// A field tagged "-" is skipped.
 func buildMetadata(t reflect.Type) (m structMetadata) {
 	m.fieldNamesIndex = make(map[string]int, 0)
+	m.record = reflect.PtrTo(t).Implements(typeOfLabeler)
 	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
 		public := f.PkgPath == ""
 		if !public {
 			continue
 		}
-		m.fieldNamesIndex[f.Name] = len(m.fields)
-		m.fields = append(m.fields, field{
+		fd := field{
 			name:     f.Name,
 			fieldIdx: i,
 			t:        f.Type,
-		})
+		}
+		if tag, ok := f.Tag.Lookup(kSyrupStructTag); ok {
+			if tag == "-" {
+				continue
+			}
+			opts := strings.Split(tag, ",")
+			if opts[0] != "" {
+				fd.name = opts[0]
+			}
+			for _, opt := range opts[1:] {
+				switch opt {
+				case "optional":
+					fd.optional = true
+				case "symbol":
+					fd.symbol = true
+				}
+			}
+		}
+		m.fieldNamesIndex[fd.name] = len(m.fields)
+		m.fields = append(m.fields, fd)
 	}
 	return m
 }
@@ -46,3 +82,41 @@ func buildCachedMetadata(t reflect.Type) (m structMetadata) {
 	m = i.(structMetadata)
 	return
 }
+
+// StructField describes how a field of a struct type is encoded, as
+// determined by its `syrup` struct tag.
+type StructField struct {
+	// Name is the key of the field in a dictionary.
+	Name string
+	// Index is the index of the field in the struct, as given to
+	// reflect.Value.Field.
+	Index int
+	Type  reflect.Type
+	// Optional fields are omitted from dictionaries when they hold their
+	// zero value.
+	Optional bool
+	// Symbol fields are keyed by a symbol rather than a string.
+	Symbol bool
+}
+
+// StructFields returns the fields of the struct type t that are encoded, in
+// the order they are encoded. A struct implementing Labeler is encoded as a
+// record holding their values, and otherwise as a dictionary of them. It
+// panics if t is not a struct type.
+func StructFields(t reflect.Type) []StructField {
+	if t.Kind() != reflect.Struct {
+		panic("syrup: StructFields of non-struct type " + t.String())
+	}
+	m := buildCachedMetadata(t)
+	fields := make([]StructField, len(m.fields))
+	for i, f := range m.fields {
+		fields[i] = StructField{
+			Name:     f.name,
+			Index:    f.fieldIdx,
+			Type:     f.t,
+			Optional: f.optional,
+			Symbol:   f.symbol,
+		}
+	}
+	return fields
+}
@@ -0,0 +1,245 @@
+package syrup
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// union holds the registered implementations of an interface type.
+type union struct {
+	types    []reflect.Type
+	labels   map[Symbol]reflect.Type
+	literals []unionLiteral
+}
+
+// unionLiteral is an implementation standing for the one value it encodes as.
+type unionLiteral struct {
+	v reflect.Value
+	x Value
+}
+
+var (
+	unionsMu sync.RWMutex
+	unions   = make(map[reflect.Type]*union)
+)
+
+// RegisterUnion registers impls as implementations of the interface type that
+// iface points to, so that a value decoded into the interface is decoded into
+// the implementation matching it.
+//
+// An implementation that is a Labeler registers its type, which is matched by
+// the label of records. Such types are typically structs encoded as records,
+// and a matching record is decoded into a new value of the type. Any other
+// implementation stands for the single value it encodes as, such as a symbol,
+// and is stored as given when that value is decoded:
+//
+//	syrup.RegisterUnion((*Operation)(nil), Deliver{}, Abort{}, Ping{})
+//
+// Values of the interface are encoded as their dynamic values are. Decoding a
+// value no implementation matches into the interface is an error.
+// RegisterUnion may be called more than once for an interface, and panics if
+// iface is not a pointer to an interface type, if an implementation does not
+// implement it or cannot be encoded, or if two implementations share a label
+// or a value.
+func RegisterUnion(iface interface{}, impls ...interface{}) {
+	pt := reflect.TypeOf(iface)
+	if pt == nil || pt.Kind() != reflect.Ptr || pt.Elem().Kind() != reflect.Interface {
+		panic(fmt.Sprintf("syrup: RegisterUnion given %v, not a pointer to an interface", pt))
+	}
+	t := pt.Elem()
+	unionsMu.Lock()
+	defer unionsMu.Unlock()
+	u, ok := unions[t]
+	if !ok {
+		u = &union{labels: make(map[Symbol]reflect.Type)}
+		unions[t] = u
+	}
+	for _, impl := range impls {
+		it := reflect.TypeOf(impl)
+		if it == nil || !it.Implements(t) {
+			panic(fmt.Sprintf("syrup: RegisterUnion given %v, which does not implement %v", it, t))
+		}
+		if l, ok := impl.(Labeler); ok {
+			u.addLabeled(t, it, l.SyrupLabel())
+		} else {
+			u.addLiteral(t, impl)
+		}
+	}
+}
+
+func (u *union) addLabeled(t, it reflect.Type, label Symbol) {
+	if other, ok := u.labels[label]; ok {
+		if other != it {
+			panic(fmt.Sprintf("syrup: RegisterUnion given %v and %v for %v, which are both labeled %s", other, it, t, label))
+		}
+		return
+	}
+	for _, lit := range u.literals {
+		if lit.x.Kind() == RecordKind && lit.x.Label().Equal(NewSymbol(label)) {
+			panic(fmt.Sprintf("syrup: RegisterUnion given %v and %v for %v, which are both labeled %s", lit.v.Type(), it, t, label))
+		}
+	}
+	u.labels[label] = it
+	u.addType(it)
+}
+
+func (u *union) addLiteral(t reflect.Type, impl interface{}) {
+	x, err := ValueOf(impl)
+	if err != nil {
+		panic(fmt.Sprintf("syrup: RegisterUnion given %#v for %v, which cannot be encoded: %v", impl, t, err))
+	}
+	if x.Kind() == RecordKind && x.Label().Kind() == SymbolKind {
+		if other, ok := u.labels[x.Label().Symbol()]; ok {
+			panic(fmt.Sprintf("syrup: RegisterUnion given %v and %v for %v, which are both labeled %s", other, reflect.TypeOf(impl), t, x.Label().Symbol()))
+		}
+	}
+	for _, lit := range u.literals {
+		if lit.x.Equal(x) {
+			if lit.v.Type() != reflect.TypeOf(impl) {
+				panic(fmt.Sprintf("syrup: RegisterUnion given %v and %v for %v, which are both %v", lit.v.Type(), reflect.TypeOf(impl), t, x))
+			}
+			return
+		}
+	}
+	u.literals = append(u.literals, unionLiteral{v: reflect.ValueOf(impl), x: x})
+	u.addType(reflect.TypeOf(impl))
+}
+
+func (u *union) addType(it reflect.Type) {
+	for _, other := range u.types {
+		if other == it {
+			return
+		}
+	}
+	u.types = append(u.types, it)
+}
+
+// UnionTypes returns the types of the implementations registered for the
+// interface type t by RegisterUnion, in the order they were first registered.
+func UnionTypes(t reflect.Type) []reflect.Type {
+	unionsMu.RLock()
+	defer unionsMu.RUnlock()
+	if u, ok := unions[t]; ok {
+		return append([]reflect.Type(nil), u.types...)
+	}
+	return nil
+}
+
+// UnionLiterals returns the implementations registered for the interface type
+// t by RegisterUnion that stand for the value they encode as, rather than
+// being matched by label, in the order they were registered.
+func UnionLiterals(t reflect.Type) []interface{} {
+	unionsMu.RLock()
+	defer unionsMu.RUnlock()
+	var impls []interface{}
+	if u, ok := unions[t]; ok {
+		for _, lit := range u.literals {
+			impls = append(impls, lit.v.Interface())
+		}
+	}
+	return impls
+}
+
+// unionType returns the implementation registered for the interface type t
+// with the label.
+func unionType(t reflect.Type, label Symbol) (reflect.Type, bool) {
+	unionsMu.RLock()
+	defer unionsMu.RUnlock()
+	if u, ok := unions[t]; ok {
+		it, ok := u.labels[label]
+		return it, ok
+	}
+	return nil, false
+}
+
+// unionLiteralOf returns the implementation registered for the interface type
+// t that stands for x. hasLiterals is whether t has any such implementations.
+func unionLiteralOf(t reflect.Type, x *Value) (v reflect.Value, hasLiterals bool) {
+	unionsMu.RLock()
+	defer unionsMu.RUnlock()
+	u, ok := unions[t]
+	if !ok || len(u.literals) == 0 {
+		return reflect.Value{}, false
+	}
+	if x != nil {
+		for _, lit := range u.literals {
+			if lit.x.Equal(*x) {
+				return lit.v, true
+			}
+		}
+	}
+	return reflect.Value{}, true
+}
+
+// decodeUnion decodes the value beginning with oper into v, a value of an
+// interface type, using the implementation registered for it. The label of a
+// record is read ahead to choose the implementation, which then decodes the
+// whole record itself.
+func (d *Decoder) decodeUnion(target, v reflect.Value, oper op) error {
+	if oper == openRecordOp {
+		label, done, err := d.peekLabel(v.Type())
+		if err != nil {
+			return err
+		}
+		defer done()
+		if it, ok := unionType(v.Type(), label); ok {
+			c := reflect.New(it).Elem()
+			if err := typeDecoder(it)(d, c, c, oper); err != nil {
+				return err
+			}
+			v.Set(c)
+			return nil
+		}
+	} else if _, ok := unionLiteralOf(v.Type(), nil); !ok {
+		return d.decodeOp(target, v, oper)
+	}
+	x, err := d.decodeValue(oper)
+	if err != nil {
+		return err
+	}
+	if d.nilSentinel != nil && Equal(x, d.nilSentinel) {
+		d.storeNil(target)
+		return nil
+	}
+	if lit, _ := unionLiteralOf(v.Type(), &x); lit.IsValid() {
+		v.Set(lit)
+		return nil
+	}
+	desc := opValues[oper]
+	if x.Kind() == RecordKind {
+		desc = fmt.Sprintf("record labeled %v", x.Label())
+	} else if x.Kind() == SymbolKind {
+		desc = fmt.Sprintf("symbol %v", x.Symbol())
+	}
+	return &InvalidTypeError{Value: desc, Type: v.Type(), Offset: d.n}
+}
+
+// peekLabel reads the label of the record just opened, and arranges for the
+// bytes of the label to be read again. Labels other than symbols are returned
+// as the empty Symbol. Calling done once the record has been read stops the
+// arrangement. Errors report the type t.
+func (d *Decoder) peekLabel(t reflect.Type) (label Symbol, done func(), err error) {
+	r, n := d.r, d.n
+	var buf bytes.Buffer
+	d.r = io.TeeReader(r, &buf)
+	var l interface{}
+	last, err := d.runKey(reflect.ValueOf(&l), nil)
+	d.r = r
+	if err != nil {
+		return "", nil, err
+	} else if last == closeRecordOp {
+		return "", nil, &InvalidTypeError{Value: "record without a label", Type: t, Offset: d.n}
+	}
+	d.r, d.n = io.MultiReader(&buf, r), n
+	done = func() {
+		// Bytes left unread after an error remain to be read.
+		if buf.Len() == 0 {
+			d.r = r
+		}
+	}
+	label, _ = l.(Symbol)
+	return label, done, nil
+}
@@ -0,0 +1,533 @@
+package syrup
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// Kind identifies the kind of data held by a Value. Kinds are declared in the
+// order the Preserves data model sorts values of different kinds.
+type Kind uint8
+
+const (
+	// InvalidKind is the Kind of the zero Value, which holds nothing.
+	InvalidKind Kind = iota
+	BoolKind
+	Float32Kind
+	Float64Kind
+	IntKind
+	StringKind
+	BytesKind
+	SymbolKind
+	RecordKind
+	ListKind
+	SetKind
+	DictKind
+)
+
+var kindNames = []string{
+	InvalidKind: "invalid",
+	BoolKind:    "bool",
+	Float32Kind: "float32",
+	Float64Kind: "float64",
+	IntKind:     "int",
+	StringKind:  "string",
+	BytesKind:   "bytes",
+	SymbolKind:  "symbol",
+	RecordKind:  "record",
+	ListKind:    "list",
+	SetKind:     "set",
+	DictKind:    "dict",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", uint8(k))
+}
+
+// Value is any Syrup value, holding exactly one kind of data. Unlike decoding
+// into an interface{}, decoding into a Value keeps every distinction the wire
+// format makes, and keeps the order of dictionary entries, which may have keys
+// of any kind.
+//
+// Values are immutable: constructors and accessors copy any slices they are
+// given or return. The zero Value has InvalidKind and cannot be encoded.
+type Value struct {
+	kind Kind
+	// num holds a bool, the bits of a float, or an int64.
+	num uint64
+	// big holds an integer that does not fit into an int64.
+	big *big.Int
+	// str holds a string, symbol, or bytestring.
+	str string
+	// seq holds the elements of a list or set, the label and then values
+	// of a record, or the alternating keys and values of a dictionary.
+	seq []Value
+}
+
+// DictEntry is a key and value in a dictionary Value.
+type DictEntry struct {
+	Key   Value
+	Value Value
+}
+
+var typeOfValue = reflect.TypeOf(Value{})
+
+// NewBool returns a Value holding a boolean.
+func NewBool(b bool) Value {
+	v := Value{kind: BoolKind}
+	if b {
+		v.num = 1
+	}
+	return v
+}
+
+// NewFloat32 returns a Value holding a single precision float.
+func NewFloat32(f float32) Value {
+	return Value{kind: Float32Kind, num: uint64(math.Float32bits(f))}
+}
+
+// NewFloat64 returns a Value holding a double precision float.
+func NewFloat64(f float64) Value {
+	return Value{kind: Float64Kind, num: math.Float64bits(f)}
+}
+
+// NewInt returns a Value holding an integer.
+func NewInt(i int64) Value {
+	return Value{kind: IntKind, num: uint64(i)}
+}
+
+// NewBigInt returns a Value holding an integer of any size.
+func NewBigInt(i *big.Int) Value {
+	if i.IsInt64() {
+		return NewInt(i.Int64())
+	}
+	return Value{kind: IntKind, big: new(big.Int).Set(i)}
+}
+
+// NewString returns a Value holding a string.
+func NewString(s string) Value {
+	return Value{kind: StringKind, str: s}
+}
+
+// NewBytes returns a Value holding a bytestring.
+func NewBytes(b []byte) Value {
+	return Value{kind: BytesKind, str: string(b)}
+}
+
+// NewSymbol returns a Value holding a symbol.
+func NewSymbol(s Symbol) Value {
+	return Value{kind: SymbolKind, str: string(s)}
+}
+
+// NewRecord returns a Value holding a record with the label and values.
+func NewRecord(label Value, values ...Value) Value {
+	seq := make([]Value, 0, 1+len(values))
+	seq = append(seq, label)
+	return Value{kind: RecordKind, seq: append(seq, values...)}
+}
+
+// NewList returns a Value holding a list of the elements.
+func NewList(elems ...Value) Value {
+	return Value{kind: ListKind, seq: append([]Value{}, elems...)}
+}
+
+// NewSet returns a Value holding a set of the elements. It is up to the caller
+// to ensure the elements are distinct.
+func NewSet(elems ...Value) Value {
+	return Value{kind: SetKind, seq: append([]Value{}, elems...)}
+}
+
+// NewDict returns a Value holding a dictionary of the entries, in order. It is
+// up to the caller to ensure the keys are distinct.
+func NewDict(entries ...DictEntry) Value {
+	seq := make([]Value, 0, 2*len(entries))
+	for _, e := range entries {
+		seq = append(seq, e.Key, e.Value)
+	}
+	return Value{kind: DictKind, seq: seq}
+}
+
+// ValueOf returns the Value for any Go value the Encoder is able to encode.
+func ValueOf(v interface{}) (Value, error) {
+	if x, ok := decodedValueOf(v); ok {
+		return x, nil
+	}
+	enc := NewPrototypeEncoding()
+	var buf bytes.Buffer
+	if err := NewEncoder(enc, &buf).Encode(v); err != nil {
+		return Value{}, err
+	}
+	var x Value
+	err := NewDecoder(enc, &buf).Decode(&x)
+	return x, err
+}
+
+// decodedValueOf converts the representation the Decoder uses for interface{}
+// without encoding it, reporting false for any other Go value.
+func decodedValueOf(v interface{}) (Value, bool) {
+	switch x := v.(type) {
+	case Value:
+		return x, true
+	case bool:
+		return NewBool(x), true
+	case int64:
+		return NewInt(x), true
+	case *big.Int:
+		if x != nil {
+			return NewBigInt(x), true
+		}
+	case float32:
+		return NewFloat32(x), true
+	case float64:
+		return NewFloat64(x), true
+	case string:
+		return NewString(x), true
+	case []byte:
+		if x != nil {
+			return NewBytes(x), true
+		}
+	case Symbol:
+		return NewSymbol(x), true
+	case Record:
+		label, ok := decodedValueOf(x.Label)
+		if !ok {
+			return Value{}, false
+		}
+		seq, ok := decodedValuesOf(x.Values)
+		return Value{kind: RecordKind, seq: append([]Value{label}, seq...)}, ok
+	case Set:
+		seq, ok := decodedValuesOf(x)
+		return Value{kind: SetKind, seq: seq}, ok
+	case []interface{}:
+		if x != nil {
+			seq, ok := decodedValuesOf(x)
+			return Value{kind: ListKind, seq: seq}, ok
+		}
+	case map[interface{}]interface{}:
+		if x == nil {
+			break
+		}
+		seq := make([]Value, 0, 2*len(x))
+		for k, e := range x {
+			kv, ok := decodedValueOf(k)
+			if !ok {
+				return Value{}, false
+			}
+			ev, ok := decodedValueOf(e)
+			if !ok {
+				return Value{}, false
+			}
+			seq = append(seq, kv, ev)
+		}
+		return Value{kind: DictKind, seq: seq}, true
+	}
+	return Value{}, false
+}
+
+func decodedValuesOf(vs []interface{}) ([]Value, bool) {
+	seq := make([]Value, len(vs))
+	for i, v := range vs {
+		x, ok := decodedValueOf(v)
+		if !ok {
+			return nil, false
+		}
+		seq[i] = x
+	}
+	return seq, true
+}
+
+// Kind returns the kind of data v holds.
+func (v Value) Kind() Kind {
+	return v.kind
+}
+
+// mustBe panics if v is not of kind k, as calling an accessor for the wrong
+// kind is a programming error.
+func (v Value) mustBe(method string, kinds ...Kind) {
+	for _, k := range kinds {
+		if v.kind == k {
+			return
+		}
+	}
+	panic(fmt.Sprintf("syrup: call of Value.%s on %v Value", method, v.kind))
+}
+
+// Bool returns the boolean v holds. It panics if v is not of BoolKind.
+func (v Value) Bool() bool {
+	v.mustBe("Bool", BoolKind)
+	return v.num != 0
+}
+
+// Float32 returns the float v holds. It panics if v is not of Float32Kind.
+func (v Value) Float32() float32 {
+	v.mustBe("Float32", Float32Kind)
+	return math.Float32frombits(uint32(v.num))
+}
+
+// Float64 returns the float v holds. It panics if v is not of Float64Kind.
+func (v Value) Float64() float64 {
+	v.mustBe("Float64", Float64Kind)
+	return math.Float64frombits(v.num)
+}
+
+// Int64 returns the integer v holds, and whether it fits into an int64. It
+// panics if v is not of IntKind.
+func (v Value) Int64() (int64, bool) {
+	v.mustBe("Int64", IntKind)
+	if v.big != nil {
+		return 0, false
+	}
+	return int64(v.num), true
+}
+
+// BigInt returns a copy of the integer v holds. It panics if v is not of
+// IntKind.
+func (v Value) BigInt() *big.Int {
+	v.mustBe("BigInt", IntKind)
+	if v.big != nil {
+		return new(big.Int).Set(v.big)
+	}
+	return big.NewInt(int64(v.num))
+}
+
+// String returns the string v holds when it is of StringKind, and otherwise
+// returns the Printer's text form of v.
+func (v Value) String() string {
+	if v.kind == StringKind {
+		return v.str
+	}
+	p := &Printer{}
+	return p.Sprint(v)
+}
+
+// Bytes returns a copy of the bytestring v holds. It panics if v is not of
+// BytesKind.
+func (v Value) Bytes() []byte {
+	v.mustBe("Bytes", BytesKind)
+	return []byte(v.str)
+}
+
+// Symbol returns the symbol v holds. It panics if v is not of SymbolKind.
+func (v Value) Symbol() Symbol {
+	v.mustBe("Symbol", SymbolKind)
+	return Symbol(v.str)
+}
+
+// Label returns the label of a record. It panics if v is not of RecordKind.
+func (v Value) Label() Value {
+	v.mustBe("Label", RecordKind)
+	return v.seq[0]
+}
+
+// Len returns the number of values of a record, elements of a list or set, or
+// entries of a dictionary. It panics if v is not one of those kinds.
+func (v Value) Len() int {
+	v.mustBe("Len", RecordKind, ListKind, SetKind, DictKind)
+	switch v.kind {
+	case RecordKind:
+		return len(v.seq) - 1
+	case DictKind:
+		return len(v.seq) / 2
+	}
+	return len(v.seq)
+}
+
+// Index returns the i'th value of a record, or element of a list or set. It
+// panics if v is not one of those kinds, or i is out of range.
+func (v Value) Index(i int) Value {
+	v.mustBe("Index", RecordKind, ListKind, SetKind)
+	if v.kind == RecordKind {
+		return v.seq[1:][i]
+	}
+	return v.seq[i]
+}
+
+// Elems returns the values of a record, or the elements of a list or set. It
+// panics if v is not one of those kinds.
+func (v Value) Elems() []Value {
+	v.mustBe("Elems", RecordKind, ListKind, SetKind)
+	if v.kind == RecordKind {
+		return append([]Value{}, v.seq[1:]...)
+	}
+	return append([]Value{}, v.seq...)
+}
+
+// Entries returns the entries of a dictionary, in order. It panics if v is not
+// of DictKind.
+func (v Value) Entries() []DictEntry {
+	v.mustBe("Entries", DictKind)
+	entries := make([]DictEntry, 0, len(v.seq)/2)
+	for i := 0; i+1 < len(v.seq); i += 2 {
+		entries = append(entries, DictEntry{Key: v.seq[i], Value: v.seq[i+1]})
+	}
+	return entries
+}
+
+// Get returns the value of the dictionary entry with the key, and whether it
+// exists. It panics if v is not of DictKind.
+func (v Value) Get(key Value) (Value, bool) {
+	v.mustBe("Get", DictKind)
+	for i := 0; i+1 < len(v.seq); i += 2 {
+		if v.seq[i].Equal(key) {
+			return v.seq[i+1], true
+		}
+	}
+	return Value{}, false
+}
+
+// Format implements fmt.Formatter, writing the Printer's text form for the %v
+// and %s verbs.
+func (v Value) Format(f fmt.State, verb rune) {
+	formatText(f, verb, v)
+}
+
+// encodeValue writes the data held by x.
+func (e *Encoder) encodeValue(x Value) error {
+	switch x.kind {
+	case BoolKind:
+		return e.writeValue(e.enc.fmtBool(x.Bool()))
+	case Float32Kind:
+		return e.writeValue(e.enc.fmtFloat32(x.Float32()))
+	case Float64Kind:
+		return e.writeValue(e.enc.fmtFloat64(x.Float64()))
+	case IntKind:
+		if x.big != nil {
+			return e.writeValue(e.enc.fmtBigInt(x.big))
+		}
+		return e.writeValue(e.enc.fmtInt(int64(x.num)))
+	case StringKind:
+		return e.writeValue(e.enc.fmtString(x.str))
+	case BytesKind:
+		return e.writeValue(e.enc.fmtBytes([]byte(x.str)))
+	case SymbolKind:
+		return e.writeValue(e.enc.fmtSymbol(x.str))
+	case RecordKind:
+		if err := e.open(openRecordOp); err != nil {
+			return err
+		}
+		e.push(RecordLabel{})
+		if err := e.encodeValue(x.seq[0]); err != nil {
+			return err
+		}
+		e.pop()
+		if err := e.encodeValueElems(x.seq[1:]); err != nil {
+			return err
+		}
+		return e.close(closeRecordOp)
+	case ListKind, SetKind:
+		oper, closer := openListOp, closeListOp
+		if x.kind == SetKind {
+			oper, closer = openSetOp, closeSetOp
+		}
+		if err := e.open(oper); err != nil {
+			return err
+		}
+		if err := e.encodeValueElems(x.seq); err != nil {
+			return err
+		}
+		return e.close(closer)
+	case DictKind:
+		if err := e.open(openDictOp); err != nil {
+			return err
+		}
+		for i := 0; i+1 < len(x.seq); i += 2 {
+			e.push(x.seq[i])
+			if err := e.encodeValue(x.seq[i]); err != nil {
+				return err
+			}
+			if err := e.encodeValue(x.seq[i+1]); err != nil {
+				return err
+			}
+			e.pop()
+		}
+		return e.close(closeDictOp)
+	default:
+		return &UnsupportedValueError{Value: reflect.ValueOf(x), Str: "zero Value", Path: e.pointer()}
+	}
+}
+
+func (e *Encoder) encodeValueElems(xs []Value) error {
+	for i, x := range xs {
+		e.push(i)
+		if err := e.encodeValue(x); err != nil {
+			return err
+		}
+		e.pop()
+	}
+	return nil
+}
+
+// decodeValue decodes the value beginning with oper, reading the rest of any
+// compound value from the stream.
+func (d *Decoder) decodeValue(oper op) (Value, error) {
+	t, err := d.token(oper)
+	if err != nil {
+		return Value{}, err
+	}
+	d.n++
+	switch x := t.(type) {
+	case bool:
+		return NewBool(x), nil
+	case int64:
+		return NewInt(x), nil
+	case *big.Int:
+		return Value{kind: IntKind, big: x}, nil
+	case float32:
+		return NewFloat32(x), nil
+	case float64:
+		return NewFloat64(x), nil
+	case string:
+		return NewString(x), nil
+	case []byte:
+		return Value{kind: BytesKind, str: string(x)}, nil
+	case Symbol:
+		return NewSymbol(x), nil
+	case Delim:
+		var kind Kind
+		var end op
+		switch x {
+		case ListStart:
+			kind, end = ListKind, closeListOp
+		case SetStart:
+			kind, end = SetKind, closeSetOp
+		case RecordStart:
+			kind, end = RecordKind, closeRecordOp
+		case DictStart:
+			kind, end = DictKind, closeDictOp
+		default:
+			return Value{}, fmt.Errorf("syrup: unexpected %v at byte offset %d", x, d.n)
+		}
+		v := Value{kind: kind, seq: []Value{}}
+		for {
+			next, err := d.nextOp()
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return Value{}, err
+			} else if next == end {
+				break
+			}
+			elem, err := d.decodeValue(next)
+			if err != nil {
+				return Value{}, err
+			}
+			v.seq = append(v.seq, elem)
+		}
+		if kind == RecordKind && len(v.seq) == 0 {
+			return Value{}, fmt.Errorf("syrup: record without a label at byte offset %d", d.n)
+		} else if kind == DictKind && len(v.seq)%2 != 0 {
+			return Value{}, fmt.Errorf("syrup: dictionary key without a value at byte offset %d", d.n)
+		}
+		return v, nil
+	default:
+		return Value{}, &InvalidTypeError{Value: fmt.Sprintf("%T", t), Type: typeOfValue, Offset: d.n}
+	}
+}